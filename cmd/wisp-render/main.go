@@ -0,0 +1,134 @@
+// wisp-render — офлайн-рендер NetJSON-шаблонов (тот же конвейер, что и reconcile):
+//
+//	wisp-render [-backend openwrt|networkd|routeros] [-strict] [-vars vars.json] [-secret-key k] [-hostname r1] [-o config.tar.gz] base.json site.json ...
+//
+// Шаблоны сливаются в порядке аргументов (следующий перекрывает предыдущий); с -strict
+// неразрешённые переменные и ошибки шаблонов в строках тоже ошибки. Без -o файлы
+// печатаются в stdout. Коды выхода: 0 — ок, 1 — ошибки валидации/рендера, 2 — ошибка запуска.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"wisp/internal/render/backend"
+	rnetjson "wisp/internal/render/netjson"
+	"wisp/internal/render/uci"
+)
+
+func main() {
+	beName := flag.String("backend", backend.Default, "target backend: "+strings.Join(backend.Names(), ", "))
+	strict := flag.Bool("strict", false, "strict validation: fail on any invalid value or unknown key")
+	varsFile := flag.String("vars", "", "JSON object with device variables for ApplyVars")
+	hostname := flag.String("hostname", "", "device hostname (system.hostname fallback)")
+	secretKey := flag.String("secret-key", "", "HMAC key for devicesecret in templates (render.secret_key)")
+	out := flag.String("o", "", "write config payload (tar.gz or single file) here instead of printing files")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] template.json [template.json ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	be, err := backend.Get(*beName)
+	if err != nil {
+		fatal(2, err)
+	}
+
+	vars := map[string]any{}
+	if *varsFile != "" {
+		if vars, err = readJSON(*varsFile); err != nil {
+			fatal(2, err)
+		}
+	}
+	// как VarsForDevice: backend — встроенная переменная (для $if)
+	vars["backend"] = be.Name
+
+	sources := make([]rnetjson.Source, 0, flag.NArg())
+	for i, path := range flag.Args() {
+		m, err := readJSON(path)
+		if err != nil {
+			fatal(2, err)
+		}
+		if m, err = rnetjson.EvalConditions(m, vars); err != nil {
+			varErrors(path+": ", err)
+		}
+		sources = append(sources, rnetjson.Source{Name: path, Priority: i, JSON: m})
+	}
+	merged, err := rnetjson.Merge(sources...)
+	if err != nil {
+		fatal(1, err)
+	}
+	if *varsFile != "" {
+		merged, err = rnetjson.ApplyVarsWith(merged, vars, rnetjson.VarsOptions{Strict: *strict, SecretKey: []byte(*secretKey)})
+		if err != nil {
+			varErrors("", err)
+		}
+	}
+
+	files, err := be.Render(merged, uci.Options{DeviceHostname: *hostname, Strict: *strict})
+	var unclaimed *uci.UnclaimedKeysError
+	var verrs uci.ValidationErrors
+	switch {
+	case errors.As(err, &verrs):
+		for _, e := range verrs {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		os.Exit(1)
+	case errors.As(err, &unclaimed):
+		fmt.Fprintln(os.Stderr, "warning:", err)
+	case err != nil:
+		fatal(1, err)
+	}
+
+	if *out != "" {
+		payload, sum, err := be.Package(files, nil)
+		if err != nil {
+			fatal(1, err)
+		}
+		if err := os.WriteFile(*out, payload, 0644); err != nil {
+			fatal(2, err)
+		}
+		fmt.Println(sum)
+		return
+	}
+	for _, f := range files {
+		fmt.Printf("==> %s (%04o) <==\n%s\n", f.Name, f.Mode, f.Data)
+	}
+}
+
+func readJSON(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// varErrors печатает VarErrors по одной на строку и выходит с кодом 1.
+func varErrors(prefix string, err error) {
+	var verrs rnetjson.VarErrors
+	if !errors.As(err, &verrs) {
+		fatal(1, err)
+	}
+	for _, e := range verrs {
+		fmt.Fprintln(os.Stderr, prefix+e.Error())
+	}
+	os.Exit(1)
+}
+
+func fatal(code int, err error) {
+	fmt.Fprintln(os.Stderr, "wisp-render:", err)
+	os.Exit(code)
+}
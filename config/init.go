@@ -46,6 +46,13 @@ type Config struct {
 					Token     string // опционально
 				} `mapstructure:"zerotier"`
 			} `mapstructure:"mgmtVPN"`
+			Render struct {
+				// модели железа (Device.HardwareModel — model из register агента; без учёта регистра,
+				// по подстроке) со старым swconfig вместо DSA
+				SwconfigModels []string `mapstructure:"swconfig_models"` // ["TL-WR841N", "Archer C7"]
+				Strict         bool     `mapstructure:"strict"`          // строгая валидация: битый NetJSON валит reconcile
+				SecretKey      string   `mapstructure:"secret_key"`      // ключ devicesecret в шаблонах; пусто — shared_secret
+			} `mapstructure:"render"`
 		} `mapstructure:"controller"`
 	} `mapstructure:"openwisp"`
 
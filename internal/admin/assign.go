@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"wisp/internal/logs"
+	"wisp/internal/models"
+	"wisp/internal/repo"
+)
+
+// APIDeviceTemplateAttach — POST /admin/api/devices/{uuid}/templates (template_id): привязать шаблон
+// и пересобрать конфиг устройства.
+func (h *Handler) APIDeviceTemplateAttach(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", 400)
+		return
+	}
+	var dev models.Device
+	if err := h.d.DB.Where("uuid=?", mux.Vars(r)["uuid"]).First(&dev).Error; err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	id, _ := strconv.Atoi(r.FormValue("template_id"))
+	var t models.ConfigTemplate
+	if err := h.d.DB.First(&t, id).Error; err != nil {
+		http.Error(w, "template not found", 404)
+		return
+	}
+	if err := h.d.TS.Assign(r.Context(), dev.ID, t.ID); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.reconcileDevices(r.Context(), []string{dev.UUID})
+	http.Redirect(w, r, "/admin/devices/"+dev.UUID, http.StatusFound)
+}
+
+// APIDeviceTemplateDetach — POST /admin/api/devices/{uuid}/templates/{id}/detach: отвязать шаблон
+// (Required — 409) и пересобрать конфиг устройства.
+func (h *Handler) APIDeviceTemplateDetach(w http.ResponseWriter, r *http.Request) {
+	var dev models.Device
+	if err := h.d.DB.Where("uuid=?", mux.Vars(r)["uuid"]).First(&dev).Error; err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := h.d.TS.Unassign(r.Context(), dev.ID, uint(id)); err != nil {
+		code := 500
+		if errors.Is(err, repo.ErrTemplateRequired) {
+			code = 409
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	h.reconcileDevices(r.Context(), []string{dev.UUID})
+	http.Redirect(w, r, "/admin/devices/"+dev.UUID, http.StatusFound)
+}
+
+// reconcileTemplateDevices пересобирает устройства, на которые действует t (см. DevicesForTemplate).
+func (h *Handler) reconcileTemplateDevices(ctx context.Context, t models.ConfigTemplate) {
+	uuids, err := h.d.TS.DevicesForTemplate(ctx, t)
+	if err != nil {
+		logs.Logger.Warnf("template %s: list devices: %v", t.Name, err)
+		return
+	}
+	h.reconcileDevices(ctx, uuids)
+}
+
+// reconcileDevices пересобирает конфиг устройств после смены привязок; ошибка одного устройства
+// (например, не хватает переменных нового шаблона) — в лог, остальные собираются.
+func (h *Handler) reconcileDevices(ctx context.Context, uuids []string) {
+	for _, uuid := range uuids {
+		if _, _, err := h.d.REC.Reconcile(ctx, uuid); err != nil {
+			logs.Logger.Warnf("reconcile %s after template assignment change: %v", uuid, err)
+		}
+	}
+}
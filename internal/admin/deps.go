@@ -31,6 +31,7 @@ func Attach(r *mux.Router, d Dependencies) {
 	sub.HandleFunc("/devices", h.DevicesList).Methods("GET")
 	sub.HandleFunc("/devices/{uuid}", h.DeviceDetail).Methods("GET")
 	sub.HandleFunc("/devices/{uuid}/config/view", h.DeviceConfigView).Methods("GET")
+	sub.HandleFunc("/devices/{uuid}/netjson", h.DeviceNetJSONView).Methods("GET")
 	sub.HandleFunc("/templates", h.TemplatesList).Methods("GET")
 	sub.HandleFunc("/templates/new", h.TemplateNew).Methods("GET")
 	sub.HandleFunc("/templates/{id:[0-9]+}/edit", h.TemplateEdit).Methods("GET")
@@ -39,12 +40,17 @@ func Attach(r *mux.Router, d Dependencies) {
 
 	// api (JSON or redirect back)
 	sub.HandleFunc("/api/devices/{uuid}/reconcile", h.APIReconcile).Methods("POST")
+	sub.HandleFunc("/api/devices/{uuid}/vars", h.APIDeviceVars).Methods("POST")
+	sub.HandleFunc("/api/devices/{uuid}/templates", h.APIDeviceTemplateAttach).Methods("POST")
+	sub.HandleFunc("/api/devices/{uuid}/templates/{id:[0-9]+}/detach", h.APIDeviceTemplateDetach).Methods("POST")
 	sub.HandleFunc("/api/devices/{uuid}/secrets/issue", h.APISecretIssue).Methods("POST")
 	sub.HandleFunc("/api/devices/{uuid}/secrets/revoke_all", h.APISecretRevokeAll).Methods("POST")
 
 	sub.HandleFunc("/api/templates", h.APITemplateCreate).Methods("POST")
+	sub.HandleFunc("/api/templates/validate", h.APITemplateValidate).Methods("POST")
 	sub.HandleFunc("/api/templates/{id:[0-9]+}", h.APITemplateUpdate).Methods("POST")
 	sub.HandleFunc("/api/templates/{id:[0-9]+}/delete", h.APITemplateDelete).Methods("POST")
+	sub.HandleFunc("/api/import", h.APIImport).Methods("POST")
 
 	// static (very small)
 	sub.HandleFunc("/static/style.css", serveCSS).Methods("GET")
@@ -16,6 +16,9 @@ import (
 	"gorm.io/gorm"
 
 	"wisp/internal/models"
+	"wisp/internal/render/backend"
+	rnetjson "wisp/internal/render/netjson"
+	"wisp/internal/repo"
 )
 
 type Handler struct {
@@ -76,15 +79,49 @@ func (h *Handler) DeviceDetail(w http.ResponseWriter, r *http.Request) {
 		Select("key_id, revoked_at IS NOT NULL as revoked, created_at").
 		Where("device_id=?", dev.ID).Order("created_at desc").Scan(&secs).Error
 
-	// templates list
-	var tpls []models.ConfigTemplate
-	_ = h.d.DB.Order("priority asc").Find(&tpls).Error
+	// шаблоны устройства (привязанные и Required) и остальные — для привязки
+	tpls, err := h.d.TS.ListForDevice(r.Context(), dev.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	var others []models.ConfigTemplate
+	q := h.d.DB.Order("priority asc, id asc")
+	if len(tpls) > 0 {
+		ids := make([]uint, len(tpls))
+		for i, t := range tpls {
+			ids[i] = t.ID
+		}
+		q = q.Where("id NOT IN ?", ids)
+	}
+	_ = q.Find(&others).Error
+
+	// форма переменных по VarsSchema шаблонов
+	vars := map[string]any{}
+	if len(dev.Vars) > 0 {
+		_ = json.Unmarshal(dev.Vars, &vars)
+	}
+	if vars == nil {
+		vars = map[string]any{}
+	}
+	schemaTpls, err := h.deviceSchemaTemplates(r.Context(), &dev)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	fields, err := varFields(schemaTpls, vars)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
 
 	h.render(w, "device_detail.tmpl", map[string]any{
 		"Title":     "Device " + dev.UUID,
 		"Dev":       dev,
 		"Secrets":   secs,
 		"Templates": tpls,
+		"Others":    others,
+		"VarFields": fields,
 	})
 }
 
@@ -95,12 +132,18 @@ func (h *Handler) DeviceConfigView(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	// list entries from tar.gz
+	// list entries from tar.gz (single-file backend — сам файл)
+	be := backend.ForModel(dev.Model)
 	files := []struct {
 		Name string
 		Size int64
 	}{}
-	if len(dev.ConfigArchive) > 0 {
+	if len(dev.ConfigArchive) > 0 && be.Single != "" {
+		files = append(files, struct {
+			Name string
+			Size int64
+		}{be.Single, int64(len(dev.ConfigArchive))})
+	} else if len(dev.ConfigArchive) > 0 {
 		tr := tar.NewReader(mustGzipReader(bytes.NewReader(dev.ConfigArchive)))
 		for {
 			hdr, err := tr.Next()
@@ -122,6 +165,7 @@ func (h *Handler) DeviceConfigView(w http.ResponseWriter, r *http.Request) {
 	h.render(w, "device_config.tmpl", map[string]any{
 		"Title":    "Config tarball",
 		"Dev":      dev,
+		"Backend":  be,
 		"Files":    files,
 		"Checksum": dev.ConfigChecksum,
 		"Version":  dev.ConfigVersion,
@@ -154,8 +198,19 @@ func (h *Handler) TemplateEdit(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	includes, _ := repo.TemplateIncludes(t)
+	// развёртка с родителем и includes; ошибка (цикл, нет шаблона) показывается на странице
+	parts, lines, err := h.expandedTemplate(r.Context(), t)
+	expandErr := ""
+	if err != nil {
+		expandErr = err.Error()
+	}
 	h.render(w, "template_edit.tmpl", map[string]any{
 		"Title": "Edit Template", "Tpl": t, "IsNew": false,
+		"Includes":    strings.Join(includes, ", "),
+		"Parts":       parts,
+		"Lines":       lines,
+		"ExpandError": expandErr,
 	})
 }
 
@@ -189,6 +244,64 @@ func (h *Handler) APIReconcile(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, map[string]any{"checksum": sum, "updated": upd})
 }
 
+// APIDeviceVars — сохранить Device.Vars (JSON-объект из vars или, при form=schema, поля var.<имя>
+// формы по VarsSchema) и сразу пересобрать конфиг.
+func (h *Handler) APIDeviceVars(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", 400)
+		return
+	}
+	var dev models.Device
+	if err := h.d.DB.Where("uuid=?", mux.Vars(r)["uuid"]).First(&dev).Error; err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	raw := strings.TrimSpace(r.FormValue("vars"))
+	if raw == "" {
+		raw = "{}"
+	}
+	var obj map[string]any
+	if r.FormValue("form") == "schema" {
+		// форма по VarsSchema: поля поверх текущих Vars
+		obj = map[string]any{}
+		if len(dev.Vars) > 0 {
+			_ = json.Unmarshal(dev.Vars, &obj)
+		}
+		if obj == nil {
+			obj = map[string]any{}
+		}
+		tpls, err := h.deviceSchemaTemplates(r.Context(), &dev)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		fields, err := varFields(tpls, obj)
+		if err == nil {
+			err = formVars(r, fields, obj)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		b, _ := json.Marshal(obj)
+		raw = string(b)
+	} else if err := json.Unmarshal([]byte(raw), &obj); err != nil || obj == nil {
+		// null тоже не объект: VarsForDevice ждёт map
+		http.Error(w, "vars must be a JSON object", 400)
+		return
+	}
+	dev.Vars = []byte(raw)
+	if err := h.d.DB.Save(&dev).Error; err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if _, _, err := h.d.REC.Reconcile(r.Context(), dev.UUID); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	http.Redirect(w, r, "/admin/devices/"+dev.UUID, http.StatusFound)
+}
+
 func (h *Handler) APISecretIssue(w http.ResponseWriter, r *http.Request) {
 	uuid := mux.Vars(r)["uuid"]
 	var dev models.Device
@@ -234,10 +347,27 @@ func (h *Handler) APITemplateCreate(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid JSON", 400)
 		return
 	}
+	schema, err := formVarsSchema(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	t.VarsSchema = schema
+	formInheritance(r, &t)
+	if err := h.checkInheritance(r.Context(), t); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	t.Default = r.FormValue("default") != ""
+	t.Required = r.FormValue("required") != ""
 	if err := h.d.DB.Create(&t).Error; err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
+	// Required сразу действует на все устройства
+	if t.Required {
+		h.reconcileTemplateDevices(r.Context(), t)
+	}
 	http.Redirect(w, r, "/admin/templates", http.StatusFound)
 }
 
@@ -261,21 +391,77 @@ func (h *Handler) APITemplateUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	t.NetJSON = []byte(nj)
+	schema, err := formVarsSchema(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	t.VarsSchema = schema
+	formInheritance(r, &t)
+	if err := h.checkInheritance(r.Context(), t); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	t.Default = r.FormValue("default") != ""
+	wasRequired := t.Required
+	t.Required = r.FormValue("required") != ""
 	if err := h.d.DB.Save(&t).Error; err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
+	// смена Required меняет набор шаблонов у всех устройств
+	if wasRequired != t.Required {
+		all := t
+		all.Required = true
+		h.reconcileTemplateDevices(r.Context(), all)
+	}
 	http.Redirect(w, r, "/admin/templates", http.StatusFound)
 }
 
 func (h *Handler) APITemplateDelete(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(mux.Vars(r)["id"])
-	_ = h.d.DB.Delete(&models.ConfigTemplate{}, id).Error
+	var t models.ConfigTemplate
+	if err := h.d.DB.First(&t, id).Error; err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	// шаблон-родитель или include удалять нельзя, пока на него ссылаются
+	users, err := h.templateUsers(r.Context(), t.Name)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if len(users) > 0 {
+		http.Error(w, fmt.Sprintf("template %s is used by %s", t.Name, strings.Join(users, ", ")), 409)
+		return
+	}
+	affected, err := h.d.TS.DevicesForTemplate(r.Context(), t)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if err := h.d.TS.Delete(r.Context(), t.ID); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.reconcileDevices(r.Context(), affected)
 	http.Redirect(w, r, "/admin/templates", http.StatusFound)
 }
 
 // ---------- utils ----------
 
+// formVarsSchema — поле vars_schema формы шаблона: пусто — без схемы, иначе должна разбираться ParseSchema.
+func formVarsSchema(r *http.Request) ([]byte, error) {
+	raw := strings.TrimSpace(r.FormValue("vars_schema"))
+	if raw == "" {
+		return nil, nil
+	}
+	if _, err := rnetjson.ParseSchema([]byte(raw)); err != nil {
+		return nil, err
+	}
+	return []byte(raw), nil
+}
+
 func writeJSON(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(v)
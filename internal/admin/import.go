@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"wisp/internal/models"
+	"wisp/internal/render/uci"
+)
+
+const maxImportSize = 8 << 20
+
+// APIImport — POST /admin/api/import (multipart).
+// file: tar.gz с etc/config/* или одиночный UCI-файл (имя пакета — поле package или имя файла).
+// target=template → новый ConfigTemplate (name, priority); target=device → Device.DesiredConfig (uuid).
+func (h *Handler) APIImport(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		http.Error(w, "bad form", 400)
+		return
+	}
+	f, hdr, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file required", 400)
+		return
+	}
+	defer f.Close()
+
+	pkgName := strings.TrimSpace(r.FormValue("package"))
+	if pkgName == "" {
+		pkgName = path.Base(hdr.Filename)
+	}
+	pkgs, err := parseUpload(io.LimitReader(f, maxImportSize), pkgName)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	nj, err := uci.Import(pkgs)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	raw, _ := json.Marshal(nj)
+
+	switch r.FormValue("target") {
+	case "device":
+		uuid := r.FormValue("uuid")
+		var dev models.Device
+		if err := h.d.DB.Where("uuid=?", uuid).First(&dev).Error; err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		dev.DesiredConfig = raw
+		if err := h.d.DB.Save(&dev).Error; err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		if _, _, err := h.d.REC.Reconcile(r.Context(), dev.UUID); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		http.Redirect(w, r, "/admin/devices/"+dev.UUID, http.StatusFound)
+	default:
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" {
+			name = "imported-" + strings.TrimSuffix(path.Base(hdr.Filename), ".tar.gz")
+		}
+		prio, err := strconv.Atoi(r.FormValue("priority"))
+		if err != nil {
+			prio = 100
+		}
+		t := models.ConfigTemplate{Name: name, Priority: prio, NetJSON: raw}
+		if err := h.d.DB.Create(&t).Error; err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/admin/templates/%d/edit", t.ID), http.StatusFound)
+	}
+}
+
+// parseUpload распознаёт tar.gz по gzip-магии, иначе считает вход одиночным UCI-файлом.
+func parseUpload(r io.Reader, pkgName string) ([]*uci.Package, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		p, err := uci.Parse(pkgName, br)
+		if err != nil {
+			return nil, err
+		}
+		return []*uci.Package{p}, nil
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	var pkgs []*uci.Package
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// берём только etc/config/<pkg> (или голые файлы в корне архива)
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if dir := path.Dir(name); dir != "etc/config" && dir != "." {
+			continue
+		}
+		p, err := uci.Parse(path.Base(name), tr)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, p)
+	}
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("archive has no etc/config files")
+	}
+	return pkgs, nil
+}
@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"wisp/internal/models"
+	rnetjson "wisp/internal/render/netjson"
+	"wisp/internal/repo"
+)
+
+// formInheritance — поля parent и includes (имена через запятую или пробел) формы шаблона.
+func formInheritance(r *http.Request, t *models.ConfigTemplate) {
+	t.Parent = strings.TrimSpace(r.FormValue("parent"))
+	names := strings.FieldsFunc(r.FormValue("includes"), func(c rune) bool { return c == ',' || c == ' ' || c == '\n' })
+	t.Includes = nil
+	if len(names) > 0 {
+		t.Includes, _ = json.Marshal(names)
+	}
+}
+
+// checkInheritance разворачивает все шаблоны так, как будто t уже сохранён: ловит циклы,
+// неизвестные имена и ссылки на старое имя t после переименования.
+func (h *Handler) checkInheritance(ctx context.Context, t models.ConfigTemplate) error {
+	var all []models.ConfigTemplate
+	if err := h.d.DB.WithContext(ctx).Find(&all).Error; err != nil {
+		return err
+	}
+	byName := map[string]models.ConfigTemplate{t.Name: t}
+	for _, x := range all {
+		if x.ID != t.ID || t.ID == 0 {
+			if _, ok := byName[x.Name]; !ok {
+				byName[x.Name] = x
+			}
+		}
+	}
+	lookup := func(name string) (models.ConfigTemplate, bool) {
+		x, ok := byName[name]
+		return x, ok
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := repo.ExpandTemplate(byName[name], lookup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templateUsers — шаблоны, у которых name — родитель или include.
+func (h *Handler) templateUsers(ctx context.Context, name string) ([]string, error) {
+	var all []models.ConfigTemplate
+	if err := h.d.DB.WithContext(ctx).Order("name asc").Find(&all).Error; err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, t := range all {
+		incl, _ := repo.TemplateIncludes(t)
+		if t.Parent == name || slices.Contains(incl, name) {
+			out = append(out, t.Name)
+		}
+	}
+	return out, nil
+}
+
+// expandedTemplate — развёртка t для страницы шаблона: части по порядку и слитый NetJSON
+// с источником каждого значения (переменные и $if не вычисляются).
+func (h *Handler) expandedTemplate(ctx context.Context, t models.ConfigTemplate) ([]repo.TemplatePart, []annotatedLine, error) {
+	parts, err := h.d.TS.Expand(ctx, []models.ConfigTemplate{t})
+	if err != nil {
+		return nil, nil, err
+	}
+	sources := make([]rnetjson.Source, 0, len(parts))
+	for _, p := range parts {
+		m, err := repo.DecodeNetJSON(p.Template)
+		if err != nil {
+			return nil, nil, fmt.Errorf("template %s: %w", p.Template.Name, err)
+		}
+		sources = append(sources, rnetjson.Source{Name: p.Name(), Priority: p.Priority, JSON: m})
+	}
+	merged, prov, err := rnetjson.MergeWithProvenance(sources...)
+	if err != nil {
+		return nil, nil, err
+	}
+	var lines []annotatedLine
+	annotate(&lines, merged, prov, "", "", 0, false)
+	return parts, lines, nil
+}
@@ -0,0 +1,96 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"wisp/internal/models"
+	rnetjson "wisp/internal/render/netjson"
+)
+
+// DeviceNetJSONView — GET /admin/devices/{uuid}/netjson: итоговый NetJSON устройства (шаблоны,
+// DesiredConfig, переменные — без VPN-оверлеев) с источником каждого значения.
+// ?format=json — {"netjson": {...}, "provenance": {"/pointer": {"source", "priority", "var"}}, "errors": [...]}.
+func (h *Handler) DeviceNetJSONView(w http.ResponseWriter, r *http.Request) {
+	var dev models.Device
+	if err := h.d.DB.Where("uuid=?", mux.Vars(r)["uuid"]).First(&dev).Error; err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	// ошибки переменных не мешают показу: их и ищут на этой странице
+	nj, prov, err := h.d.REC.Desired(r.Context(), &dev)
+	var verrs rnetjson.VarErrors
+	if err != nil && !errors.As(err, &verrs) {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if r.URL.Query().Get("format") == "json" {
+		writeJSON(w, map[string]any{"netjson": nj, "provenance": prov, "errors": verrs})
+		return
+	}
+	var lines []annotatedLine
+	annotate(&lines, nj, prov, "", "", 0, false)
+	h.render(w, "device_netjson.tmpl", map[string]any{
+		"Title":  "NetJSON " + dev.UUID,
+		"Dev":    dev,
+		"Lines":  lines,
+		"Errors": verrs,
+	})
+}
+
+// annotatedLine — строка JSON с отступом и источником значения (для скаляров).
+type annotatedLine struct {
+	Text   string
+	Origin *rnetjson.Origin
+}
+
+// annotate печатает v как JSON с отступом в 2 пробела, ключи по алфавиту; prefix — `"key": `.
+func annotate(out *[]annotatedLine, v any, prov rnetjson.Provenance, ptr, prefix string, depth int, comma bool) {
+	pad := strings.Repeat("  ", depth)
+	tail := ""
+	if comma {
+		tail = ","
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		if len(t) == 0 {
+			*out = append(*out, annotatedLine{Text: pad + prefix + "{}" + tail})
+			return
+		}
+		*out = append(*out, annotatedLine{Text: pad + prefix + "{"})
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			kj, _ := json.Marshal(k)
+			p := ptr + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(k)
+			annotate(out, t[k], prov, p, string(kj)+": ", depth+1, i < len(keys)-1)
+		}
+		*out = append(*out, annotatedLine{Text: pad + "}" + tail})
+	case []any:
+		if len(t) == 0 {
+			*out = append(*out, annotatedLine{Text: pad + prefix + "[]" + tail})
+			return
+		}
+		*out = append(*out, annotatedLine{Text: pad + prefix + "["})
+		for i, x := range t {
+			annotate(out, x, prov, fmt.Sprintf("%s/%d", ptr, i), "", depth+1, i < len(t)-1)
+		}
+		*out = append(*out, annotatedLine{Text: pad + "]" + tail})
+	default:
+		vj, _ := json.Marshal(t)
+		line := annotatedLine{Text: pad + prefix + string(vj) + tail}
+		if o, ok := prov[ptr]; ok {
+			line.Origin = &o
+		}
+		*out = append(*out, line)
+	}
+}
@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"wisp/internal/models"
+	"wisp/internal/render/backend"
+	rnetjson "wisp/internal/render/netjson"
+	"wisp/internal/render/uci"
+	"wisp/internal/repo"
+)
+
+// APITemplateValidate — POST /admin/api/templates/validate: строгий рендер NetJSON без сохранения.
+// netjson — текст шаблона; uuid (опционально) — подставить переменные устройства (строго, ошибки
+// переменных и условий $if — в том же списке) и взять его backend, как при reconcile; без uuid — backend из поля backend
+// (по умолчанию openwrt), а в $if видны только backend и default схем. vars_schema (опционально) — VarsSchema
+// шаблона: проверяется сама схема и, с uuid, переменные устройства по ней (пути vars/...); default
+// схем подставляются в переменные, как при reconcile.
+// parent и includes — как в форме шаблона: шаблон проверяется развёрнутым.
+// Ответ: {"ok": bool, "errors": [{"path": "/wireless/interfaces/0", "msg": "..."}]}.
+func (h *Handler) APITemplateValidate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(1 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		http.Error(w, "bad form", 400)
+		return
+	}
+	var nj map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(r.FormValue("netjson"))), &nj); err != nil {
+		writeJSON(w, validationResult(&uci.ValidationError{Msg: "invalid JSON: " + err.Error()}))
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("backend"))
+	if name == "" {
+		name = backend.Default
+	}
+	be, err := backend.Get(name)
+	if err != nil {
+		writeJSON(w, validationResult(err))
+		return
+	}
+	// без устройства в $if доступна только переменная backend
+	vars := map[string]any{"backend": be.Name}
+	uuid := strings.TrimSpace(r.FormValue("uuid"))
+	if uuid != "" {
+		var dev models.Device
+		if err := h.d.DB.Where("uuid=?", uuid).First(&dev).Error; err != nil {
+			http.Error(w, "device not found", 404)
+			return
+		}
+		be = backend.ForModel(dev.Model)
+		if vars, err = h.d.TS.VarsForDevice(r.Context(), &dev); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	// родитель и includes из формы — перед самим шаблоном (он последняя часть развёртки)
+	tpl := models.ConfigTemplate{Name: strings.TrimSpace(r.FormValue("name"))}
+	if tpl.Name == "" {
+		tpl.Name = "template"
+	}
+	formInheritance(r, &tpl)
+	tpl.VarsSchema = []byte(r.FormValue("vars_schema"))
+	parts, err := h.d.TS.Expand(r.Context(), []models.ConfigTemplate{tpl})
+	if err != nil {
+		writeJSON(w, validationResult(err))
+		return
+	}
+	// default из схем (и из vars_schema формы) — как в reconcile, до $if
+	if vars, err = repo.VarsWithDefaults(parts, vars); err != nil {
+		writeJSON(w, validationResult(&uci.ValidationError{Path: "vars_schema", Msg: err.Error()}))
+		return
+	}
+	// $if — до слияния, по каждой части, как в reconcile; ошибки условий шаблона — вместе с остальными
+	var condErr error
+	sources := make([]rnetjson.Source, 0, len(parts))
+	for _, p := range parts[:len(parts)-1] {
+		m, err := repo.DecodeNetJSON(p.Template)
+		if err == nil {
+			m, err = rnetjson.EvalConditions(m, vars)
+		}
+		if err != nil {
+			writeJSON(w, validationResult(fmt.Errorf("template %s: %v", p.Template.Name, err)))
+			return
+		}
+		sources = append(sources, rnetjson.Source{Name: p.Name(), JSON: m})
+	}
+	nj, condErr = rnetjson.EvalConditions(nj, vars)
+	sources = append(sources, rnetjson.Source{Name: tpl.Name, JSON: nj})
+	// проверить и снять $merge, как при слиянии шаблонов
+	nj, err = rnetjson.Merge(sources...)
+	if err != nil {
+		writeJSON(w, validationResult(condErr, &uci.ValidationError{Path: "/" + rnetjson.MergeKey, Msg: err.Error()}))
+		return
+	}
+	schema, err := rnetjson.ParseSchema([]byte(r.FormValue("vars_schema")))
+	if err != nil {
+		writeJSON(w, validationResult(condErr, &uci.ValidationError{Path: "vars_schema", Msg: err.Error()}))
+		return
+	}
+	var varErr, schemaErr error
+	if uuid != "" {
+		// ошибки переменных показываем вместе с ошибками рендера
+		nj, varErr = rnetjson.ApplyVarsWith(nj, vars, rnetjson.VarsOptions{Strict: true, SecretKey: h.d.REC.SecretKey()})
+		if schema != nil {
+			if errs := schema.Validate(vars); len(errs) > 0 {
+				for _, e := range errs {
+					e.Path = "vars" + e.Path
+				}
+				schemaErr = errs
+			}
+		}
+	}
+	_, err = be.Render(nj, uci.Options{Strict: true})
+	writeJSON(w, validationResult(condErr, schemaErr, varErr, err))
+}
+
+// validationResult — ошибки переменных и рендера одним списком; nil пропускаются.
+func validationResult(list ...error) map[string]any {
+	errs := []*uci.ValidationError{}
+	for _, err := range list {
+		var ves uci.ValidationErrors
+		var ve *uci.ValidationError
+		var vars rnetjson.VarErrors
+		switch {
+		case err == nil:
+		case errors.As(err, &ves):
+			errs = append(errs, ves...)
+		case errors.As(err, &ve):
+			errs = append(errs, ve)
+		case errors.As(err, &vars):
+			for _, e := range vars {
+				errs = append(errs, &uci.ValidationError{Path: e.Path, Msg: e.Msg})
+			}
+		default:
+			errs = append(errs, &uci.ValidationError{Msg: err.Error()})
+		}
+	}
+	return map[string]any{"ok": len(errs) == 0, "errors": errs}
+}
@@ -0,0 +1,169 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"wisp/internal/models"
+	rnetjson "wisp/internal/render/netjson"
+	"wisp/internal/repo"
+)
+
+// varField — поле формы переменных устройства по VarsSchema шаблонов (только верхний уровень).
+type varField struct {
+	Name        string
+	Title       string
+	Description string
+	Template    string // шаблон, чья схема описала переменную (первый по приоритету)
+	Kind        string // text, number, bool, select, json
+	Value       string // текущее значение (или default схемы), для json/select — текст JSON
+	Checked     bool
+	Options     []varOption
+	Required    bool
+}
+
+type varOption struct {
+	Value, Label string
+	Selected     bool
+}
+
+// varFields строит поля формы; vars — текущие Device.Vars. Встроенные переменные пропускаются.
+func varFields(tpls []models.ConfigTemplate, vars map[string]any) ([]varField, error) {
+	var out []varField
+	seen := map[string]bool{}
+	for _, name := range repo.BuiltinVars {
+		seen[name] = true
+	}
+	for _, t := range tpls {
+		s, err := rnetjson.ParseSchema(t.VarsSchema)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", t.Name, err)
+		}
+		if s == nil {
+			continue
+		}
+		required := map[string]bool{}
+		for _, name := range s.Required {
+			required[name] = true
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			out = append(out, newVarField(name, t.Name, s.Properties[name], required[name], vars))
+		}
+	}
+	return out, nil
+}
+
+func newVarField(name, tpl string, s *rnetjson.Schema, required bool, vars map[string]any) varField {
+	f := varField{Name: name, Title: s.Title, Description: s.Description, Template: tpl, Required: required}
+	if f.Title == "" {
+		f.Title = name
+	}
+	v, ok := vars[name]
+	if !ok {
+		v = s.Default
+	}
+	switch {
+	case len(s.Enum) > 0:
+		f.Kind = "select"
+		cur, _ := json.Marshal(v)
+		for _, e := range s.Enum {
+			b, _ := json.Marshal(e)
+			label := string(b)
+			if str, ok := e.(string); ok {
+				label = str
+			}
+			f.Options = append(f.Options, varOption{Value: string(b), Label: label, Selected: v != nil && string(b) == string(cur)})
+		}
+		return f
+	case len(s.Types) == 1 && s.Types[0] == "boolean":
+		f.Kind = "bool"
+		f.Checked, _ = v.(bool)
+		return f
+	case len(s.Types) == 1 && (s.Types[0] == "integer" || s.Types[0] == "number"):
+		f.Kind = "number"
+	case len(s.Types) == 1 && s.Types[0] == "string":
+		f.Kind = "text"
+	default:
+		f.Kind = "json"
+	}
+	switch t := v.(type) {
+	case nil:
+	case string:
+		if f.Kind == "json" {
+			b, _ := json.Marshal(t)
+			f.Value = string(b)
+		} else {
+			f.Value = t
+		}
+	case float64:
+		f.Value = strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		b, _ := json.Marshal(t)
+		f.Value = string(b)
+	}
+	return f
+}
+
+// deviceSchemaTemplates — шаблоны устройства с родителями и includes: по их VarsSchema строится форма.
+func (h *Handler) deviceSchemaTemplates(ctx context.Context, dev *models.Device) ([]models.ConfigTemplate, error) {
+	tpls, err := h.d.TS.ListForDevice(ctx, dev.ID)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := h.d.TS.Expand(ctx, tpls)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]models.ConfigTemplate, len(parts))
+	for i, p := range parts {
+		out[i] = p.Template
+	}
+	return out, nil
+}
+
+// formVars переносит поля формы (var.<имя>) в vars: пустое поле удаляет переменную,
+// остальные переменные (не из схем) не трогаются.
+func formVars(r *http.Request, fields []varField, vars map[string]any) error {
+	for _, f := range fields {
+		raw := strings.TrimSpace(r.FormValue("var." + f.Name))
+		if f.Kind == "bool" {
+			vars[f.Name] = raw != ""
+			continue
+		}
+		if raw == "" {
+			delete(vars, f.Name)
+			continue
+		}
+		switch f.Kind {
+		case "text":
+			vars[f.Name] = raw
+		case "number":
+			n, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a number", f.Name, raw)
+			}
+			vars[f.Name] = n
+		default:
+			var v any
+			if err := json.Unmarshal([]byte(raw), &v); err != nil {
+				return fmt.Errorf("%s: invalid JSON: %v", f.Name, err)
+			}
+			vars[f.Name] = v
+		}
+	}
+	return nil
+}
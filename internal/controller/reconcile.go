@@ -2,18 +2,21 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"time"
 
 	"wisp/config"
+	"wisp/internal/logs"
 	"wisp/internal/models"
 	"wisp/internal/pki"
+	"wisp/internal/render/backend"
 	rnetjson "wisp/internal/render/netjson" // ← добавили алиас
 	"wisp/internal/render/uci"
 	"wisp/internal/repo"
-	"wisp/internal/tarball"
 	"wisp/internal/vpn/wireguard"
 )
 
@@ -25,9 +28,13 @@ type DeviceRepo interface {
 }
 type Templates interface {
 	ListForDevice(ctx context.Context, deviceID uint) ([]models.ConfigTemplate, error)
+	Expand(ctx context.Context, tpls []models.ConfigTemplate) ([]repo.TemplatePart, error)
 	VarsForDevice(ctx context.Context, dev *models.Device) (map[string]any, error)
 }
 
+// deviceOverridePriority — приоритет Device.DesiredConfig: выше любого шаблона.
+const deviceOverridePriority = 1 << 30
+
 type Reconciler struct {
 	Devices   DeviceRepo
 	Templates Templates
@@ -45,38 +52,18 @@ func (r *Reconciler) Reconcile(ctx context.Context, uuid string) (checksum strin
 		return "", false, err
 	}
 
-	// 1) merge NetJSON шаблонов
-	tpls, err := r.Templates.ListForDevice(ctx, dev.ID)
-	if err != nil {
-		return "", false, err
-	}
-	sources := make([]rnetjson.Source, 0, len(tpls)+1)
-	for _, t := range tpls {
-		m, err := repo.DecodeNetJSON(t)
-		if err != nil {
-			return "", false, err
-		}
-		sources = append(sources, rnetjson.Source{Name: t.Name, Priority: t.Priority, JSON: m})
-	}
-	merged, err := rnetjson.Merge(sources...)
-	if err != nil {
-		return "", false, err
-	}
-
-	// 2) vars
-	vars, err := r.Templates.VarsForDevice(ctx, dev)
-	if err != nil {
-		return "", false, err
-	}
-	merged, err = rnetjson.ApplyVars(merged, vars)
+	// 1) merge NetJSON шаблонов + 2) vars; неразрешённые плейсхолдеры не публикуем
+	merged, _, err := r.Desired(ctx, dev)
 	if err != nil {
-		return "", false, err
+		return "", false, fmt.Errorf("device %s: %w", dev.UUID, err)
 	}
 
 	// 3) VPN/PKI overlays + extra files
 	extra := map[string][]byte{}
 	const ifaceWG = "wg0"
 
+	be := backend.ForModel(dev.Model)
+
 	switch strings.ToLower(r.Cfg.OpenWISP.Controller.MgmtVPN.Mode) {
 	case "wireguard":
 		overlay, err := r.overlayWireGuard(ctx, dev)
@@ -87,8 +74,8 @@ func (r *Reconciler) Reconcile(ctx context.Context, uuid string) (checksum strin
 			rnetjson.Source{Name: "base", Priority: 10, JSON: merged},
 			rnetjson.Source{Name: "wg", Priority: 999, JSON: overlay},
 		)
-		// (опционально) сгенерить wg0.conf
-		if conf := buildWGConf(overlay); conf != nil {
+		// (опционально) сгенерить wg0.conf; single-file backend (RouterOS) поднимает wg сам
+		if conf := buildWGConf(overlay); conf != nil && be.Single == "" {
 			extra["etc/wireguard/wg0.conf"] = conf
 		}
 
@@ -98,7 +85,12 @@ func (r *Reconciler) Reconcile(ctx context.Context, uuid string) (checksum strin
 			rnetjson.Source{Name: "base", Priority: 10, JSON: merged},
 			rnetjson.Source{Name: "ovpn", Priority: 999, JSON: overlay},
 		)
-		// PKI: выпустим сертификат и сложим файлы
+		// PKI: выпустим сертификат и сложим файлы; single-file backend (RouterOS) лишних файлов
+		// не принимает — сертификаты туда не кладём, как и wg0.conf
+		if be.Single != "" {
+			logs.Logger.Warnf("reconcile %s: openvpn client files are not delivered with %s backend", dev.UUID, be.Name)
+			break
+		}
 		caTTL, _ := time.ParseDuration(zeroIfEmpty(r.Cfg.OpenWISP.Controller.PKI.CertTTL, "8760h"))
 		ca, err := r.PKI.EnsureRootCA(ctx, zeroIfEmpty(r.Cfg.OpenWISP.Controller.PKI.CAName, "OpenWISP-Go-CA"), caTTL)
 		if err != nil {
@@ -121,12 +113,20 @@ func (r *Reconciler) Reconcile(ctx context.Context, uuid string) (checksum strin
 		)
 	}
 
-	// 4) UCI → tar.gz
-	files, err := uci.RenderAll(merged, uci.Options{DeviceHostname: dev.Name})
-	if err != nil {
+	// 4) backend (UCI, networkd или RouterOS, по модели) → tar.gz / скрипт
+	files, err := be.Render(merged, uci.Options{
+		DeviceHostname: dev.Name,
+		DeviceUUID:     dev.UUID,
+		SwitchMode:     switchModeFor(r.Cfg, dev.HardwareModel),
+		Strict:         r.Cfg.OpenWISP.Controller.Render.Strict,
+	})
+	var unclaimed *uci.UnclaimedKeysError
+	if errors.As(err, &unclaimed) {
+		logs.Logger.Warnf("reconcile %s (%s): %v", dev.UUID, be.Name, err)
+	} else if err != nil {
 		return "", false, err
 	}
-	tarGz, sum, err := tarball.Build(files, extra)
+	payload, sum, err := be.Package(files, extra)
 	if err != nil {
 		return "", false, err
 	}
@@ -138,12 +138,128 @@ func (r *Reconciler) Reconcile(ctx context.Context, uuid string) (checksum strin
 	if ver <= 0 {
 		ver = 1
 	}
-	if err := r.Devices.PutConfigTar(ctx, uuid, tarGz, ver); err != nil {
+	if err := r.Devices.PutConfigTar(ctx, uuid, payload, ver); err != nil {
 		return "", false, err
 	}
 	return sum, true, nil
 }
 
+// Desired — NetJSON устройства до VPN-оверлеев: шаблоны по приоритету (каждый развёрнут с
+// родителем и includes, см. repo.ExpandTemplate), поверх них Device.DesiredConfig (секции
+// с ложным $if отброшены до слияния), затем переменные (строго).
+// prov — какой источник задал каждое значение.
+// При неразрешённых переменных и нарушениях VarsSchema шаблонов возвращается rnetjson.VarErrors
+// вместе с NetJSON и prov — для показа в админке; Reconcile такой конфиг не публикует.
+func (r *Reconciler) Desired(ctx context.Context, dev *models.Device) (map[string]any, rnetjson.Provenance, error) {
+	tpls, err := r.Templates.ListForDevice(ctx, dev.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	vars, err := r.Templates.VarsForDevice(ctx, dev)
+	if err != nil {
+		return nil, nil, err
+	}
+	// родители и includes — отдельными источниками перед самим шаблоном, с его priority
+	parts, err := r.Templates.Expand(ctx, tpls)
+	if err != nil {
+		return nil, nil, err
+	}
+	// default из VarsSchema — до $if и подстановки: переменная со значением по умолчанию не «пропущена»
+	if vars, err = repo.VarsWithDefaults(parts, vars); err != nil {
+		return nil, nil, err
+	}
+	// $if вычисляется по каждому источнику до слияния; ошибки условий (секция с ошибкой
+	// выброшена) копятся вместе с ошибками переменных, в тексте — имя источника
+	var verrs rnetjson.VarErrors
+	sources := make([]rnetjson.Source, 0, len(tpls)+1)
+	add := func(name string, prio int, m map[string]any) error {
+		m, err := rnetjson.EvalConditions(m, vars)
+		var cerrs rnetjson.VarErrors
+		if errors.As(err, &cerrs) {
+			for _, e := range cerrs {
+				verrs = append(verrs, &rnetjson.VarError{Path: e.Path, Msg: fmt.Sprintf("template %s: %s", name, e.Msg)})
+			}
+		} else if err != nil {
+			return fmt.Errorf("template %s: %w", name, err)
+		}
+		sources = append(sources, rnetjson.Source{Name: name, Priority: prio, JSON: m})
+		return nil
+	}
+	for _, p := range parts {
+		m, err := repo.DecodeNetJSON(p.Template)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := add(p.Name(), p.Priority, m); err != nil {
+			return nil, nil, err
+		}
+	}
+	// device-level override (DesiredConfig) — поверх всех шаблонов
+	if len(dev.DesiredConfig) > 0 {
+		var m map[string]any
+		if err := json.Unmarshal(dev.DesiredConfig, &m); err != nil {
+			return nil, nil, fmt.Errorf("device %s desired config: %w", dev.UUID, err)
+		}
+		if err := add("device", deviceOverridePriority, m); err != nil {
+			return nil, nil, err
+		}
+	}
+	merged, prov, err := rnetjson.MergeWithProvenance(sources...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged, err = rnetjson.ApplyVarsWith(merged, vars, rnetjson.VarsOptions{
+		Strict: true, Provenance: prov, SecretKey: r.SecretKey(),
+	})
+	var applyErrs rnetjson.VarErrors
+	if err != nil && !errors.As(err, &applyErrs) {
+		return nil, nil, err
+	}
+	schemaErrs, err := varsSchemaErrors(parts, vars)
+	if err != nil {
+		return nil, nil, err
+	}
+	verrs = append(append(verrs, schemaErrs...), applyErrs...)
+	if len(verrs) > 0 {
+		return merged, prov, verrs
+	}
+	return merged, prov, nil
+}
+
+// varsSchemaErrors проверяет переменные устройства по VarsSchema каждого шаблона (с родителями
+// и includes, каждый один раз); путь ошибки — vars/<переменная>, в тексте — имя шаблона.
+func varsSchemaErrors(parts []repo.TemplatePart, vars map[string]any) (rnetjson.VarErrors, error) {
+	var out rnetjson.VarErrors
+	seen := map[string]bool{}
+	for _, p := range parts {
+		t := p.Template
+		if seen[t.Name] {
+			continue
+		}
+		seen[t.Name] = true
+		s, err := rnetjson.ParseSchema(t.VarsSchema)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", t.Name, err)
+		}
+		if s == nil {
+			continue
+		}
+		for _, e := range s.Validate(vars) {
+			out = append(out, &rnetjson.VarError{Path: "vars" + e.Path, Msg: fmt.Sprintf("template %s: %s", t.Name, e.Msg)})
+		}
+	}
+	return out, nil
+}
+
+// SecretKey — ключ devicesecret в шаблонах: render.secret_key или, если не задан, shared_secret.
+func (r *Reconciler) SecretKey() []byte {
+	if k := r.Cfg.OpenWISP.Controller.Render.SecretKey; k != "" {
+		return []byte(k)
+	}
+	return []byte(r.Cfg.OpenWISP.SharedSecret)
+}
+
 // ---- overlays ----
 
 func (r *Reconciler) overlayWireGuard(ctx context.Context, dev *models.Device) (map[string]any, error) {
@@ -262,6 +378,18 @@ func buildWGConf(overlay map[string]any) []byte {
 	return []byte(b.String())
 }
 
+// switchModeFor — swconfig для моделей железа (Device.HardwareModel) из render.swconfig_models,
+// иначе DSA. Backend (Device.Model) на режим не влияет.
+func switchModeFor(cfg *config.Config, model string) string {
+	model = strings.ToLower(model)
+	for _, m := range cfg.OpenWISP.Controller.Render.SwconfigModels {
+		if m = strings.ToLower(strings.TrimSpace(m)); m != "" && strings.Contains(model, m) {
+			return uci.SwitchSwconfig
+		}
+	}
+	return uci.SwitchDSA
+}
+
 func zeroIfEmpty(v, def string) string {
 	if strings.TrimSpace(v) == "" {
 		return def
@@ -23,6 +23,8 @@ type Device struct {
 	Model string `gorm:"type:text"`
 	MAC   string `gorm:"type:text"`
 
+	HardwareModel string `gorm:"type:text"` // модель железа от агента ("TP-Link Archer C7 v5"); Model — backend
+
 	Fingerprint   string         `gorm:"type:text"`
 	Tags          datatypes.JSON `gorm:"type:json"`
 	Status        DeviceStatus   `gorm:"type:text;default:'unknown'"`
@@ -33,6 +35,7 @@ type Device struct {
 	ConfigVersion      int            `gorm:"default:0"`
 	ConfigChecksum     string         `gorm:"type:text"`
 	DesiredConfig      datatypes.JSON `gorm:"type:json"`
+	Vars               datatypes.JSON `gorm:"type:json"` // переменные устройства для ApplyVars (объект)
 	RenderedConfig     datatypes.JSON `gorm:"type:json"`
 	ConfigUpdatedAt    *time.Time
 	LastReportedStatus string `gorm:"type:text"`
@@ -13,5 +13,17 @@ type ConfigTemplate struct {
 	Priority             int            `gorm:"default:100"`
 	NetJSON              datatypes.JSON `gorm:"type:jsonb"`
 	VarsSchema           datatypes.JSON `gorm:"type:jsonb"`
+	Parent               string         // имя родительского шаблона (пусто — нет)
+	Includes             datatypes.JSON `gorm:"type:jsonb"`        // ["fw-base", ...] — имена подключаемых шаблонов
+	Default              bool           `gorm:"column:is_default"` // привязывается к новому устройству при /controller/register
+	Required             bool           // действует на все устройства, отвязать нельзя
 	CreatedAt, UpdatedAt time.Time
 }
+
+// DeviceTemplate — привязка шаблона к устройству (Required-шаблонам не нужна).
+type DeviceTemplate struct {
+	ID         uint `gorm:"primaryKey"`
+	DeviceID   uint `gorm:"uniqueIndex:device_template"`
+	TemplateID uint `gorm:"uniqueIndex:device_template;index"`
+	CreatedAt  time.Time
+}
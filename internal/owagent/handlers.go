@@ -12,6 +12,8 @@ import (
 	"strings"
 	"time"
 
+	"wisp/internal/logs"
+	"wisp/internal/render/backend"
 	"wisp/internal/repo"
 
 	"github.com/gorilla/mux"
@@ -21,17 +23,23 @@ type Reconciler interface {
 	Reconcile(ctx context.Context, uuid string) (checksum string, updated bool, err error)
 }
 
+// Templates — привязка Default-шаблонов к новому устройству.
+type Templates interface {
+	AssignDefaults(ctx context.Context, deviceID uint) error
+}
+
 // Handler теперь держит ссылку на Reconciler
 type Handler struct {
 	ds            *repo.DeviceStore
 	rec           Reconciler // ← добавили
+	ts            Templates
 	sharedSecret  string
 	consistentKey bool
 }
 
-// Конструктор теперь принимает rec
-func New(ds *repo.DeviceStore, sharedSecret string, consistentKey bool, rec Reconciler) *Handler {
-	return &Handler{ds: ds, sharedSecret: sharedSecret, consistentKey: consistentKey, rec: rec}
+// Конструктор теперь принимает rec и ts
+func New(ds *repo.DeviceStore, sharedSecret string, consistentKey bool, rec Reconciler, ts Templates) *Handler {
+	return &Handler{ds: ds, sharedSecret: sharedSecret, consistentKey: consistentKey, rec: rec, ts: ts}
 }
 
 // Вспомогательно: обязателен заголовок для агента
@@ -51,7 +59,9 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		ExpectedSecret: h.sharedSecret,
 		Name:           r.FormValue("name"),
 		Model:          r.FormValue("backend"), // ← Backend → Model
+		HardwareModel:  r.FormValue("model"),   // модель платы из ubus system board
 		MAC:            r.FormValue("mac_address"),
+		Tags:           strings.Fields(r.FormValue("tags")), // option tags агента, через пробел
 		KeyOptional:    r.FormValue("key"),
 		ConsistentKey:  h.consistentKey,
 	}
@@ -68,6 +78,13 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// новому устройству — Default-шаблоны (до первичного конфига)
+	if res.IsNew && h.ts != nil {
+		if err := h.ts.AssignDefaults(r.Context(), res.ID); err != nil {
+			logs.Logger.Errorf("register %s: assign default templates: %v", res.UUID, err)
+		}
+	}
+
 	// Сразу пробуем собрать первичный конфиг (best-effort)
 	if h.rec != nil {
 		_, _, _ = h.rec.Reconcile(r.Context(), res.UUID)
@@ -125,8 +142,14 @@ func (h *Handler) DownloadConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/gzip")
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.tar.gz"`, uuid, sum[:8]))
+	// tar.gz или, для single-file backend (RouterOS), сам скрипт
+	be, _ := backend.Get(backend.Default)
+	if dev, err := h.ds.GetByUUID(r.Context(), uuid); err == nil {
+		be = backend.ForModel(dev.Model)
+	}
+	name, ctype := be.Payload(uuid, sum)
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
 	if r.Method == http.MethodHead {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -0,0 +1,95 @@
+// Package backend выбирает, во что рендерится NetJSON устройства: UCI для OpenWrt,
+// systemd-networkd/nftables для Linux-шлюзов или скрипт RouterOS для MikroTik. Backend определяется по Device.Model —
+// туда /controller/register пишет поле backend агента ("netjsonconfig.OpenWrt", "networkd", ...).
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"wisp/internal/render/networkd"
+	"wisp/internal/render/routeros"
+	"wisp/internal/render/uci"
+	"wisp/internal/tarball"
+)
+
+// Backend — рендерер NetJSON в файлы конфигурации одной целевой ОС.
+// Результат упаковывает Package: tar.gz или, если задан Single, один файл как есть.
+type Backend struct {
+	Name    string   // "openwrt", "networkd", "routeros"
+	Aliases []string // подстроки Device.Model (без учёта регистра), выбирающие этот backend
+	Render  func(netjson map[string]any, opts uci.Options) ([]uci.File, error)
+	Single  string // имя единственного файла, который отдаётся без архива ("" — tar.gz)
+}
+
+// Default — backend для устройств без явного или с неизвестным backend.
+const Default = "openwrt"
+
+// builtin — в порядке проверки алиасов.
+var builtin = []Backend{
+	{Name: "openwrt", Aliases: []string{"openwrt", "lede"}, Render: uci.RenderAll},
+	{Name: "networkd", Aliases: []string{"networkd", "linux", "debian", "ubuntu"}, Render: networkd.Render},
+	{Name: "routeros", Aliases: []string{"routeros", "mikrotik"}, Render: routeros.Render, Single: routeros.ScriptName},
+}
+
+// Get — backend по точному имени.
+func Get(name string) (Backend, error) {
+	for _, b := range builtin {
+		if b.Name == name {
+			return b, nil
+		}
+	}
+	return Backend{}, fmt.Errorf("backend: unknown backend %q", name)
+}
+
+// ForModel — backend по Device.Model: первый, чей алиас входит в строку; иначе Default.
+func ForModel(model string) Backend {
+	model = strings.ToLower(model)
+	for _, b := range builtin {
+		for _, a := range b.Aliases {
+			if strings.Contains(model, a) {
+				return b
+			}
+		}
+	}
+	b, _ := Get(Default)
+	return b
+}
+
+// Names — имена встроенных backend (для флагов и подсказок).
+func Names() []string {
+	out := make([]string, len(builtin))
+	for i, b := range builtin {
+		out[i] = b.Name
+	}
+	return out
+}
+
+// Package упаковывает результат Render в payload для /owagent/download-config и его sha256.
+// extra — дополнительные файлы архива (wg0.conf, сертификаты); у single-file backend их быть не может.
+func (b Backend) Package(files []uci.File, extra map[string][]byte) ([]byte, string, error) {
+	if b.Single == "" {
+		return tarball.Build(files, extra)
+	}
+	if len(extra) > 0 {
+		return nil, "", fmt.Errorf("backend: %s: extra files are not supported", b.Name)
+	}
+	if len(files) != 1 || files[0].Name != b.Single {
+		return nil, "", fmt.Errorf("backend: %s: expected single file %s, got %d", b.Name, b.Single, len(files))
+	}
+	sum := sha256.Sum256(files[0].Data)
+	return files[0].Data, hex.EncodeToString(sum[:]), nil
+}
+
+// Payload — имя файла и Content-Type для отдачи payload устройству.
+func (b Backend) Payload(uuid, sum string) (filename, contentType string) {
+	if len(sum) > 8 {
+		sum = sum[:8]
+	}
+	if b.Single == "" {
+		return fmt.Sprintf("%s-%s.tar.gz", uuid, sum), "application/gzip"
+	}
+	return fmt.Sprintf("%s-%s-%s", uuid, sum, b.Single), "text/plain; charset=utf-8"
+}
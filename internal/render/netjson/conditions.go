@@ -0,0 +1,95 @@
+package netjson
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// IfKey — условие секции шаблона: объект с "$if" остаётся, только если условие истинно,
+// иначе выбрасывается целиком (ключ из родителя или элемент из массива):
+//
+//	"wireless": {"$if": "hasprefix \"ubnt,\" .hardware_model", "radios": [...]}
+//	{"$if": "and (has .tags \"outdoor\") (eq .backend \"openwrt\")", "name": "mesh", ...}
+//
+// Условие — выражение Go template над переменными устройства (как внутри {{if ...}}, с функциями
+// из funcs.go) или true/false. Отсутствующая переменная — пустое значение: строковые проверки,
+// has/haskey, eq/ne и not с ней не падают; lt/gt и сетевые функции требуют значения (или default).
+// EvalConditions вызывается для каждого источника до Merge: ложная секция не участвует в слиянии.
+const IfKey = "$if"
+
+// EvalConditions вычисляет все $if в nj; результат не содержит $if. Ошибки выражений —
+// VarErrors с путём до $if (секция с ошибкой выбрасывается).
+func EvalConditions(nj map[string]any, vars map[string]any) (map[string]any, error) {
+	a := &varApplier{vars: vars, strict: true}
+	res, keep := a.conditions("", cloneMap(nj))
+	out, _ := res.(map[string]any)
+	if !keep || out == nil {
+		out = map[string]any{}
+	}
+	if len(a.errs) > 0 {
+		sort.SliceStable(a.errs, func(i, j int) bool { return a.errs[i].Path < a.errs[j].Path })
+		return out, a.errs
+	}
+	return out, nil
+}
+
+func (a *varApplier) conditions(ptr string, x any) (any, bool) {
+	switch t := x.(type) {
+	case map[string]any:
+		if raw, ok := t[IfKey]; ok {
+			ok, err := a.cond(raw)
+			if err != nil {
+				a.fail(ptr+"/"+escapePointer(IfKey), "%v", err)
+				return nil, false
+			}
+			if !ok {
+				return nil, false
+			}
+		}
+		y := make(map[string]any, len(t))
+		for k, v := range t {
+			if k == IfKey {
+				continue
+			}
+			if v, keep := a.conditions(ptr+"/"+escapePointer(k), v); keep {
+				y[k] = v
+			}
+		}
+		return y, true
+	case []any:
+		y := make([]any, 0, len(t))
+		for i, v := range t {
+			if v, keep := a.conditions(fmt.Sprintf("%s/%d", ptr, i), v); keep {
+				y = append(y, v)
+			}
+		}
+		return y, true
+	}
+	return x, true
+}
+
+// cond — значение $if: bool или выражение шаблона.
+func (a *varApplier) cond(raw any) (bool, error) {
+	switch t := raw.(type) {
+	case bool:
+		return t, nil
+	case string:
+		expr := strings.TrimSpace(t)
+		if expr == "" || strings.Contains(expr, "{{") || strings.Contains(expr, "}}") {
+			return false, fmt.Errorf("bad condition %q: expected an expression without {{ }}", t)
+		}
+		tpl, err := template.New("if").Funcs(a.funcs()).Option("missingkey=zero").Parse("{{if " + expr + "}}1{{end}}")
+		if err != nil {
+			return false, err
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, a.vars); err != nil {
+			return false, err
+		}
+		return buf.String() == "1", nil
+	}
+	return false, fmt.Errorf("%s must be a string expression or a boolean", IfKey)
+}
@@ -0,0 +1,104 @@
+package netjson
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEvalConditions(t *testing.T) {
+	vars := map[string]any{
+		"hardware_model": "ubnt,unifi-6-lite",
+		"backend":        "openwrt",
+		"tags":           []any{"outdoor", "mesh"},
+		"vlan":           10.0,
+	}
+	for _, c := range []struct {
+		name string
+		in   string
+		out  string
+		errs []string // Path ошибок
+	}{
+		{
+			name: "map true",
+			in:   `{"wireless": {"$if": "hasprefix \"ubnt,\" .hardware_model", "radios": []}}`,
+			out:  `{"wireless": {"radios": []}}`,
+		},
+		{
+			name: "map false",
+			in:   `{"wireless": {"$if": "eq .backend \"routeros\"", "radios": []}, "general": {}}`,
+			out:  `{"general": {}}`,
+		},
+		{
+			name: "bool",
+			in:   `{"a": {"$if": true, "x": 1}, "b": {"$if": false, "x": 2}}`,
+			out:  `{"a": {"x": 1}}`,
+		},
+		{
+			name: "array items",
+			in: `{"interfaces": [
+				{"$if": "has .tags \"outdoor\"", "name": "mesh0"},
+				{"$if": "has .tags \"indoor\"", "name": "lan1"},
+				{"name": "lan0"},
+				{"$if": "and (has .tags \"mesh\") (gt .vlan 1.0)", "name": "vlan"}]}`,
+			out: `{"interfaces": [{"name": "mesh0"}, {"name": "lan0"}, {"name": "vlan"}]}`,
+		},
+		{
+			name: "nested",
+			in:   `{"a": {"$if": true, "b": {"$if": "not (eq .backend \"openwrt\")", "x": 1}, "c": [1, {"$if": false}]}}`,
+			out:  `{"a": {"c": [1]}}`,
+		},
+		{
+			name: "root false",
+			in:   `{"$if": false, "general": {}}`,
+			out:  `{}`,
+		},
+		{
+			name: "missing vars",
+			in: `{"a": {"$if": "hasprefix \"x\" .nope", "x": 1},
+				"b": {"$if": "not .nope", "x": 2},
+				"c": {"$if": "has .nope \"x\"", "x": 3},
+				"d": {"$if": "ne .nope \"openwrt\"", "x": 4},
+				"f": {"$if": "eq .nope \"openwrt\"", "x": 6},
+				"e": {"$if": ".nope", "x": 5}}`,
+			out: `{"b": {"x": 2}, "d": {"x": 4}}`,
+		},
+		{
+			name: "errors",
+			in: `{"a": {"$if": "lt .nope 5.0", "x": 1},
+				"b": [{"$if": "{{ true }}"}, {"$if": "nosuchfunc .model"}, {"$if": 1}],
+				"c": {"$if": "", "x": 3},
+				"d": {"$if": true, "x": 4}}`,
+			out:  `{"b": [], "d": {"x": 4}}`,
+			errs: []string{"/a/$if", "/b/0/$if", "/b/1/$if", "/b/2/$if", "/c/$if"},
+		},
+	} {
+		got, err := EvalConditions(decode(t, c.in), vars)
+		var paths []string
+		if err != nil {
+			var ve VarErrors
+			if !errors.As(err, &ve) {
+				t.Fatalf("%s: error %T, want VarErrors", c.name, err)
+			}
+			for _, e := range ve {
+				paths = append(paths, e.Path)
+			}
+		}
+		if !reflect.DeepEqual(paths, c.errs) {
+			t.Errorf("%s: errors at %v, want %v (%v)", c.name, paths, c.errs, err)
+		}
+		if want := decode(t, c.out); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\n got %s\nwant %s", c.name, jsonText(got), jsonText(want))
+		}
+	}
+}
+
+func TestEvalConditionsKeepsInput(t *testing.T) {
+	in := decode(t, `{"a": {"$if": false}, "b": [{"$if": true, "x": 1}]}`)
+	if _, err := EvalConditions(in, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := decode(t, `{"a": {"$if": false}, "b": [{"$if": true, "x": 1}]}`); !reflect.DeepEqual(in, want) {
+		t.Fatalf("input modified: %s", jsonText(in))
+	}
+}
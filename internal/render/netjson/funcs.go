@@ -0,0 +1,504 @@
+package netjson
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Функции шаблонов в строках NetJSON ({{ ... }}); данные — переменные устройства.
+//
+// Сети (IPv4 и IPv6, n может быть отрицательным — от конца сети, как в terraform):
+//
+//	cidrhost "10.0.0.0/24" 1          → 10.0.0.1
+//	cidrsubnet "10.0.0.0/16" 8 .site  → 10.0.<site>.0/24
+//	cidrnetmask "10.0.0.0/24"         → 255.255.255.0
+//	cidrip "10.0.0.1/24" / cidrlen    → 10.0.0.1 / 24
+//	ip6subnet "2001:db8:1::/56" 64 3  → 2001:db8:1:3::/64 (делегированный префикс → подсеть нужной длины)
+//	ip6host "2001:db8:1:3::/64" "::1" → 2001:db8:1:3::1 (идентификатор интерфейса — адрес или число)
+//	eui64 "2001:db8:1:3::/64" .mac    → SLAAC-адрес по MAC
+//
+// MAC: macadd .mac 1, macformat .mac "colon|dash|cisco|bare", maclocal .mac (locally administered).
+// Секреты: devicesecret "wifi" [длина] — HMAC-SHA256(ключ сервера, device_uuid + назначение) в base64url,
+// стабилен для устройства и назначения; sha256, b64enc, b64dec.
+// Числа: int, add, sub, mul, div, mod, min, max. Списки и словари: list, dict, split, first, last,
+// keys, haskey, has; строки: upper, lower, trim, replace, default, join; проверки (удобны в $if):
+// contains, hasprefix, hassuffix, match (regexp), glob ("ubnt,*") — образец первым, строка последней.
+var templateFuncs = template.FuncMap{
+	// строка-аргумент и списки/словари — any: отсутствующая переменная (nil) — пустое значение, не ошибка
+	"upper": func(s any) string { return strings.ToUpper(str(s)) },
+	"lower": func(s any) string { return strings.ToLower(str(s)) },
+	"trim":  func(s any) string { return strings.TrimSpace(str(s)) },
+	"replace": func(old, new string, s any) string {
+		return strings.ReplaceAll(str(s), old, new)
+	},
+	"contains":  func(sub string, s any) bool { return strings.Contains(str(s), sub) },
+	"hasprefix": func(prefix string, s any) bool { return strings.HasPrefix(str(s), prefix) },
+	"hassuffix": func(suffix string, s any) bool { return strings.HasSuffix(str(s), suffix) },
+	"match": func(pattern string, s any) (bool, error) {
+		return regexp.MatchString(pattern, str(s))
+	},
+	"glob": func(pattern string, s any) (bool, error) {
+		return path.Match(pattern, str(s))
+	},
+	"default": func(def any, val any) any {
+		if isZero(val) {
+			return def
+		}
+		return val
+	},
+	"join": func(a any, sep string) string {
+		list, _ := a.([]any)
+		parts := make([]string, 0, len(list))
+		for _, it := range list {
+			parts = append(parts, fmt.Sprint(it))
+		}
+		return strings.Join(parts, sep)
+	},
+
+	"cidrhost":    cidrHost,
+	"cidrsubnet":  cidrSubnet,
+	"cidrnetmask": cidrNetmask,
+	"cidrip":      cidrIP,
+	"cidrlen":     cidrLen,
+	"ip6subnet":   ip6Subnet,
+	"ip6host":     ip6Host,
+	"eui64":       eui64,
+
+	"macadd":    macAdd,
+	"macformat": macFormat,
+	"maclocal":  macLocal,
+
+	"sha256": func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+	"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec": func(s string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(s)
+		return string(b), err
+	},
+
+	"int": toInt,
+	"add": func(a, b any) (int, error) { return arith(a, b, func(x, y int) (int, error) { return x + y, nil }) },
+	"sub": func(a, b any) (int, error) { return arith(a, b, func(x, y int) (int, error) { return x - y, nil }) },
+	"mul": func(a, b any) (int, error) { return arith(a, b, func(x, y int) (int, error) { return x * y, nil }) },
+	"div": func(a, b any) (int, error) {
+		return arith(a, b, func(x, y int) (int, error) {
+			if y == 0 {
+				return 0, fmt.Errorf("div: division by zero")
+			}
+			return x / y, nil
+		})
+	},
+	"mod": func(a, b any) (int, error) {
+		return arith(a, b, func(x, y int) (int, error) {
+			if y == 0 {
+				return 0, fmt.Errorf("mod: division by zero")
+			}
+			return x % y, nil
+		})
+	},
+	"min": func(a, b any) (int, error) { return arith(a, b, func(x, y int) (int, error) { return min(x, y), nil }) },
+	"max": func(a, b any) (int, error) { return arith(a, b, func(x, y int) (int, error) { return max(x, y), nil }) },
+
+	"list": func(xs ...any) []any { return xs },
+	"dict": func(kv ...any) (map[string]any, error) {
+		if len(kv)%2 != 0 {
+			return nil, fmt.Errorf("dict: odd number of arguments")
+		}
+		m := make(map[string]any, len(kv)/2)
+		for i := 0; i < len(kv); i += 2 {
+			k, ok := kv[i].(string)
+			if !ok {
+				return nil, fmt.Errorf("dict: key %v is not a string", kv[i])
+			}
+			m[k] = kv[i+1]
+		}
+		return m, nil
+	},
+	"split": func(sep string, s any) []any {
+		parts := strings.Split(str(s), sep)
+		out := make([]any, len(parts))
+		for i, p := range parts {
+			out[i] = p
+		}
+		return out
+	},
+	"first": func(xs any) any {
+		list, _ := xs.([]any)
+		if len(list) == 0 {
+			return nil
+		}
+		return list[0]
+	},
+	"last": func(xs any) any {
+		list, _ := xs.([]any)
+		if len(list) == 0 {
+			return nil
+		}
+		return list[len(list)-1]
+	},
+	"keys": func(mv any) []any {
+		m, _ := mv.(map[string]any)
+		ks := make([]string, 0, len(m))
+		for k := range m {
+			ks = append(ks, k)
+		}
+		sort.Strings(ks)
+		out := make([]any, len(ks))
+		for i, k := range ks {
+			out[i] = k
+		}
+		return out
+	},
+	"haskey": func(m any, k string) bool {
+		mm, _ := m.(map[string]any)
+		_, ok := mm[k]
+		return ok
+	},
+	"has": func(xs any, x any) bool {
+		list, _ := xs.([]any)
+		for _, y := range list {
+			if fmt.Sprint(y) == fmt.Sprint(x) {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+// funcs — templateFuncs плюс devicesecret с ключом и device_uuid этого вызова.
+func (a *varApplier) funcs() template.FuncMap {
+	fm := make(template.FuncMap, len(templateFuncs)+1)
+	for k, f := range templateFuncs {
+		fm[k] = f
+	}
+	fm["devicesecret"] = func(purpose string, length ...any) (string, error) {
+		if len(a.secretKey) == 0 {
+			return "", fmt.Errorf("devicesecret: no secret key configured")
+		}
+		uuid, _ := a.vars["device_uuid"].(string)
+		if uuid == "" {
+			return "", fmt.Errorf("devicesecret: device_uuid is not set")
+		}
+		mac := hmac.New(sha256.New, a.secretKey)
+		mac.Write([]byte(uuid + "\x00" + purpose))
+		s := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+		n := 32
+		switch len(length) {
+		case 0:
+		case 1:
+			// длина — любое число (из JSON переменных приходит float64) или строка с целым
+			var err error
+			if n, err = toInt(length[0]); err != nil {
+				return "", fmt.Errorf("devicesecret: length: %w", err)
+			}
+		default:
+			return "", fmt.Errorf("devicesecret: expected purpose and optional length")
+		}
+		if n < 8 || n > len(s) {
+			return "", fmt.Errorf("devicesecret: length must be 8..%d", len(s))
+		}
+		return s[:n], nil
+	}
+	return fm
+}
+
+// str — строка из значения шаблона: nil (отсутствующая переменная) — "", не-строки — fmt.Sprint.
+func str(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	}
+	return fmt.Sprint(v)
+}
+
+// isZero — пустое значение для default: nil, "", false, ноль любого числового типа
+// (из JSON числа приходят float64), пустой список или словарь.
+func isZero(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
+
+// ===== числа =====
+
+// toInt — целое из числа любого типа (float64 из JSON — без дробной части) или строки.
+func toInt(v any) (int, error) {
+	switch t := v.(type) {
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(t))
+		if err != nil {
+			return 0, fmt.Errorf("int: %q is not an integer", t)
+		}
+		return n, nil
+	case nil:
+		return 0, fmt.Errorf("int: unsupported value %v", v)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt {
+			return 0, fmt.Errorf("int: %v is out of range", v)
+		}
+		return int(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || math.Abs(f) > math.MaxInt {
+			return 0, fmt.Errorf("int: %v is not an integer", v)
+		}
+		return int(f), nil
+	}
+	return 0, fmt.Errorf("int: unsupported value %v", v)
+}
+
+func arith(a, b any, op func(x, y int) (int, error)) (int, error) {
+	x, err := toInt(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := toInt(b)
+	if err != nil {
+		return 0, err
+	}
+	return op(x, y)
+}
+
+// ===== адреса =====
+
+func parsePrefix(prefix string) (*net.IPNet, int, int, error) {
+	_, n, err := net.ParseCIDR(strings.TrimSpace(prefix))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("bad prefix %q", prefix)
+	}
+	if v4 := n.IP.To4(); v4 != nil {
+		n.IP = v4
+	}
+	ones, bits := n.Mask.Size()
+	return n, ones, bits, nil
+}
+
+func ipInt(ip net.IP) *big.Int { return new(big.Int).SetBytes(ip) }
+
+func intIP(v *big.Int, size int) net.IP {
+	b := v.Bytes()
+	ip := make(net.IP, size)
+	copy(ip[size-len(b):], b)
+	return ip
+}
+
+// hostNum — n-й адрес в блоке из 2^hostBits адресов; отрицательный n — от конца.
+func hostNum(nv any, hostBits int, what string) (*big.Int, error) {
+	n, err := toInt(nv)
+	if err != nil {
+		return nil, err
+	}
+	size := new(big.Int).Lsh(big.NewInt(1), uint(hostBits))
+	num := big.NewInt(int64(n))
+	if n < 0 {
+		num.Add(num, size)
+	}
+	if num.Sign() < 0 || num.Cmp(size) >= 0 {
+		return nil, fmt.Errorf("%s %d out of range", what, n)
+	}
+	return num, nil
+}
+
+func cidrHost(prefix string, n any) (string, error) {
+	p, ones, bits, err := parsePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	num, err := hostNum(n, bits-ones, "cidrhost: host number")
+	if err != nil {
+		return "", err
+	}
+	return intIP(num.Add(num, ipInt(p.IP)), len(p.IP)).String(), nil
+}
+
+func cidrSubnet(prefix string, newbits, netnum any) (string, error) {
+	p, ones, bits, err := parsePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	nb, err := toInt(newbits)
+	if err != nil {
+		return "", err
+	}
+	if nb < 0 || ones+nb > bits {
+		return "", fmt.Errorf("cidrsubnet: %s has no room for %d more bits", prefix, nb)
+	}
+	num, err := hostNum(netnum, nb, "cidrsubnet: network number")
+	if err != nil {
+		return "", err
+	}
+	num.Lsh(num, uint(bits-ones-nb))
+	ip := intIP(num.Add(num, ipInt(p.IP)), len(p.IP))
+	return fmt.Sprintf("%s/%d", ip, ones+nb), nil
+}
+
+func cidrNetmask(prefix string) (string, error) {
+	p, _, bits, err := parsePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	if bits != 32 {
+		return "", fmt.Errorf("cidrnetmask: %s is not IPv4", prefix)
+	}
+	return net.IP(p.Mask).String(), nil
+}
+
+func cidrIP(prefix string) (string, error) {
+	ip, _, err := net.ParseCIDR(strings.TrimSpace(prefix))
+	if err != nil {
+		return "", fmt.Errorf("bad prefix %q", prefix)
+	}
+	return ip.String(), nil
+}
+
+func cidrLen(prefix string) (int, error) {
+	_, ones, _, err := parsePrefix(prefix)
+	return ones, err
+}
+
+func ip6Subnet(prefix string, newlen, netnum any) (string, error) {
+	_, ones, bits, err := parsePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	if bits != 128 {
+		return "", fmt.Errorf("ip6subnet: %s is not IPv6", prefix)
+	}
+	l, err := toInt(newlen)
+	if err != nil {
+		return "", err
+	}
+	return cidrSubnet(prefix, l-ones, netnum)
+}
+
+func ip6Host(prefix string, iid any) (string, error) {
+	p, ones, bits, err := parsePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	if bits != 128 {
+		return "", fmt.Errorf("ip6host: %s is not IPv6", prefix)
+	}
+	var id *big.Int
+	if s, ok := iid.(string); ok && strings.Contains(s, ":") {
+		ip := net.ParseIP(s)
+		if ip == nil || ip.To4() != nil {
+			return "", fmt.Errorf("ip6host: bad interface id %q", s)
+		}
+		id = ipInt(ip.To16())
+	} else if id, err = hostNum(iid, 128-ones, "ip6host: interface id"); err != nil {
+		return "", err
+	}
+	hostMask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(128-ones)), big.NewInt(1))
+	if new(big.Int).AndNot(id, hostMask).Sign() != 0 {
+		return "", fmt.Errorf("ip6host: interface id %v does not fit into /%d", iid, ones)
+	}
+	return intIP(id.Or(id, ipInt(p.IP)), 16).String(), nil
+}
+
+func eui64(prefix, mac string) (string, error) {
+	_, ones, bits, err := parsePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	if bits != 128 || ones > 64 {
+		return "", fmt.Errorf("eui64: %s must be an IPv6 prefix of /64 or shorter", prefix)
+	}
+	hw, err := parseMAC(mac)
+	if err != nil {
+		return "", err
+	}
+	iid := net.IP{0, 0, 0, 0, 0, 0, 0, 0, hw[0] ^ 0x02, hw[1], hw[2], 0xff, 0xfe, hw[3], hw[4], hw[5]}
+	return ip6Host(prefix, iid.String())
+}
+
+// ===== MAC =====
+
+func parseMAC(s string) (net.HardwareAddr, error) {
+	hw, err := net.ParseMAC(strings.TrimSpace(s))
+	if err != nil || len(hw) != 6 {
+		return nil, fmt.Errorf("bad mac %q", s)
+	}
+	return hw, nil
+}
+
+func macAdd(mac string, n any) (string, error) {
+	hw, err := parseMAC(mac)
+	if err != nil {
+		return "", err
+	}
+	d, err := toInt(n)
+	if err != nil {
+		return "", err
+	}
+	var buf [8]byte
+	copy(buf[2:], hw)
+	v := int64(binary.BigEndian.Uint64(buf[:])) + int64(d)
+	if v < 0 || v >= 1<<48 {
+		return "", fmt.Errorf("macadd: %s + %d overflows", mac, d)
+	}
+	binary.BigEndian.PutUint64(buf[:], uint64(v))
+	return net.HardwareAddr(buf[2:]).String(), nil
+}
+
+func macFormat(mac, style string) (string, error) {
+	hw, err := parseMAC(mac)
+	if err != nil {
+		return "", err
+	}
+	h := hex.EncodeToString(hw)
+	switch style {
+	case "", "colon":
+		return hw.String(), nil
+	case "dash":
+		return strings.ReplaceAll(hw.String(), ":", "-"), nil
+	case "cisco":
+		return h[0:4] + "." + h[4:8] + "." + h[8:12], nil
+	case "bare":
+		return h, nil
+	}
+	return "", fmt.Errorf("macformat: unknown style %q (colon, dash, cisco, bare)", style)
+}
+
+// macLocal — тот же MAC с битом locally administered и без multicast.
+func macLocal(mac string) (string, error) {
+	hw, err := parseMAC(mac)
+	if err != nil {
+		return "", err
+	}
+	hw[0] = hw[0]&^0x01 | 0x02
+	return hw.String(), nil
+}
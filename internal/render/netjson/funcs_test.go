@@ -0,0 +1,215 @@
+package netjson
+
+import (
+	"strings"
+	"testing"
+)
+
+// funcCase — вызов функции шаблона: want — результат, err — ожидается ошибка.
+type funcCase struct {
+	name string
+	call func() (string, error)
+	want string
+	err  bool
+}
+
+func runFuncCases(t *testing.T, cases []funcCase) {
+	t.Helper()
+	for _, c := range cases {
+		got, err := c.call()
+		switch {
+		case c.err && err == nil:
+			t.Errorf("%s = %q, want error", c.name, got)
+		case !c.err && err != nil:
+			t.Errorf("%s: %v", c.name, err)
+		case !c.err && got != c.want:
+			t.Errorf("%s = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCIDRFuncs(t *testing.T) {
+	runFuncCases(t, []funcCase{
+		{"cidrhost 1", func() (string, error) { return cidrHost("10.0.0.0/24", 1) }, "10.0.0.1", false},
+		{"cidrhost float", func() (string, error) { return cidrHost("10.0.0.0/24", 5.0) }, "10.0.0.5", false},
+		{"cidrhost string", func() (string, error) { return cidrHost("10.0.0.0/24", "7") }, "10.0.0.7", false},
+		{"cidrhost -1", func() (string, error) { return cidrHost("10.0.0.0/24", -1) }, "10.0.0.255", false},
+		{"cidrhost -2", func() (string, error) { return cidrHost("10.0.0.0/24", -2) }, "10.0.0.254", false},
+		{"cidrhost -256", func() (string, error) { return cidrHost("10.0.0.0/24", -256) }, "10.0.0.0", false},
+		{"cidrhost host bits ignored", func() (string, error) { return cidrHost("10.0.0.77/24", 1) }, "10.0.0.1", false},
+		{"cidrhost ipv6", func() (string, error) { return cidrHost("fd00::/64", 16) }, "fd00::10", false},
+		{"cidrhost 256", func() (string, error) { return cidrHost("10.0.0.0/24", 256) }, "", true},
+		{"cidrhost -257", func() (string, error) { return cidrHost("10.0.0.0/24", -257) }, "", true},
+		{"cidrhost fraction", func() (string, error) { return cidrHost("10.0.0.0/24", 1.5) }, "", true},
+		{"cidrhost bad prefix", func() (string, error) { return cidrHost("10.0.0.0", 1) }, "", true},
+		{"cidrhost nil", func() (string, error) { return cidrHost("10.0.0.0/24", nil) }, "", true},
+
+		{"cidrsubnet", func() (string, error) { return cidrSubnet("10.0.0.0/16", 8, 3) }, "10.0.3.0/24", false},
+		{"cidrsubnet -1", func() (string, error) { return cidrSubnet("10.0.0.0/16", 8, -1) }, "10.0.255.0/24", false},
+		{"cidrsubnet 0 bits", func() (string, error) { return cidrSubnet("10.0.0.0/16", 0, 0) }, "10.0.0.0/16", false},
+		{"cidrsubnet ipv6", func() (string, error) { return cidrSubnet("2001:db8::/48", 16, 10) }, "2001:db8:0:a::/64", false},
+		{"cidrsubnet netnum out of range", func() (string, error) { return cidrSubnet("10.0.0.0/16", 8, 256) }, "", true},
+		{"cidrsubnet netnum too negative", func() (string, error) { return cidrSubnet("10.0.0.0/16", 8, -257) }, "", true},
+		{"cidrsubnet too many bits", func() (string, error) { return cidrSubnet("10.0.0.0/30", 3, 0) }, "", true},
+		{"cidrsubnet negative bits", func() (string, error) { return cidrSubnet("10.0.0.0/16", -1, 0) }, "", true},
+
+		{"cidrnetmask", func() (string, error) { return cidrNetmask("10.0.0.0/20") }, "255.255.240.0", false},
+		{"cidrnetmask ipv6", func() (string, error) { return cidrNetmask("fd00::/64") }, "", true},
+		{"cidrip", func() (string, error) { return cidrIP("10.0.0.7/24") }, "10.0.0.7", false},
+	})
+}
+
+func TestIPv6Funcs(t *testing.T) {
+	runFuncCases(t, []funcCase{
+		{"ip6subnet", func() (string, error) { return ip6Subnet("2001:db8:1::/56", 64, 3) }, "2001:db8:1:3::/64", false},
+		{"ip6subnet last", func() (string, error) { return ip6Subnet("2001:db8:1::/56", 64, -1) }, "2001:db8:1:ff::/64", false},
+		{"ip6subnet same length", func() (string, error) { return ip6Subnet("2001:db8:1::/56", 56, 0) }, "2001:db8:1::/56", false},
+		{"ip6subnet out of range", func() (string, error) { return ip6Subnet("2001:db8:1::/56", 64, 256) }, "", true},
+		{"ip6subnet shorter", func() (string, error) { return ip6Subnet("2001:db8:1::/56", 48, 0) }, "", true},
+		{"ip6subnet ipv4", func() (string, error) { return ip6Subnet("10.0.0.0/8", 16, 0) }, "", true},
+
+		{"ip6host number", func() (string, error) { return ip6Host("2001:db8:1:3::/64", 1) }, "2001:db8:1:3::1", false},
+		{"ip6host address", func() (string, error) { return ip6Host("2001:db8:1:3::/64", "::1:2") }, "2001:db8:1:3::1:2", false},
+		{"ip6host negative", func() (string, error) { return ip6Host("2001:db8:1:3::/120", -1) }, "2001:db8:1:3::ff", false},
+		{"ip6host iid too big", func() (string, error) { return ip6Host("2001:db8:1:3::/120", "::1:0") }, "", true},
+		{"ip6host bad iid", func() (string, error) { return ip6Host("2001:db8:1:3::/64", "1.2.3.4:") }, "", true},
+		{"ip6host ipv4 iid", func() (string, error) { return ip6Host("2001:db8:1:3::/64", "::ffff:1.2.3.4") }, "", true},
+		{"ip6host ipv4 prefix", func() (string, error) { return ip6Host("10.0.0.0/8", 1) }, "", true},
+
+		{"eui64", func() (string, error) { return eui64("2001:db8:1:3::/64", "00:11:22:33:44:55") }, "2001:db8:1:3:211:22ff:fe33:4455", false},
+		{"eui64 local bit flipped", func() (string, error) { return eui64("fd00::/64", "02:11:22:33:44:55") }, "fd00::11:22ff:fe33:4455", false},
+		{"eui64 dash mac", func() (string, error) { return eui64("fd00::/48", "00-11-22-33-44-55") }, "fd00::211:22ff:fe33:4455", false},
+		{"eui64 /80", func() (string, error) { return eui64("fd00::/80", "00:11:22:33:44:55") }, "", true},
+		{"eui64 bad mac", func() (string, error) { return eui64("fd00::/64", "00:11:22") }, "", true},
+		{"eui64 ipv4", func() (string, error) { return eui64("10.0.0.0/8", "00:11:22:33:44:55") }, "", true},
+	})
+}
+
+func TestMACFuncs(t *testing.T) {
+	runFuncCases(t, []funcCase{
+		{"macadd 1", func() (string, error) { return macAdd("00:11:22:33:44:55", 1) }, "00:11:22:33:44:56", false},
+		{"macadd carry", func() (string, error) { return macAdd("00:11:22:33:44:ff", 1) }, "00:11:22:33:45:00", false},
+		{"macadd negative", func() (string, error) { return macAdd("00:11:22:33:45:00", -1) }, "00:11:22:33:44:ff", false},
+		{"macadd max", func() (string, error) { return macAdd("ff:ff:ff:ff:ff:fe", 1) }, "ff:ff:ff:ff:ff:ff", false},
+		{"macadd overflow", func() (string, error) { return macAdd("ff:ff:ff:ff:ff:ff", 1) }, "", true},
+		{"macadd underflow", func() (string, error) { return macAdd("00:00:00:00:00:00", -1) }, "", true},
+		{"macadd bad mac", func() (string, error) { return macAdd("zz:11:22:33:44:55", 1) }, "", true},
+		{"macadd bad n", func() (string, error) { return macAdd("00:11:22:33:44:55", "x") }, "", true},
+
+		{"macformat colon", func() (string, error) { return macFormat("00-11-22-AA-BB-CC", "colon") }, "00:11:22:aa:bb:cc", false},
+		{"macformat default", func() (string, error) { return macFormat("00:11:22:aa:bb:cc", "") }, "00:11:22:aa:bb:cc", false},
+		{"macformat dash", func() (string, error) { return macFormat("00:11:22:aa:bb:cc", "dash") }, "00-11-22-aa-bb-cc", false},
+		{"macformat cisco", func() (string, error) { return macFormat("00:11:22:aa:bb:cc", "cisco") }, "0011.22aa.bbcc", false},
+		{"macformat bare", func() (string, error) { return macFormat("0011.22aa.bbcc", "bare") }, "001122aabbcc", false},
+		{"macformat unknown style", func() (string, error) { return macFormat("00:11:22:aa:bb:cc", "upper") }, "", true},
+		{"macformat eui64 mac", func() (string, error) { return macFormat("00:11:22:33:44:55:66:77", "colon") }, "", true},
+
+		{"maclocal", func() (string, error) { return macLocal("01:11:22:33:44:55") }, "02:11:22:33:44:55", false},
+	})
+}
+
+func TestDeviceSecret(t *testing.T) {
+	render := func(tpl string, vars map[string]any, key string) (string, error) {
+		out, err := ApplyVarsWith(map[string]any{"v": tpl}, vars, VarsOptions{Strict: true, SecretKey: []byte(key)})
+		if err != nil {
+			return "", err
+		}
+		return out["v"].(string), nil
+	}
+	dev := map[string]any{"device_uuid": "0b5c1f7e-8d2a-4c5e-9f00-000000000001"}
+	other := map[string]any{"device_uuid": "0b5c1f7e-8d2a-4c5e-9f00-000000000002"}
+
+	a, err := render(`{{devicesecret "wifi"}}`, dev, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 32 {
+		t.Errorf("default length = %d, want 32", len(a))
+	}
+	for _, c := range []struct {
+		name      string
+		tpl       string
+		vars      map[string]any
+		key       string
+		sameAsA   bool
+		wantLen   int
+		wantError bool
+	}{
+		{name: "stable", tpl: `{{devicesecret "wifi"}}`, vars: dev, key: "k1", sameAsA: true, wantLen: 32},
+		{name: "other purpose", tpl: `{{devicesecret "vpn"}}`, vars: dev, key: "k1", wantLen: 32},
+		{name: "other device", tpl: `{{devicesecret "wifi"}}`, vars: other, key: "k1", wantLen: 32},
+		{name: "other key", tpl: `{{devicesecret "wifi"}}`, vars: dev, key: "k2", wantLen: 32},
+		{name: "min length", tpl: `{{devicesecret "wifi" 8}}`, vars: dev, key: "k1", wantLen: 8},
+		{name: "max length", tpl: `{{devicesecret "wifi" 43}}`, vars: dev, key: "k1", wantLen: 43},
+		{name: "too short", tpl: `{{devicesecret "wifi" 7}}`, vars: dev, key: "k1", wantError: true},
+		{name: "too long", tpl: `{{devicesecret "wifi" 44}}`, vars: dev, key: "k1", wantError: true},
+		{name: "length from JSON", tpl: `{{devicesecret "wifi" .n}}`, vars: map[string]any{"device_uuid": dev["device_uuid"], "n": 16.0}, key: "k1", wantLen: 16},
+		{name: "length int64", tpl: `{{devicesecret "wifi" .n}}`, vars: map[string]any{"device_uuid": dev["device_uuid"], "n": int64(12)}, key: "k1", wantLen: 12},
+		{name: "fractional length", tpl: `{{devicesecret "wifi" .n}}`, vars: map[string]any{"device_uuid": dev["device_uuid"], "n": 16.5}, key: "k1", wantError: true},
+		{name: "extra argument", tpl: `{{devicesecret "wifi" 16 16}}`, vars: dev, key: "k1", wantError: true},
+		{name: "no key", tpl: `{{devicesecret "wifi"}}`, vars: dev, key: "", wantError: true},
+		{name: "no device_uuid", tpl: `{{devicesecret "wifi"}}`, vars: map[string]any{}, key: "k1", wantError: true},
+	} {
+		got, err := render(c.tpl, c.vars, c.key)
+		if c.wantError {
+			if err == nil {
+				t.Errorf("%s: got %q, want error", c.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if len(got) != c.wantLen {
+			t.Errorf("%s: length %d, want %d", c.name, len(got), c.wantLen)
+		}
+		if (got == a) != c.sameAsA && c.wantLen == 32 {
+			t.Errorf("%s: %q vs %q, same = %v, want %v", c.name, got, a, got == a, c.sameAsA)
+		}
+		if c.wantLen < 32 && !strings.HasPrefix(a, got) {
+			t.Errorf("%s: %q is not a prefix of the full secret %q", c.name, got, a)
+		}
+	}
+}
+
+// default: пустое значение любого типа, в том числе числа из JSON (float64) и пустые списки/словари.
+func TestDefault(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		v    any
+		zero bool
+	}{
+		{"missing", nil, true},
+		{"empty string", "", true},
+		{"false", false, true},
+		{"int 0", 0, true},
+		{"float64 0", 0.0, true},
+		{"int64 0", int64(0), true},
+		{"uint8 0", uint8(0), true},
+		{"empty list", []any{}, true},
+		{"empty map", map[string]any{}, true},
+		{"string", "x", false},
+		{"true", true, false},
+		{"float64", 0.5, false},
+		{"negative", -1.0, false},
+		{"list", []any{"a"}, false},
+		{"map", map[string]any{"a": 1.0}, false},
+	} {
+		vars := map[string]any{}
+		if c.v != nil {
+			vars["v"] = c.v
+		}
+		out, err := ApplyVars(map[string]any{"r": `{{if eq (printf "%v" (default "DEF" .v)) "DEF"}}zero{{else}}set{{end}}`}, vars)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		want := "set"
+		if c.zero {
+			want = "zero"
+		}
+		if out["r"] != want {
+			t.Errorf("%s: default %v → %v, want %s", c.name, c.v, out["r"], want)
+		}
+	}
+}
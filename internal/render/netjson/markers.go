@@ -0,0 +1,73 @@
+package netjson
+
+// Маркеры удаления и замены в источнике, который накатывается поверх накопленного результата:
+//
+//	"dns_search": null                          — удалить ключ
+//	"wireless": {"$delete": true}               — то же, явно
+//	"firewall": {"$replace": true, "zones": []} — заменить map целиком (без глубокого слияния)
+//
+// В массивах с ключом (DefaultStrategies / $merge "key:..."):
+//
+//	{"name": "ssh", "$delete": true}                 — удалить элемент с этим ключом
+//	{"name": "ssh", "$replace": true, "src": "lan"}  — заменить элемент целиком
+//
+// В массивах скаляров со стратегией append — {"$delete": "9.9.9.9"} убирает значение.
+// Маркеры в результат не попадают: null и {"$delete": ...} без цели просто отбрасываются.
+const (
+	DeleteKey  = "$delete"
+	ReplaceKey = "$replace"
+)
+
+// isDelete — значение или элемент массива с "$delete": true.
+func isDelete(v any) bool {
+	m, ok := v.(map[string]any)
+	return ok && m[DeleteKey] == true
+}
+
+// isReplace — map с "$replace": true.
+func isReplace(v any) bool {
+	m, ok := v.(map[string]any)
+	return ok && m[ReplaceKey] == true
+}
+
+// deleteScalar — значение из {"$delete": <скаляр>} для массивов скаляров.
+func deleteScalar(v any) (any, bool) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 1 {
+		return nil, false
+	}
+	x, ok := m[DeleteKey]
+	if !ok || x == true {
+		return nil, false
+	}
+	switch x.(type) {
+	case map[string]any, []any, nil:
+		return nil, false
+	}
+	return x, true
+}
+
+// strip убирает маркеры из значения, которому не с чем сливаться.
+func strip(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, x := range t {
+			if k == ReplaceKey || k == DeleteKey || x == nil || isDelete(x) {
+				continue
+			}
+			out[k] = strip(x)
+		}
+		return out
+	case []any:
+		out := make([]any, 0, len(t))
+		for _, x := range t {
+			if _, ok := deleteScalar(x); ok || isDelete(x) {
+				continue
+			}
+			out = append(out, strip(x))
+		}
+		return out
+	}
+	return v
+}
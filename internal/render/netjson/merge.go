@@ -7,6 +7,7 @@ import (
 	"sort"
 	"strings"
 	"text/template"
+	"text/template/parse"
 )
 
 // Source — единица слияния NetJSON с приоритетом.
@@ -18,46 +19,112 @@ type Source struct {
 
 // Merge объединяет несколько NetJSON-источников по приоритету.
 // При конфликте ключей: побеждает источник с БОЛЬШИМ Priority.
-// Для map — глубокое слияние; для slice и скаляров — замена целиком.
+// Для map — глубокое слияние; для slice — по стратегии пути (DefaultStrategies и $merge
+// источника, см. strategy.go); для скаляров — замена целиком. null, $delete и $replace —
+// удаление и принудительная замена (см. markers.go).
 func Merge(sources ...Source) (map[string]any, error) {
+	out, _, err := merge(sources)
+	return out, err
+}
+
+// merge — Merge плюс дерево происхождения той же формы, что результат: в листьях *Origin
+// (см. provenance.go).
+func merge(sources []Source) (map[string]any, map[string]any, error) {
 	if len(sources) == 0 {
-		return map[string]any{}, nil
+		return map[string]any{}, map[string]any{}, nil
 	}
 	// сортируем по возрастанию приоритета и накатываем по очереди
 	sort.SliceStable(sources, func(i, j int) bool { return sources[i].Priority < sources[j].Priority })
-	var out map[string]any
-	for i, s := range sources {
+	var out, origins map[string]any
+	for _, s := range sources {
 		if s.JSON == nil {
 			continue
 		}
-		if i == 0 {
-			out = cloneMap(s.JSON)
-			continue
+		src := cloneMap(s.JSON)
+		strat, err := strategies(src[MergeKey])
+		if err != nil {
+			return nil, nil, fmt.Errorf("netjson: source %s: %w", s.Name, err)
 		}
-		out = deepMerge(out, s.JSON)
+		delete(src, MergeKey)
+		m := &merger{strat: strat, origin: &Origin{Source: s.Name, Priority: s.Priority}}
+		out, origins = m.merge(out, origins, src, "")
 	}
-	return out, nil
+	return out, origins, nil
+}
+
+// merger — накатывание одного источника: его стратегии массивов и происхождение.
+type merger struct {
+	strat  map[string]Strategy
+	origin *Origin
 }
 
-func deepMerge(dst, src map[string]any) map[string]any {
+// merge накатывает src на dst; dstO — дерево происхождения dst, path — путь dst для стратегий массивов.
+func (m *merger) merge(dst, dstO, src map[string]any, path string) (map[string]any, map[string]any) {
 	if dst == nil {
-		return cloneMap(src)
+		out := strip(cloneMap(src)).(map[string]any)
+		return out, m.tag(out).(map[string]any)
 	}
 	out := cloneMap(dst)
+	outO := make(map[string]any, len(dstO))
+	for k, o := range dstO {
+		outO[k] = o
+	}
 	for k, v := range src {
-		if dv, ok := out[k]; ok {
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+		sv := cloneValue(v)
+		switch {
+		case sv == nil || isDelete(sv):
+			delete(out, k)
+			delete(outO, k)
+			continue
+		case isReplace(sv):
+			out[k] = strip(sv)
+			outO[k] = m.tag(out[k])
+			continue
+		}
+		switch dv := out[k].(type) {
+		case map[string]any:
 			// map + map → merge
-			if dm, ok1 := dv.(map[string]any); ok1 {
-				if sm, ok2 := toMap(v); ok2 {
-					out[k] = deepMerge(dm, sm)
-					continue
-				}
+			if sm, ok := toMap(sv); ok {
+				dO, _ := outO[k].(map[string]any)
+				out[k], outO[k] = m.merge(dv, dO, sm, p)
+				continue
+			}
+		case []any:
+			// slice + slice → по стратегии
+			if ss, ok := sv.([]any); ok {
+				dO, _ := outO[k].([]any)
+				out[k], outO[k] = m.slice(dv, dO, ss, p)
+				continue
 			}
 		}
 		// иначе — просто заменить
-		out[k] = cloneValue(v)
+		out[k] = strip(sv)
+		outO[k] = m.tag(out[k])
 	}
-	return out
+	return out, outO
+}
+
+// tag — дерево происхождения для значения, целиком взятого из текущего источника.
+func (m *merger) tag(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		o := make(map[string]any, len(t))
+		for k, x := range t {
+			o[k] = m.tag(x)
+		}
+		return o
+	case []any:
+		o := make([]any, len(t))
+		for i, x := range t {
+			o[i] = m.tag(x)
+		}
+		return o
+	}
+	return m.origin
 }
 
 func toMap(v any) (map[string]any, bool) {
@@ -89,123 +156,274 @@ func cloneValue(v any) any {
 // ApplyVars применяет переменные к NetJSON.
 // 1) Текстовые значения обрабатываются как Go template с данными из vars.
 // 2) Объект {"$var":"a.b.c","default":<val>} заменяется значением из vars по пути.
+// Ошибки не возвращаются: неразрешённое остаётся как есть (см. ApplyVarsWith со Strict).
 func ApplyVars(nj map[string]any, vars map[string]any) (map[string]any, error) {
-	res := cloneMap(nj)
-	var err error
-	res, err = applyVarObjects(res, vars)
-	if err != nil {
-		return nil, err
-	}
-	res, err = applyStringTemplates(res, vars)
-	if err != nil {
-		return nil, err
+	return ApplyVarsWith(nj, vars, VarsOptions{})
+}
+
+// VarsOptions — режим ApplyVarsWith.
+type VarsOptions struct {
+	// Strict: {"$var"} без значения и default, ошибки разбора и выполнения шаблонов, отсутствующая
+	// переменная в выводе ({{.key}}, {{.key | upper}}, {{printf "%s" .key}}, тело {{if}}) — всё
+	// возвращается одной VarErrors с путями. Отсутствовать могут только значение для default
+	// ({{default "x" .key}}) и условия if/with/range (см. unresolvedFields).
+	Strict bool
+	// Provenance — если задана, подставленные значения отмечаются в ней (см. provenance.go).
+	Provenance Provenance
+	// SecretKey — ключ HMAC для devicesecret (см. funcs.go); без него devicesecret — ошибка.
+	SecretKey []byte
+}
+
+// VarError — неразрешённая переменная или ошибка шаблона в конкретном месте NetJSON.
+type VarError struct {
+	Path string `json:"path"` // JSON Pointer значения
+	Msg  string `json:"msg"`
+}
+
+func (e *VarError) Error() string { return e.Path + ": " + e.Msg }
+
+// VarErrors — все ошибки строгого ApplyVarsWith одним значением.
+type VarErrors []*VarError
+
+func (es VarErrors) Error() string {
+	parts := make([]string, len(es))
+	for i, e := range es {
+		parts[i] = e.Error()
 	}
-	return res, nil
+	return fmt.Sprintf("netjson: %d variable error(s): %s", len(es), strings.Join(parts, "; "))
 }
 
-func applyVarObjects(v any, vars map[string]any) (map[string]any, error) {
-	m, ok := v.(map[string]any)
-	if !ok {
-		return nil, fmt.Errorf("applyVarObjects expects map")
+// ApplyVarsWith — ApplyVars с опциями. В строгом режиме при ошибках возвращается и результат
+// (с неразрешёнными местами как есть), и VarErrors.
+func ApplyVarsWith(nj map[string]any, vars map[string]any, opts VarsOptions) (map[string]any, error) {
+	a := &varApplier{vars: vars, strict: opts.Strict, secretKey: opts.SecretKey}
+	res := a.objects("", cloneMap(nj))
+	out, _ := a.templates("", res).(map[string]any)
+	if opts.Provenance != nil {
+		opts.Provenance.vars("", nj, out, vars)
+	}
+	if len(a.errs) > 0 {
+		sort.SliceStable(a.errs, func(i, j int) bool { return a.errs[i].Path < a.errs[j].Path })
+		return out, a.errs
 	}
+	return out, nil
+}
 
-	var walk func(x any) any // ← предварительное объявление
+type varApplier struct {
+	vars      map[string]any
+	strict    bool
+	secretKey []byte
+	errs      VarErrors
+}
 
-	walk = func(x any) any {
-		switch t := x.(type) {
-		case map[string]any:
-			if path, ok := t["$var"].(string); ok {
-				val, ok := lookup(vars, path)
-				if !ok {
-					if def, has := t["default"]; has {
-						return def
-					}
-					return x // оставляем как есть
-				}
-				return val
+func (a *varApplier) fail(ptr, format string, args ...any) {
+	if a.strict {
+		a.errs = append(a.errs, &VarError{Path: ptr, Msg: fmt.Sprintf(format, args...)})
+	}
+}
+
+// objects заменяет {"$var": ...} значениями из vars.
+func (a *varApplier) objects(ptr string, x any) any {
+	switch t := x.(type) {
+	case map[string]any:
+		if raw, ok := t["$var"]; ok {
+			path, ok := raw.(string)
+			if !ok {
+				a.fail(ptr+"/$var", "$var must be a string")
+				return x
 			}
-			y := make(map[string]any, len(t))
-			for k, vv := range t {
-				y[k] = walk(vv)
+			val, ok := lookup(a.vars, path)
+			if !ok {
+				if def, has := t["default"]; has {
+					return def
+				}
+				a.fail(ptr, "unresolved variable %q", path)
+				return x // оставляем как есть
 			}
-			return y
-		case []any:
-			y := make([]any, len(t))
-			for i := range t {
-				y[i] = walk(t[i])
+			return val
+		}
+		y := make(map[string]any, len(t))
+		for k, vv := range t {
+			y[k] = a.objects(ptr+"/"+escapePointer(k), vv)
+		}
+		return y
+	case []any:
+		y := make([]any, len(t))
+		for i := range t {
+			y[i] = a.objects(fmt.Sprintf("%s/%d", ptr, i), t[i])
+		}
+		return y
+	default:
+		return x
+	}
+}
+
+// templates выполняет строки с {{ }} как Go template с данными vars.
+func (a *varApplier) templates(ptr string, x any) any {
+	switch t := x.(type) {
+	case string:
+		if !strings.Contains(t, "{{") {
+			return t
+		}
+		tpl, err := template.New("v").Funcs(a.funcs()).Option("missingkey=zero").Parse(t)
+		if err != nil {
+			a.fail(ptr, "%v", err)
+			return t
+		}
+		if a.strict {
+			if miss := unresolvedFields(tpl.Tree.Root, a.vars); len(miss) > 0 {
+				a.fail(ptr, "unresolved variable %q", miss[0])
+				return t
 			}
-			return y
-		default:
-			return x
 		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, a.vars); err != nil {
+			a.fail(ptr, "%v", err)
+			return t
+		}
+		return buf.String()
+	case map[string]any:
+		y := make(map[string]any, len(t))
+		for k, vv := range t {
+			y[k] = a.templates(ptr+"/"+escapePointer(k), vv)
+		}
+		return y
+	case []any:
+		y := make([]any, len(t))
+		for i := range t {
+			y[i] = a.templates(fmt.Sprintf("%s/%d", ptr, i), t[i])
+		}
+		return y
+	default:
+		return t
 	}
+}
 
-	anyRes := walk(m)
-	out, _ := anyRes.(map[string]any)
-	return out, nil
+// unresolvedFields — пути отсутствующих в vars полей, от которых зависит вывод: в печати,
+// пайплайнах ({{.a | upper}}), аргументах функций ({{printf "%s" .a}}) и телах if/else.
+// Отсутствовать могут: значение для default ({{default "x" .a}}, {{.a | default "x"}}), условия
+// if/with/range ({{if .a}}) и поля внутри тела под таким условием ({{if .a}}{{.a.b}}{{end}},
+// {{if haskey . "a"}}{{.a}}{{end}}). В телах with/range точка другая — проверяются только $.a.
+func unresolvedFields(list *parse.ListNode, vars map[string]any) []string {
+	w := &fieldWalker{vars: vars}
+	w.list(list, nil, true)
+	return w.out
 }
 
-func applyStringTemplates(v any, data map[string]any) (map[string]any, error) {
-	m, ok := v.(map[string]any)
-	if !ok {
-		return nil, fmt.Errorf("applyStringTemplates expects map")
+type fieldWalker struct {
+	vars map[string]any
+	out  []string
+}
+
+// list обходит узлы; guards — пути, проверенные условием выше, root — точка указывает на vars.
+func (w *fieldWalker) list(l *parse.ListNode, guards []string, root bool) {
+	if l == nil {
+		return
 	}
-	funcs := template.FuncMap{
-		"upper": strings.ToUpper,
-		"lower": strings.ToLower,
-		"default": func(def any, val any) any {
-			if isZero(val) {
-				return def
-			}
-			return val
-		},
-		"join": func(a []any, sep string) string {
-			parts := make([]string, 0, len(a))
-			for _, it := range a {
-				parts = append(parts, fmt.Sprint(it))
-			}
-			return strings.Join(parts, sep)
-		},
-	}
-	var render func(x any) any
-	render = func(x any) any {
-		switch t := x.(type) {
-		case string:
-			if !strings.Contains(t, "{{") {
-				return t
-			}
-			tpl, err := template.New("v").Funcs(funcs).Option("missingkey=zero").Parse(t)
-			if err != nil {
-				return t
-			}
-			var buf bytes.Buffer
-			if err := tpl.Execute(&buf, data); err != nil {
-				return t
+	for _, n := range l.Nodes {
+		switch t := n.(type) {
+		case *parse.ActionNode:
+			w.pipe(t.Pipe, guards, root)
+		case *parse.TemplateNode:
+			w.pipe(t.Pipe, guards, root)
+		case *parse.IfNode:
+			g := append(guards[:len(guards):len(guards)], conditionPaths(t.Pipe)...)
+			w.list(t.List, g, root)
+			w.list(t.ElseList, guards, root)
+		case *parse.WithNode:
+			g := append(guards[:len(guards):len(guards)], conditionPaths(t.Pipe)...)
+			w.list(t.List, g, false)
+			w.list(t.ElseList, guards, root)
+		case *parse.RangeNode:
+			g := append(guards[:len(guards):len(guards)], conditionPaths(t.Pipe)...)
+			w.list(t.List, g, false)
+			w.list(t.ElseList, guards, root)
+		}
+	}
+}
+
+// pipe проверяет поля пайплайна; команды до default включительно пропускаются.
+func (w *fieldWalker) pipe(p *parse.PipeNode, guards []string, root bool) {
+	if p == nil {
+		return
+	}
+	from := 0
+	for i, c := range p.Cmds {
+		if len(c.Args) > 0 {
+			if id, ok := c.Args[0].(*parse.IdentifierNode); ok && id.Ident == "default" {
+				from = i + 1
 			}
-			return buf.String()
-		case map[string]any:
-			y := make(map[string]any, len(t))
-			for k, vv := range t {
-				y[k] = render(vv)
+		}
+	}
+	for _, c := range p.Cmds[from:] {
+		for _, arg := range c.Args {
+			w.node(arg, guards, root)
+		}
+	}
+}
+
+func (w *fieldWalker) node(n parse.Node, guards []string, root bool) {
+	switch t := n.(type) {
+	case *parse.FieldNode:
+		if root {
+			w.check(t.Ident, guards)
+		}
+	case *parse.VariableNode:
+		if len(t.Ident) > 1 && t.Ident[0] == "$" {
+			w.check(t.Ident[1:], guards)
+		}
+	case *parse.ChainNode:
+		w.node(t.Node, guards, root)
+	case *parse.PipeNode:
+		w.pipe(t, guards, root)
+	}
+}
+
+func (w *fieldWalker) check(ident []string, guards []string) {
+	path := strings.Join(ident, ".")
+	for _, g := range guards {
+		if path == g || strings.HasPrefix(path, g+".") {
+			return
+		}
+	}
+	if _, ok := lookup(w.vars, path); !ok {
+		w.out = append(w.out, path)
+	}
+}
+
+// conditionPaths — поля условия if/with/range (и ключи haskey . "k"): внутри тела они заданы.
+func conditionPaths(p *parse.PipeNode) []string {
+	var out []string
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch t := n.(type) {
+		case *parse.FieldNode:
+			out = append(out, strings.Join(t.Ident, "."))
+		case *parse.VariableNode:
+			if len(t.Ident) > 1 && t.Ident[0] == "$" {
+				out = append(out, strings.Join(t.Ident[1:], "."))
 			}
-			return y
-		case []any:
-			y := make([]any, len(t))
-			for i := range t {
-				y[i] = render(t[i])
+		case *parse.PipeNode:
+			for _, c := range t.Cmds {
+				if len(c.Args) == 3 {
+					id, isIdent := c.Args[0].(*parse.IdentifierNode)
+					_, isDot := c.Args[1].(*parse.DotNode)
+					if isIdent && isDot && id.Ident == "haskey" {
+						if k, ok := c.Args[2].(*parse.StringNode); ok {
+							out = append(out, k.Text)
+						}
+					}
+				}
+				for _, a := range c.Args {
+					walk(a)
+				}
 			}
-			return y
-		default:
-			return t
 		}
 	}
-	anyRes := render(m)
-	out, _ := anyRes.(map[string]any)
-	return out, nil
+	walk(p)
+	return out
 }
 
-func isZero(v any) bool { return v == nil || v == "" || v == 0 || v == false }
-
 // lookup читает значение из vars по пути вида "a.b.c".
 func lookup(vars map[string]any, path string) (any, bool) {
 	cur := any(vars)
@@ -0,0 +1,139 @@
+package netjson
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMergeMarkers(t *testing.T) {
+	cases := []struct {
+		name            string
+		base, over, out string
+	}{
+		{
+			name: "null deletes key",
+			base: `{"dns_search": ["lan"], "system": {"hostname": "a", "zonename": "UTC"}}`,
+			over: `{"dns_search": null, "system": {"zonename": null}}`,
+			out:  `{"system": {"hostname": "a"}}`,
+		},
+		{
+			name: "$delete deletes map key",
+			base: `{"wireless": {"radios": [{"name": "radio0"}]}, "system": {"hostname": "a"}}`,
+			over: `{"wireless": {"$delete": true}}`,
+			out:  `{"system": {"hostname": "a"}}`,
+		},
+		{
+			name: "$delete of a missing key is a no-op",
+			base: `{"system": {"hostname": "a"}}`,
+			over: `{"wireless": {"$delete": true}, "system": {"ntp": null}}`,
+			out:  `{"system": {"hostname": "a"}}`,
+		},
+		{
+			name: "$delete removes keyed list item",
+			base: `{"firewall": {"zones": [{"name": "lan", "input": "ACCEPT"}, {"name": "wan", "input": "REJECT"}]}}`,
+			over: `{"firewall": {"zones": [{"name": "lan", "$delete": true}]}}`,
+			out:  `{"firewall": {"zones": [{"name": "wan", "input": "REJECT"}]}}`,
+		},
+		{
+			name: "$delete removes item matched by compound key",
+			base: `{"wireless": {"interfaces": [{"device": "radio0", "ssid": "a"}, {"device": "radio0", "ssid": "b"}]}}`,
+			over: `{"wireless": {"interfaces": [{"device": "radio0", "ssid": "a", "$delete": true}]}}`,
+			out:  `{"wireless": {"interfaces": [{"device": "radio0", "ssid": "b"}]}}`,
+		},
+		{
+			name: "$delete removes scalar from append array",
+			base: `{"dns_servers": ["1.1.1.1", "9.9.9.9"]}`,
+			over: `{"dns_servers": [{"$delete": "9.9.9.9"}, "8.8.8.8"]}`,
+			out:  `{"dns_servers": ["1.1.1.1", "8.8.8.8"]}`,
+		},
+		{
+			name: "$replace replaces map without deep merge",
+			base: `{"firewall": {"zones": [{"name": "lan"}], "rules": [{"name": "ssh"}]}}`,
+			over: `{"firewall": {"$replace": true, "zones": []}}`,
+			out:  `{"firewall": {"zones": []}}`,
+		},
+		{
+			name: "$replace replaces keyed list item",
+			base: `{"firewall": {"zones": [{"name": "lan", "input": "ACCEPT", "masq": true}]}}`,
+			over: `{"firewall": {"zones": [{"name": "lan", "$replace": true, "input": "DROP"}]}}`,
+			out:  `{"firewall": {"zones": [{"name": "lan", "input": "DROP"}]}}`,
+		},
+		{
+			name: "keyed item without markers merges deep",
+			base: `{"firewall": {"zones": [{"name": "lan", "input": "ACCEPT", "masq": true}]}}`,
+			over: `{"firewall": {"zones": [{"name": "lan", "input": "DROP", "masq": null}]}}`,
+			out:  `{"firewall": {"zones": [{"name": "lan", "input": "DROP"}]}}`,
+		},
+		{
+			name: "markers without a target are dropped",
+			base: `{}`,
+			over: `{"a": null, "b": {"$delete": true}, "c": {"$replace": true, "x": 1, "y": null},
+				"dns_servers": [{"$delete": "1.1.1.1"}, "8.8.8.8"], "firewall": {"zones": [{"name": "lan", "$delete": true}]}}`,
+			out: `{"c": {"x": 1}, "dns_servers": ["8.8.8.8"], "firewall": {"zones": []}}`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := Merge(
+				Source{Name: "base", Priority: 1, JSON: decode(t, c.base)},
+				Source{Name: "over", Priority: 2, JSON: decode(t, c.over)},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := decode(t, c.out); !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %s, want %s", jsonText(got), jsonText(want))
+			}
+		})
+	}
+}
+
+func decode(t *testing.T, s string) map[string]any {
+	t.Helper()
+	var m map[string]any
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return m
+}
+
+// Строгий режим: отсутствующая переменная — ошибка везде, где от неё зависит вывод,
+// кроме значения для default и условий (и тел под ними).
+func TestStrictUnresolved(t *testing.T) {
+	vars := map[string]any{"site": "msk", "wan": map[string]any{"ip": "192.0.2.1"}, "list": []any{"a"}}
+	for _, c := range []struct {
+		tpl, miss string // miss — "" если ошибки нет
+	}{
+		{`{{.nope}}`, "nope"},
+		{`{{.wan.gw}}`, "wan.gw"},
+		{`{{.nope | upper}}`, "nope"},
+		{`{{printf "%s-%s" .site .nope}}`, "nope"},
+		{`{{upper (printf "%s" .nope)}}`, "nope"},
+		{`{{if .site}}{{.nope}}{{end}}`, "nope"},
+		{`{{if .nope}}x{{else}}{{.other}}{{end}}`, "other"},
+		{`{{range .list}}{{$.nope}}{{end}}`, "nope"},
+		{`{{$v := .nope}}{{$v}}`, "nope"},
+
+		{`{{.site}}-{{.wan.ip}}`, ""},
+		{`{{default "x" .nope}}`, ""},
+		{`{{.nope | default "x" | upper}}`, ""},
+		{`{{if .nope}}{{.nope}}{{end}}`, ""},
+		{`{{if .nope}}{{.nope.deep}}{{end}}`, ""},
+		{`{{if haskey . "nope"}}{{.nope}}{{end}}`, ""},
+		{`{{with .nope}}{{.anything}}{{end}}`, ""},
+		{`{{range .nope}}{{.name}}{{end}}`, ""},
+		{`{{if and .site (eq .nope "x")}}y{{end}}`, ""},
+	} {
+		_, err := ApplyVarsWith(map[string]any{"v": c.tpl}, vars, VarsOptions{Strict: true})
+		var errs VarErrors
+		switch {
+		case c.miss == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", c.tpl, err)
+		case c.miss == "":
+		case !errors.As(err, &errs) || len(errs) != 1 || errs[0].Path != "/v" || errs[0].Msg != `unresolved variable "`+c.miss+`"`:
+			t.Errorf("%s: got %v, want unresolved variable %q at /v", c.tpl, err, c.miss)
+		}
+	}
+}
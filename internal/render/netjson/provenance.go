@@ -0,0 +1,115 @@
+package netjson
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Origin — источник значения в результате Merge.
+type Origin struct {
+	Source   string `json:"source"`
+	Priority int    `json:"priority"`
+	Var      string `json:"var,omitempty"` // путь $var или "template", если значение подставил ApplyVars
+}
+
+// Provenance — JSON pointer скалярного значения результата ("/firewall/rules/0/dest_port") → источник.
+// Пустые объекты и массивы в неё не попадают.
+type Provenance map[string]Origin
+
+// MergeWithProvenance — Merge плюс происхождение каждого значения результата.
+func MergeWithProvenance(sources ...Source) (map[string]any, Provenance, error) {
+	out, origins, err := merge(sources)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := Provenance{}
+	p.collect("", out, origins)
+	return out, p, nil
+}
+
+func (p Provenance) collect(ptr string, v, o any) {
+	switch t := v.(type) {
+	case map[string]any:
+		om, _ := o.(map[string]any)
+		for k, x := range t {
+			p.collect(ptr+"/"+escapePointer(k), x, om[k])
+		}
+	case []any:
+		os, _ := o.([]any)
+		for i, x := range t {
+			var xo any
+			if i < len(os) {
+				xo = os[i]
+			}
+			p.collect(fmt.Sprintf("%s/%d", ptr, i), x, xo)
+		}
+	default:
+		if org, ok := o.(*Origin); ok {
+			p[ptr] = *org
+		}
+	}
+}
+
+// vars отмечает значения, которые ApplyVarsWith подставил в after вместо before: источник
+// остаётся тем шаблоном, где стоял {"$var": ...} или строка с {{ }}, Var — путь переменной.
+func (p Provenance) vars(ptr string, before, after any, vars map[string]any) {
+	switch t := before.(type) {
+	case map[string]any:
+		if path, ok := t["$var"].(string); ok {
+			org, ok := p[ptr+"/$var"]
+			if !ok {
+				return
+			}
+			if am, still := after.(map[string]any); still && am["$var"] == path {
+				return // переменной нет и default нет — объект остался как был
+			}
+			org.Var = path
+			if _, found := lookup(vars, path); !found {
+				org.Var += " (default)"
+			}
+			for k := range p {
+				if strings.HasPrefix(k, ptr+"/") {
+					delete(p, k)
+				}
+			}
+			leaves(ptr, after, func(q string) { p[q] = org })
+			return
+		}
+		am, _ := after.(map[string]any)
+		for k, x := range t {
+			p.vars(ptr+"/"+escapePointer(k), x, am[k], vars)
+		}
+	case []any:
+		as, _ := after.([]any)
+		for i, x := range t {
+			if i < len(as) {
+				p.vars(fmt.Sprintf("%s/%d", ptr, i), x, as[i], vars)
+			}
+		}
+	case string:
+		if org, ok := p[ptr]; ok && strings.Contains(t, "{{") && after != before {
+			org.Var = "template"
+			p[ptr] = org
+		}
+	}
+}
+
+// leaves вызывает fn для pointer каждого скалярного значения v.
+func leaves(ptr string, v any, fn func(string)) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, x := range t {
+			leaves(ptr+"/"+escapePointer(k), x, fn)
+		}
+	case []any:
+		for i, x := range t {
+			leaves(fmt.Sprintf("%s/%d", ptr, i), x, fn)
+		}
+	default:
+		fn(ptr)
+	}
+}
+
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
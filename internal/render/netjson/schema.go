@@ -0,0 +1,358 @@
+package netjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema — ConfigTemplate.VarsSchema: подмножество JSON Schema для переменных устройства,
+// которые нужны шаблону:
+//
+//	{"type": "object", "required": ["wan_ip"], "properties": {
+//	  "wan_ip":  {"type": "string", "format": "cidr", "title": "WAN address"},
+//	  "vlan":    {"type": "integer", "minimum": 1, "maximum": 4094, "default": 10},
+//	  "country": {"enum": ["DE", "US"]}}}
+//
+// Ключевые слова: type (строка или список), properties, required, additionalProperties (bool),
+// items, enum, const, minimum/maximum, minLength/maxLength, pattern, minItems/maxItems, format
+// (ipv4, ipv6, ip, cidr, mac, hostname; неизвестные format не проверяются); title и description —
+// для формы в админке, default — и для формы, и как значение переменной, которой у устройства
+// нет (см. Defaults). Остальные ключевые слова игнорируются, как требует JSON Schema.
+type Schema struct {
+	Types       []string
+	Title       string
+	Description string
+	Default     any
+
+	Properties           map[string]*Schema
+	Required             []string
+	AdditionalProperties *bool
+	Items                *Schema
+
+	Enum                 []any
+	Const                any
+	HasConst             bool
+	Minimum, Maximum     *float64
+	MinLength, MaxLength *int
+	MinItems, MaxItems   *int
+	Pattern              *regexp.Regexp
+	Format               string
+}
+
+var schemaTypes = map[string]bool{
+	"string": true, "integer": true, "number": true, "boolean": true, "object": true, "array": true, "null": true,
+}
+
+// ParseSchema разбирает VarsSchema шаблона; корень — объект (type "object" или без type).
+// Пустой raw — нет схемы (nil, nil).
+func ParseSchema(raw []byte) (*Schema, error) {
+	if len(strings.TrimSpace(string(raw))) == 0 {
+		return nil, nil
+	}
+	var m any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("netjson: vars schema: %w", err)
+	}
+	if m == nil {
+		return nil, nil
+	}
+	s, err := parseSchema("", m)
+	if err != nil {
+		return nil, fmt.Errorf("netjson: vars schema: %w", err)
+	}
+	if len(s.Types) > 0 && !s.allows("object") {
+		return nil, fmt.Errorf("netjson: vars schema: root must be of type object")
+	}
+	return s, nil
+}
+
+func parseSchema(ptr string, raw any) (*Schema, error) {
+	at := func(format string, args ...any) error {
+		p := ptr
+		if p == "" {
+			p = "/"
+		}
+		return fmt.Errorf("%s: %s", p, fmt.Sprintf(format, args...))
+	}
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, at("schema must be an object")
+	}
+	s := &Schema{Default: m["default"]}
+	switch t := m["type"].(type) {
+	case nil:
+	case string:
+		s.Types = []string{t}
+	case []any:
+		for _, x := range t {
+			name, _ := x.(string)
+			s.Types = append(s.Types, name)
+		}
+	default:
+		return nil, at("type must be a string or a list of strings")
+	}
+	for _, t := range s.Types {
+		if !schemaTypes[t] {
+			return nil, at("unknown type %q", t)
+		}
+	}
+	var err error
+	if s.Title, err = schemaString(m, "title"); err != nil {
+		return nil, at("%v", err)
+	}
+	if s.Description, err = schemaString(m, "description"); err != nil {
+		return nil, at("%v", err)
+	}
+	if s.Format, err = schemaString(m, "format"); err != nil {
+		return nil, at("%v", err)
+	}
+	if p, err := schemaString(m, "pattern"); err != nil {
+		return nil, at("%v", err)
+	} else if p != "" {
+		if s.Pattern, err = regexp.Compile(p); err != nil {
+			return nil, at("pattern: %v", err)
+		}
+	}
+	for key, dst := range map[string]**float64{"minimum": &s.Minimum, "maximum": &s.Maximum} {
+		if v, ok := m[key]; ok {
+			f, ok := v.(float64)
+			if !ok {
+				return nil, at("%s must be a number", key)
+			}
+			*dst = &f
+		}
+	}
+	for key, dst := range map[string]**int{
+		"minLength": &s.MinLength, "maxLength": &s.MaxLength, "minItems": &s.MinItems, "maxItems": &s.MaxItems,
+	} {
+		if v, ok := m[key]; ok {
+			f, ok := v.(float64)
+			if !ok || f < 0 || f != math.Trunc(f) {
+				return nil, at("%s must be a non-negative integer", key)
+			}
+			n := int(f)
+			*dst = &n
+		}
+	}
+	if v, ok := m["enum"]; ok {
+		if s.Enum, ok = v.([]any); !ok || len(s.Enum) == 0 {
+			return nil, at("enum must be a non-empty list")
+		}
+	}
+	s.Const, s.HasConst = m["const"]
+	if v, ok := m["required"]; ok {
+		list, ok := v.([]any)
+		if !ok {
+			return nil, at("required must be a list of strings")
+		}
+		for _, x := range list {
+			name, ok := x.(string)
+			if !ok {
+				return nil, at("required must be a list of strings")
+			}
+			s.Required = append(s.Required, name)
+		}
+	}
+	if v, ok := m["additionalProperties"]; ok {
+		b, ok := v.(bool)
+		if !ok {
+			return nil, at("additionalProperties must be a boolean")
+		}
+		s.AdditionalProperties = &b
+	}
+	if v, ok := m["properties"]; ok {
+		props, ok := v.(map[string]any)
+		if !ok {
+			return nil, at("properties must be an object")
+		}
+		s.Properties = make(map[string]*Schema, len(props))
+		for name, p := range props {
+			if s.Properties[name], err = parseSchema(ptr+"/properties/"+escapePointer(name), p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if v, ok := m["items"]; ok {
+		if s.Items, err = parseSchema(ptr+"/items", v); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func schemaString(m map[string]any, key string) (string, error) {
+	v, ok := m[key]
+	if !ok {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", key)
+	}
+	return s, nil
+}
+
+func (s *Schema) allows(t string) bool {
+	for _, x := range s.Types {
+		if x == t || (x == "number" && t == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// Defaults дописывает в vars default отсутствующих переменных (и полей вложенных объектов,
+// если сам объект задан; вложенные объекты копируются). Заданные значения не трогаются.
+func (s *Schema) Defaults(vars map[string]any) {
+	for name, ps := range s.Properties {
+		v, ok := vars[name]
+		if !ok {
+			if ps.Default != nil {
+				vars[name] = ps.Default
+			}
+			continue
+		}
+		if m, ok := v.(map[string]any); ok && len(ps.Properties) > 0 {
+			cp := make(map[string]any, len(m)) // вложенный объект может быть общим с Device.Vars
+			for k, x := range m {
+				cp[k] = x
+			}
+			ps.Defaults(cp)
+			vars[name] = cp
+		}
+	}
+}
+
+// Validate проверяет переменные устройства; Path ошибок — JSON Pointer внутри vars.
+func (s *Schema) Validate(vars map[string]any) VarErrors {
+	var errs VarErrors
+	s.validate(&errs, "", vars)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	return errs
+}
+
+func (s *Schema) validate(errs *VarErrors, ptr string, v any) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, &VarError{Path: ptr, Msg: fmt.Sprintf(format, args...)})
+	}
+	if t := typeOf(v); len(s.Types) > 0 && !s.allows(t) {
+		fail("must be %s, got %s", strings.Join(s.Types, " or "), t)
+		return
+	}
+	if s.HasConst && !jsonEqual(v, s.Const) {
+		fail("must be %s", jsonText(s.Const))
+	}
+	if len(s.Enum) > 0 {
+		ok := false
+		for _, e := range s.Enum {
+			ok = ok || jsonEqual(v, e)
+		}
+		if !ok {
+			opts := make([]string, len(s.Enum))
+			for i, e := range s.Enum {
+				opts[i] = jsonText(e)
+			}
+			fail("must be one of %s", strings.Join(opts, ", "))
+		}
+	}
+	switch t := v.(type) {
+	case string:
+		n := len([]rune(t))
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.Pattern != nil && !s.Pattern.MatchString(t) {
+			fail("must match %s", s.Pattern)
+		}
+		if f := formats[s.Format]; f != nil && !f(t) {
+			fail("must be a valid %s", s.Format)
+		}
+	case float64:
+		if s.Minimum != nil && t < *s.Minimum {
+			fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && t > *s.Maximum {
+			fail("must be <= %v", *s.Maximum)
+		}
+	case []any:
+		if s.MinItems != nil && len(t) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(t) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, x := range t {
+				s.Items.validate(errs, fmt.Sprintf("%s/%d", ptr, i), x)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := t[name]; !ok {
+				*errs = append(*errs, &VarError{Path: ptr + "/" + escapePointer(name), Msg: "required variable is missing"})
+			}
+		}
+		for name, x := range t {
+			p := ptr + "/" + escapePointer(name)
+			if ps, ok := s.Properties[name]; ok {
+				ps.validate(errs, p, x)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties && ptr != "" {
+				// в корне лежат и чужие переменные (других шаблонов, встроенные) — там не проверяем
+				*errs = append(*errs, &VarError{Path: p, Msg: "unknown property"})
+			}
+		}
+	}
+}
+
+// typeOf — тип значения JSON в терминах JSON Schema.
+func typeOf(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if t == math.Trunc(t) {
+			return "integer"
+		}
+		return "number"
+	case int, int64:
+		return "integer"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func jsonText(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func jsonEqual(a, b any) bool { return jsonText(a) == jsonText(b) }
+
+var hostnameRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*$`)
+
+var formats = map[string]func(string) bool{
+	"ipv4": func(s string) bool { a, err := netip.ParseAddr(s); return err == nil && a.Is4() },
+	"ipv6": func(s string) bool { a, err := netip.ParseAddr(s); return err == nil && a.Is6() },
+	"ip":   func(s string) bool { _, err := netip.ParseAddr(s); return err == nil },
+	"cidr": func(s string) bool { _, err := netip.ParsePrefix(s); return err == nil },
+	"mac":  func(s string) bool { _, err := net.ParseMAC(s); return err == nil },
+	"hostname": func(s string) bool {
+		return len(s) <= 253 && hostnameRe.MatchString(s)
+	},
+}
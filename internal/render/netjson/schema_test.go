@@ -0,0 +1,43 @@
+package netjson
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaDefaults(t *testing.T) {
+	s, err := ParseSchema([]byte(`{"properties": {
+		"vlan": {"type": "integer", "default": 10},
+		"wan_ip": {"type": "string", "format": "cidr"},
+		"ntp": {"type": "object", "properties": {"server": {"default": "pool.ntp.org"}, "enabled": {"default": true}}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ntp := map[string]any{"enabled": false}
+	vars := map[string]any{"ntp": ntp}
+	s.Defaults(vars)
+	want := map[string]any{"vlan": 10.0, "ntp": map[string]any{"enabled": false, "server": "pool.ntp.org"}}
+	if !reflect.DeepEqual(vars, want) {
+		t.Fatalf("vars = %v, want %v", vars, want)
+	}
+	if len(ntp) != 1 {
+		t.Fatalf("nested object of the caller modified: %v", ntp)
+	}
+	if errs := s.Validate(vars); len(errs) > 0 {
+		t.Fatalf("Validate: %v", errs)
+	}
+}
+
+func TestParseSchemaUnknownFormat(t *testing.T) {
+	// неизвестный format не ошибка и не проверяется (как в JSON Schema)
+	s, err := ParseSchema([]byte(`{"properties": {"site": {"type": "string", "format": "uri"}, "ip": {"format": "ipv4"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := s.Validate(map[string]any{"site": "not a uri"}); len(errs) > 0 {
+		t.Fatalf("Validate: %v", errs)
+	}
+	if errs := s.Validate(map[string]any{"ip": "::1"}); len(errs) != 1 || errs[0].Path != "/ip" {
+		t.Fatalf("Validate = %v, want one error at /ip", errs)
+	}
+}
@@ -0,0 +1,225 @@
+package netjson
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MergeKey — служебный ключ шаблона с переопределением стратегий массивов (в результат не попадает):
+//
+//	"$merge": {"firewall.rules": "append", "network.interfaces": "replace", "wireless.interfaces": "key:device,ssid"}
+//
+// Путь — ключи объектов через точку, индексы массивов не пишутся: "network.bridges.vlans" —
+// массив vlans внутри элементов network.bridges. Переопределение действует, когда этот шаблон
+// накатывается поверх уже слитого результата.
+const MergeKey = "$merge"
+
+// Режимы слияния массивов.
+const (
+	Replace = "replace" // массив шаблона заменяет накопленный целиком
+	Append  = "append"  // элементы дописываются в конец; одинаковые скаляры не дублируются
+	ByKey   = "key"     // элементы с тем же ключом сливаются глубоко, остальные дописываются
+)
+
+// Strategy — как сливается массив по пути.
+type Strategy struct {
+	Mode string
+	Keys []string // для ByKey: поля, по которым сопоставляются элементы
+}
+
+func (s Strategy) String() string {
+	if s.Mode == ByKey {
+		return ByKey + ":" + strings.Join(s.Keys, ",")
+	}
+	return s.Mode
+}
+
+// ParseStrategy разбирает "replace", "append" или "key:<field>[,<field>...]".
+func ParseStrategy(s string) (Strategy, error) {
+	mode, keys, _ := strings.Cut(strings.TrimSpace(s), ":")
+	switch mode {
+	case Replace, Append:
+		if keys != "" {
+			return Strategy{}, fmt.Errorf("strategy %q takes no keys", mode)
+		}
+		return Strategy{Mode: mode}, nil
+	case ByKey:
+		st := Strategy{Mode: ByKey}
+		for _, k := range strings.Split(keys, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				st.Keys = append(st.Keys, k)
+			}
+		}
+		if len(st.Keys) == 0 {
+			return Strategy{}, fmt.Errorf("strategy key needs fields, e.g. key:name")
+		}
+		return st, nil
+	}
+	return Strategy{}, fmt.Errorf("unknown merge strategy %q (replace, append, key:<field>)", s)
+}
+
+func byKey(keys ...string) Strategy { return Strategy{Mode: ByKey, Keys: keys} }
+
+// DefaultStrategies — стратегии для массивов NetJSON, которые понимают рендереры.
+// Массивы, которых здесь нет (ip_rules, списки внутри правил), заменяются целиком.
+var DefaultStrategies = map[string]Strategy{
+	"interfaces":            byKey("name"),
+	"dns_servers":           {Mode: Append},
+	"dns_search":            {Mode: Append},
+	"routes":                byKey("destination", "table"),
+	"files":                 byKey("path"),
+	"network.interfaces":    byKey("name"),
+	"network.bridges":       byKey("name"),
+	"network.bridges.vlans": byKey("vid"),
+	"network.routes":        byKey("destination", "table"),
+	"system.leds":           byKey("name"),
+	"system.ntp.servers":    {Mode: Append},
+	"wireless.radios":       byKey("name"),
+	"wireless.interfaces":   byKey("device", "ssid"),
+	"wireguard.peers":       byKey("public_key"),
+	"firewall.zones":        byKey("name"),
+	"firewall.forwardings":  byKey("src", "dest"),
+	"firewall.rules":        byKey("name"),
+	"firewall.redirects":    byKey("name"),
+	"firewall.ipsets":       byKey("name"),
+	"firewall.includes":     byKey("path"),
+	"dhcp.servers":          byKey("interface"),
+	"dhcp.hosts":            byKey("name"),
+	"dhcp.domains":          byKey("name"),
+	"mwan3.interfaces":      byKey("name"),
+	"mwan3.members":         byKey("name"),
+	"mwan3.policies":        byKey("name"),
+	"mwan3.rules":           byKey("name"),
+}
+
+// strategies — DefaultStrategies, перекрытые блоком $merge источника.
+func strategies(v any) (map[string]Strategy, error) {
+	out := make(map[string]Strategy, len(DefaultStrategies))
+	for k, s := range DefaultStrategies {
+		out[k] = s
+	}
+	if v == nil {
+		return out, nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected object", MergeKey)
+	}
+	for path, raw := range m {
+		s, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s[%s]: expected string", MergeKey, path)
+		}
+		st, err := ParseStrategy(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%s]: %w", MergeKey, path, err)
+		}
+		out[path] = st
+	}
+	return out, nil
+}
+
+// slice сливает массив src поверх dst по стратегии пути path; dstO — происхождение элементов dst.
+func (m *merger) slice(dst, dstO, src []any, path string) ([]any, []any) {
+	st, ok := m.strat[path]
+	if !ok || st.Mode == Replace {
+		out := strip(src).([]any)
+		return out, m.tag(out).([]any)
+	}
+	out := append([]any(nil), dst...)
+	outO := make([]any, len(out))
+	copy(outO, dstO)
+	remove := func(j int) {
+		out = append(out[:j], out[j+1:]...)
+		outO = append(outO[:j], outO[j+1:]...)
+	}
+	for _, x := range src {
+		switch st.Mode {
+		case Append:
+			if del, ok := deleteScalar(x); ok {
+				if j := indexScalar(out, del); j >= 0 {
+					remove(j)
+				}
+				continue
+			}
+			if indexScalar(out, x) >= 0 {
+				continue
+			}
+		case ByKey:
+			j := indexKey(out, x, st.Keys)
+			switch {
+			case j >= 0 && isDelete(x):
+				remove(j)
+				continue
+			case j >= 0 && isReplace(x):
+				out[j] = strip(x)
+				outO[j] = m.tag(out[j])
+				continue
+			case j >= 0:
+				dO, _ := outO[j].(map[string]any)
+				out[j], outO[j] = m.merge(out[j].(map[string]any), dO, x.(map[string]any), path)
+				continue
+			}
+		}
+		if _, ok := deleteScalar(x); ok || isDelete(x) {
+			continue // удалять нечего
+		}
+		y := strip(x)
+		out = append(out, y)
+		outO = append(outO, m.tag(y))
+	}
+	return out, outO
+}
+
+// indexKey — индекс элемента out с тем же ключом, что у x, или -1.
+func indexKey(out []any, x any, keys []string) int {
+	k, ok := itemKey(x, keys)
+	if !ok {
+		return -1
+	}
+	for i := range out {
+		if k2, ok2 := itemKey(out[i], keys); ok2 && k2 == k {
+			return i
+		}
+	}
+	return -1
+}
+
+// itemKey — ключ элемента: значения полей keys; элемент без единого ключевого поля не сопоставляется.
+func itemKey(x any, keys []string) (string, bool) {
+	m, ok := x.(map[string]any)
+	if !ok {
+		return "", false
+	}
+	parts := make([]string, len(keys))
+	found := false
+	for i, k := range keys {
+		if v, ok := m[k]; ok && v != nil {
+			parts[i] = fmt.Sprint(v)
+			found = true
+		}
+	}
+	return strings.Join(parts, "\x00"), found
+}
+
+// indexScalar — индекс такого же скаляра в xs или -1; объекты и массивы не сравниваются
+// (и не дедуплицируются в Append).
+func indexScalar(xs []any, x any) int {
+	if !isScalar(x) {
+		return -1
+	}
+	for i, y := range xs {
+		if isScalar(y) && y == x {
+			return i
+		}
+	}
+	return -1
+}
+
+func isScalar(x any) bool {
+	switch x.(type) {
+	case map[string]any, []any:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package netjson
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeAppendNestedArrays(t *testing.T) {
+	// массивы и объекты внутри append-массива не сравниваются (раньше — panic на ==)
+	got, err := Merge(
+		Source{Name: "a", Priority: 1, JSON: map[string]any{"dns_servers": []any{[]any{"x"}, "1.1.1.1"}}},
+		Source{Name: "b", Priority: 2, JSON: map[string]any{"dns_servers": []any{[]any{"y"}, "1.1.1.1", []any{"x"}}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{[]any{"x"}, "1.1.1.1", []any{"y"}, []any{"x"}}
+	if !reflect.DeepEqual(got["dns_servers"], want) {
+		t.Fatalf("dns_servers = %v, want %v", got["dns_servers"], want)
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Strategy
+		err  bool
+	}{
+		{in: "replace", want: Strategy{Mode: Replace}},
+		{in: "append", want: Strategy{Mode: Append}},
+		{in: "key:name", want: Strategy{Mode: ByKey, Keys: []string{"name"}}},
+		{in: "key: device , ssid", want: Strategy{Mode: ByKey, Keys: []string{"device", "ssid"}}},
+		{in: "key:", err: true},
+		{in: "append:x", err: true},
+		{in: "merge", err: true},
+	}
+	for _, c := range cases {
+		got, err := ParseStrategy(c.in)
+		if (err != nil) != c.err {
+			t.Errorf("ParseStrategy(%q) err = %v", c.in, err)
+			continue
+		}
+		if !c.err && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseStrategy(%q) = %+v, want %+v", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,607 @@
+package networkd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"wisp/internal/render/uci"
+)
+
+// link — один netdev и его .network. systemd-networkd применяет к интерфейсу только первый
+// подходящий .network, поэтому логические интерфейсы на одном netdev (lan + lan6) сливаются сюда.
+type link struct {
+	name         string
+	dhcp4, dhcp6 bool
+	addrs, gws   []string
+	dns, domains []string
+	vlans        []string // VLAN-netdev поверх этого линка (VLAN=)
+	bridge       string   // мост, портом которого является линк (Bridge=)
+	mtu          int
+	mac          string
+	down         bool
+	extra        []*section // [Route], [RoutingPolicyRule], [BridgeVLAN] в порядке добавления
+}
+
+// netdev — виртуальное устройство (.netdev): vlan, bridge, wireguard.
+type netdev struct {
+	name string
+	u    *unit
+	mode int
+}
+
+// maxIfName — IFNAMSIZ-1: длиннее ядро не примет.
+const maxIfName = 15
+
+func (c *context) link(name string) *link {
+	if l, ok := c.links[name]; ok {
+		return l
+	}
+	l := &link{name: name}
+	c.links[name] = l
+	c.order = append(c.order, name)
+	return l
+}
+
+func (c *context) hasNetdev(name string) bool {
+	for _, d := range c.netdevs {
+		if d.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *context) addNetdev(name, kind string, mode int) (*unit, error) {
+	if len(name) > maxIfName {
+		return nil, fmt.Errorf("interface name %q longer than %d characters", name, maxIfName)
+	}
+	if c.hasNetdev(name) {
+		return nil, fmt.Errorf("duplicate netdev %q", name)
+	}
+	u := &unit{}
+	u.get("NetDev").set("Name", name).set("Kind", kind)
+	c.netdevs = append(c.netdevs, netdev{name: name, u: u, mode: mode})
+	c.link(name)
+	return u, nil
+}
+
+// vlan — netdev <parent>.<vid> (один на пару) и VLAN= у родителя.
+func (c *context) vlan(parent string, vid int) (string, error) {
+	if vid < 1 || vid > 4094 {
+		return "", fmt.Errorf("vlan must be 1..4094")
+	}
+	name := fmt.Sprintf("%s.%d", parent, vid)
+	if c.hasNetdev(name) {
+		return name, nil
+	}
+	u, err := c.addNetdev(name, "vlan", 0644)
+	if err != nil {
+		return "", err
+	}
+	u.add("VLAN").set("Id", strconv.Itoa(vid))
+	p := c.link(parent)
+	p.vlans = append(p.vlans, name)
+	return name, nil
+}
+
+// netdevFor — netdev для логического имени (lan → br-lan); неизвестное имя считается netdev.
+func (c *context) netdevFor(name string) string {
+	if d, ok := c.aliases[name]; ok {
+		return d
+	}
+	return name
+}
+
+// ===== network =====
+func (c *context) renderNetwork(v any) error {
+	netw, _ := uci.AsMap(v)
+	if err := c.renderBridges(netw); err != nil {
+		return err
+	}
+	renderIface := func(m map[string]any, p []any) error {
+		if _, ok := m["addresses"]; ok {
+			return c.netjsonInterface(m, p)
+		}
+		if _, ok := m["type"]; ok {
+			return c.netjsonInterface(m, p)
+		}
+		return c.flatInterface(m, p)
+	}
+	if err := uci.EachItem(netw["interfaces"], []any{"network", "interfaces"}, renderIface); err != nil {
+		return err
+	}
+	if err := uci.EachItem(c.nj["interfaces"], []any{"interfaces"}, renderIface); err != nil {
+		return err
+	}
+
+	// dns_servers/dns_search — как у OpenWrt: на интерфейсы со статическими адресами
+	dns := uci.StrList(c.nj["dns_servers"])
+	for i, d := range dns {
+		if net.ParseIP(d) == nil {
+			c.Invalid(uci.Pointer("dns_servers", i), "%q is not an IP address", d)
+		}
+	}
+	for _, name := range c.order {
+		if l := c.links[name]; len(l.addrs) > 0 && name != "lo" {
+			l.dns = append(l.dns, dns...)
+			l.domains = append(l.domains, uci.StrList(c.nj["dns_search"])...)
+		}
+	}
+
+	for _, rt := range []struct {
+		v    any
+		path []any
+		fn   func(m map[string]any) error
+	}{
+		{netw["routes"], []any{"network", "routes"}, c.route},
+		{c.nj["routes"], []any{"routes"}, c.route},
+		{netw["ip_rules"], []any{"network", "ip_rules"}, c.ipRule},
+		{c.nj["ip_rules"], []any{"ip_rules"}, c.ipRule},
+	} {
+		err := uci.EachItem(rt.v, rt.path, func(m map[string]any, p []any) error {
+			if err := rt.fn(m); err != nil {
+				return uci.At(err, p...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flatInterface — { name, device, vlan, proto, ipaddr, netmask, gateway, ip6addr[], ip6gw, dns[], mtu, disabled }.
+// Поддерживаются proto static/dhcp/dhcpv6/none; pppoe и прочие netifd-протоколы — только OpenWrt.
+func (c *context) flatInterface(m map[string]any, p []any) error {
+	name := uci.GetString(m, "name", "")
+	if name == "" {
+		c.Invalid(uci.Pointer(p...), "interface without name is skipped")
+		return nil
+	}
+	dev := uci.GetString(m, "device", name)
+	if vid := uci.GetInt(m, "vlan", 0); vid != 0 {
+		var err error
+		if dev, err = c.vlan(dev, vid); err != nil {
+			return uci.At(err, append(p, "vlan")...)
+		}
+	}
+	if len(dev) > maxIfName {
+		return uci.At(fmt.Errorf("interface name %q longer than %d characters", dev, maxIfName), p...)
+	}
+	c.aliases[name] = dev
+	l := c.link(dev)
+
+	switch proto := uci.GetString(m, "proto", "static"); proto {
+	case "static":
+		if ip := uci.GetString(m, "ipaddr", ""); ip != "" {
+			cidr, err := v4CIDR(ip, uci.GetString(m, "netmask", "255.255.255.0"))
+			if err != nil {
+				return uci.At(err, append(p, "ipaddr")...)
+			}
+			l.addrs = append(l.addrs, cidr)
+		}
+		for i, a := range uci.StrList(m["ip6addr"]) {
+			if _, _, err := net.ParseCIDR(a); err != nil {
+				return uci.At(fmt.Errorf("%q is not a CIDR prefix", a), append(p, "ip6addr", i)...)
+			}
+			l.addrs = append(l.addrs, a)
+		}
+		for _, k := range []string{"gateway", "ip6gw"} {
+			if gw := uci.GetString(m, k, ""); gw != "" {
+				if net.ParseIP(gw) == nil {
+					return uci.At(fmt.Errorf("%q is not an IP address", gw), append(p, k)...)
+				}
+				l.gws = append(l.gws, gw)
+			}
+		}
+		if len(l.addrs) == 0 {
+			c.Invalid(uci.Pointer(p...), "static interface %s has no address", name)
+		}
+	case "dhcp":
+		l.dhcp4 = true
+	case "dhcpv6":
+		l.dhcp6 = true
+	case "none":
+	default:
+		return uci.At(fmt.Errorf("proto %q is not supported by networkd backend", proto), append(p, "proto")...)
+	}
+	for i, d := range uci.StrList(m["dns"]) {
+		if net.ParseIP(d) == nil {
+			c.Invalid(uci.Pointer(append(p, "dns", i)...), "%q is not an IP address", d)
+		}
+		l.dns = append(l.dns, d)
+	}
+	if mtu := uci.GetInt(m, "mtu", 0); mtu > 0 {
+		l.mtu = mtu
+	}
+	l.down = l.down || uci.GetBool(m, "disabled", false)
+	return nil
+}
+
+// netjsonInterface — схема netjsonconfig: name — netdev, network — логическое имя,
+// type bridge собирает bridge_members, addresses — static/dhcp по семействам.
+func (c *context) netjsonInterface(m map[string]any, p []any) error {
+	dev := uci.GetString(m, "name", "")
+	if dev == "" {
+		return uci.At(fmt.Errorf("interface without name"), p...)
+	}
+	if len(dev) > maxIfName {
+		return uci.At(fmt.Errorf("interface name %q longer than %d characters", dev, maxIfName), p...)
+	}
+	logical := uci.GetString(m, "network", strings.NewReplacer("-", "_", ".", "_").Replace(dev))
+	c.aliases[logical] = dev
+	c.aliases[dev] = dev
+
+	switch typ := uci.GetString(m, "type", "ethernet"); typ {
+	case "bridge":
+		if !c.hasNetdev(dev) {
+			if _, err := c.addNetdev(dev, "bridge", 0644); err != nil {
+				return uci.At(err, p...)
+			}
+		}
+		for _, port := range uci.StrList(m["bridge_members"]) {
+			c.link(port).bridge = dev
+		}
+	case "ethernet", "wireless", "virtual", "loopback", "other":
+	default:
+		return uci.At(fmt.Errorf("unknown type %q", typ), append(p, "type")...)
+	}
+	l := c.link(dev)
+
+	err := uci.EachItem(m["addresses"], append(p, "addresses"), func(am map[string]any, ap []any) error {
+		proto, family := uci.GetString(am, "proto", "static"), uci.GetString(am, "family", "")
+		addr := uci.GetString(am, "address", "")
+		if family == "" {
+			family = uci.AddrFamily(addr)
+		}
+		switch {
+		case proto == "dhcp" && family == "ipv6":
+			l.dhcp6 = true
+		case proto == "dhcp":
+			l.dhcp4 = true
+		case proto == "none":
+		case proto == "static":
+			if f := uci.AddrFamily(addr); f == "" || (family != "" && f != family) {
+				return uci.At(fmt.Errorf("%q is not an %s address", addr, family), ap...)
+			}
+			bits := 32
+			if family == "ipv6" {
+				bits = 128
+			}
+			mask := uci.GetInt(am, "mask", min(bits, 64))
+			if mask < 0 || mask > bits {
+				return uci.At(fmt.Errorf("bad mask %d", mask), ap...)
+			}
+			l.addrs = append(l.addrs, fmt.Sprintf("%s/%d", addr, mask))
+			if gw := uci.GetString(am, "gateway", ""); gw != "" {
+				l.gws = append(l.gws, gw)
+			}
+		default:
+			return uci.At(fmt.Errorf("unsupported proto %q", proto), ap...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if mtu := uci.GetInt(m, "mtu", 0); mtu > 0 {
+		l.mtu = mtu
+	}
+	if mac := uci.GetString(m, "mac", ""); mac != "" {
+		l.mac = mac
+	}
+	l.down = l.down || !uci.GetBool(m, "autostart", true) || uci.GetBool(m, "disabled", false)
+	return nil
+}
+
+// renderBridges — network.bridges (схема та же, что у uci, см. bridges.go там):
+// bridge netdev; с vlans — VLANFiltering и [BridgeVLAN] на портах и на самом мосту.
+func (c *context) renderBridges(netw map[string]any) error {
+	return uci.EachItem(netw["bridges"], []any{"network", "bridges"}, func(m map[string]any, p []any) error {
+		name := uci.GetString(m, "name", "")
+		if name == "" {
+			return uci.At(fmt.Errorf("name is required"), p...)
+		}
+		u, err := c.addNetdev(name, "bridge", 0644)
+		if err != nil {
+			return uci.At(err, p...)
+		}
+		if mtu := uci.GetInt(m, "mtu", 0); mtu > 0 {
+			u.get("NetDev").set("MTUBytes", strconv.Itoa(mtu))
+		}
+		u.get("NetDev").set("MACAddress", uci.GetString(m, "mac", ""))
+		c.aliases[name] = name
+		for _, port := range uci.StrList(m["ports"]) {
+			c.link(port).bridge = name
+		}
+
+		items, _ := uci.AsSlice(m["vlans"])
+		if len(items) == 0 {
+			return nil
+		}
+		u.add("Bridge").set("VLANFiltering", "yes").set("DefaultPVID", "none")
+		self := c.link(name)
+		seen := map[int]bool{}
+		for i, it := range items {
+			vm, _ := uci.AsMap(it)
+			vid := uci.GetInt(vm, "vid", 0)
+			if vid < 1 || vid > 4094 {
+				return uci.At(fmt.Errorf("vid must be 1..4094"), append(p, "vlans", i)...)
+			}
+			if seen[vid] {
+				return uci.At(fmt.Errorf("duplicate vid %d", vid), append(p, "vlans", i)...)
+			}
+			seen[vid] = true
+			// сам мост (CPU) — tagged-член каждого VLAN, чтобы на нём жили <bridge>.<vid>
+			self.extra = append(self.extra, (&section{name: "BridgeVLAN"}).set("VLAN", strconv.Itoa(vid)))
+			ports, _ := uci.AsSlice(vm["ports"])
+			for _, pt := range ports {
+				var port string
+				var tagged, pvid bool
+				switch t := pt.(type) {
+				case string: // "lan1", "lan1:t", "lan1:u*" — как в OpenWrt
+					var flags string
+					port, flags, _ = strings.Cut(t, ":")
+					tagged, pvid = strings.Contains(flags, "t"), strings.Contains(flags, "*")
+				case map[string]any:
+					port, tagged, pvid = uci.GetString(t, "name", ""), uci.GetBool(t, "tagged", false), uci.GetBool(t, "pvid", false)
+				}
+				if port == "" {
+					return uci.At(fmt.Errorf("port without name"), append(p, "vlans", i)...)
+				}
+				s := (&section{name: "BridgeVLAN"}).set("VLAN", strconv.Itoa(vid))
+				if pvid {
+					s.set("PVID", strconv.Itoa(vid))
+				}
+				if !tagged {
+					s.set("EgressUntagged", strconv.Itoa(vid))
+				}
+				l := c.link(port)
+				l.bridge = name
+				l.extra = append(l.extra, s)
+			}
+		}
+		return nil
+	})
+}
+
+// route — routes[]: device — логический интерфейс (lan/wan), как у OpenWrt.
+func (c *context) route(m map[string]any) error {
+	dev := uci.GetString(m, "interface", uci.GetString(m, "device", ""))
+	dest := uci.GetString(m, "destination", "")
+	if dev == "" || dest == "" {
+		return fmt.Errorf("device and destination are required")
+	}
+	if !strings.Contains(dest, "/") {
+		switch uci.AddrFamily(dest) {
+		case "ipv4":
+			dest += "/32"
+		case "ipv6":
+			dest += "/128"
+		}
+	}
+	_, ipnet, err := net.ParseCIDR(dest)
+	if err != nil {
+		return fmt.Errorf("bad destination %q", dest)
+	}
+	family := uci.AddrFamily(ipnet.IP.String())
+	s := &section{name: "Route"}
+	s.set("Destination", ipnet.String())
+	for _, k := range []struct{ key, unit string }{{"next", "Gateway"}, {"gateway", "Gateway"}, {"source", "PreferredSource"}} {
+		a := uci.GetString(m, k.key, "")
+		if a == "" {
+			continue
+		}
+		if uci.AddrFamily(a) != family {
+			return fmt.Errorf("%s %q is not an %s address", k.key, a, family)
+		}
+		s.set(k.unit, a)
+	}
+	if _, ok := m["cost"]; ok {
+		metric := uci.GetInt(m, "cost", -1)
+		if metric < 0 {
+			return fmt.Errorf("bad cost %v", m["cost"])
+		}
+		s.set("Metric", strconv.Itoa(metric))
+	}
+	s.set("Table", uci.GetString(m, "table", ""))
+	s.set("Type", uci.GetString(m, "type", ""))
+	if mtu := uci.GetInt(m, "mtu", 0); mtu > 0 {
+		s.set("MTUBytes", strconv.Itoa(mtu))
+	}
+	if uci.GetBool(m, "onlink", false) {
+		s.set("GatewayOnLink", "yes")
+	}
+	l := c.link(c.netdevFor(dev))
+	l.extra = append(l.extra, s)
+	return nil
+}
+
+var ipRuleTypes = map[string]bool{"prohibit": true, "unreachable": true, "blackhole": true, "throw": true}
+
+// ipRule — ip_rules[] → [RoutingPolicyRule] на входящем интерфейсе (in) или на lo.
+func (c *context) ipRule(m map[string]any) error {
+	family := uci.GetString(m, "family", "")
+	for _, k := range []string{"src", "dest"} {
+		a := uci.GetString(m, k, "")
+		if a == "" {
+			continue
+		}
+		f := uci.AddrFamily(a)
+		if f == "" {
+			return fmt.Errorf("bad %s %q", k, a)
+		}
+		if family != "" && family != f {
+			return fmt.Errorf("%s %q does not match family %s", k, a, family)
+		}
+		family = f
+	}
+	if family != "" && family != "ipv4" && family != "ipv6" {
+		return fmt.Errorf("unknown family %q", family)
+	}
+	lookup, action := uci.GetString(m, "lookup", ""), uci.GetString(m, "action", "")
+	if uci.GetString(m, "goto", "") != "" {
+		return fmt.Errorf("goto is not supported by networkd backend")
+	}
+	if (lookup == "") == (action == "") {
+		return fmt.Errorf("exactly one of lookup or action is required")
+	}
+	if action != "" && !ipRuleTypes[action] {
+		return fmt.Errorf("unknown action %q", action)
+	}
+
+	s := &section{name: "RoutingPolicyRule"}
+	s.set("From", uci.GetString(m, "src", ""))
+	s.set("To", uci.GetString(m, "dest", ""))
+	in := uci.GetString(m, "in", "")
+	if in != "" {
+		s.set("IncomingInterface", c.netdevFor(in))
+	}
+	if out := uci.GetString(m, "out", ""); out != "" {
+		s.set("OutgoingInterface", c.netdevFor(out))
+	}
+	s.set("Table", lookup)
+	s.set("Type", action)
+	s.set("Priority", uci.GetString(m, "priority", ""))
+	s.set("FirewallMark", uci.GetString(m, "mark", ""))
+	s.set("TypeOfService", uci.GetString(m, "tos", ""))
+	if uci.GetBool(m, "invert", false) {
+		s.set("Invert", "yes")
+	}
+	if family == "ipv6" {
+		s.set("Family", "ipv6")
+	}
+	host := "lo"
+	if in != "" {
+		host = c.netdevFor(in)
+	}
+	l := c.link(host)
+	l.extra = append(l.extra, s)
+	return nil
+}
+
+// ===== WireGuard =====
+// wireguard: { interface, address, private_key, listen_port, peers[] } — тот же блок, что и для OpenWrt.
+// .netdev с ключом пишется 0640: systemd-networkd отказывается читать приватный ключ из world-readable файла.
+func (c *context) renderWireGuard(v any) error {
+	wg, _ := uci.AsMap(v)
+	if wg == nil {
+		return nil
+	}
+	iface := uci.GetString(wg, "interface", "wg0")
+	key := uci.GetString(wg, "private_key", "")
+	if key == "" {
+		return uci.At(fmt.Errorf("private_key is required"), "wireguard")
+	}
+	u, err := c.addNetdev(iface, "wireguard", 0640)
+	if err != nil {
+		return uci.At(err, "wireguard", "interface")
+	}
+	w := u.add("WireGuard").set("PrivateKey", key)
+	if port := uci.GetInt(wg, "listen_port", uci.GetInt(wg, "port", 0)); port > 0 {
+		w.set("ListenPort", strconv.Itoa(port))
+	}
+	c.aliases[iface] = iface
+	l := c.link(iface)
+	for _, a := range uci.StrList(wg["address"]) {
+		if _, _, err := net.ParseCIDR(a); err != nil {
+			return uci.At(fmt.Errorf("%q is not a CIDR prefix", a), "wireguard", "address")
+		}
+		l.addrs = append(l.addrs, a)
+	}
+	return uci.EachItem(wg["peers"], []any{"wireguard", "peers"}, func(m map[string]any, p []any) error {
+		pub := uci.GetString(m, "public_key", "")
+		if pub == "" {
+			return uci.At(fmt.Errorf("public_key is required"), p...)
+		}
+		s := u.add("WireGuardPeer").set("PublicKey", pub)
+		s.set("PresharedKey", uci.GetString(m, "preshared_key", ""))
+		if ep := uci.GetString(m, "endpoint", ""); ep != "" {
+			if _, _, err := net.SplitHostPort(ep); err != nil {
+				return uci.At(fmt.Errorf("endpoint must be host:port: %v", err), append(p, "endpoint")...)
+			}
+			s.set("Endpoint", ep)
+		}
+		s.set("AllowedIPs", strings.Join(uci.StrList(m["allowed_ips"]), ","))
+		if ka := uci.GetInt(m, "keepalive", 0); ka > 0 {
+			s.set("PersistentKeepalive", strconv.Itoa(ka))
+		}
+		return nil
+	})
+}
+
+// ===== вывод =====
+
+// unitFiles — 10-<name>.netdev, затем 20-<name>.network в порядке появления.
+func (c *context) unitFiles() []uci.File {
+	var out []uci.File
+	for _, d := range c.netdevs {
+		out = append(out, uci.File{Name: UnitDir + "10-" + d.name + ".netdev", Data: []byte(d.u.String()), Mode: d.mode})
+	}
+	for _, name := range c.order {
+		l := c.links[name]
+		u := &unit{}
+		u.get("Match").set("Name", l.name)
+		lk := u.get("Link")
+		if l.mtu > 0 {
+			lk.set("MTUBytes", strconv.Itoa(l.mtu))
+		}
+		lk.set("MACAddress", l.mac)
+		if l.down {
+			lk.set("ActivationPolicy", "down")
+		}
+		n := u.get("Network")
+		switch {
+		case l.dhcp4 && l.dhcp6:
+			n.set("DHCP", "yes")
+		case l.dhcp4:
+			n.set("DHCP", "ipv4")
+		case l.dhcp6:
+			n.set("DHCP", "ipv6")
+		}
+		for _, a := range l.addrs {
+			n.set("Address", a)
+		}
+		for _, g := range l.gws {
+			n.set("Gateway", g)
+		}
+		for _, d := range l.dns {
+			n.set("DNS", d)
+		}
+		if len(l.domains) > 0 {
+			n.set("Domains", strings.Join(l.domains, " "))
+		}
+		for _, v := range l.vlans {
+			n.set("VLAN", v)
+		}
+		n.set("Bridge", l.bridge)
+		if l.bridge != "" && len(l.addrs) == 0 && !l.dhcp4 && !l.dhcp6 {
+			n.set("LinkLocalAddressing", "no")
+		}
+		u.sections = append(u.sections, l.extra...)
+		out = append(out, uci.File{Name: UnitDir + "20-" + l.name + ".network", Data: []byte(u.String()), Mode: 0644})
+	}
+	return out
+}
+
+// v4CIDR — ipaddr + netmask (точечная или длина префикса) → "a.b.c.d/len".
+func v4CIDR(ip, mask string) (string, error) {
+	if p := net.ParseIP(ip); p == nil || p.To4() == nil {
+		return "", fmt.Errorf("%q is not an IPv4 address", ip)
+	}
+	if n, err := strconv.Atoi(mask); err == nil && n >= 0 && n <= 32 {
+		return fmt.Sprintf("%s/%d", ip, n), nil
+	}
+	m := net.ParseIP(mask).To4()
+	if m == nil {
+		return "", fmt.Errorf("bad netmask %q", mask)
+	}
+	ones, bits := net.IPMask(m).Size()
+	if bits == 0 {
+		return "", fmt.Errorf("bad netmask %q", mask)
+	}
+	return fmt.Sprintf("%s/%d", ip, ones), nil
+}
@@ -0,0 +1,128 @@
+// Package networkd — backend для Linux-шлюзов (Debian и т.п.): тот же NetJSON, что и для OpenWrt,
+// рендерится в юниты systemd-networkd (.network/.netdev, в т.ч. WireGuard) и ruleset nftables.
+//
+// Поддерживаются: system (hostname, zonename, ntp), network.interfaces / interfaces (плоская форма
+// и схема netjsonconfig), network.bridges, dns_servers/dns_search, routes, ip_rules, wireguard,
+// firewall и files. Остальные ключи (wireless, dhcp, mwan3, openvpn, zerotier, uci) не забираются —
+// как и у uci.RenderAll, файлы возвращаются вместе с *uci.UnclaimedKeysError.
+package networkd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"wisp/internal/render/uci"
+)
+
+const (
+	UnitDir      = "etc/systemd/network/"
+	NftablesPath = "etc/nftables.conf"
+)
+
+// claimed — верхнеуровневые ключи NetJSON, которые рендерит этот backend.
+var claimed = map[string]bool{
+	"type": true, "system": true, "network": true, "interfaces": true, "dns_servers": true, "dns_search": true,
+	"routes": true, "ip_rules": true, "wireguard": true, "firewall": true, uci.FilesKey: true,
+}
+
+type context struct {
+	nj   map[string]any
+	opts uci.Options
+
+	links   map[string]*link // netdev → его .network
+	order   []string         // порядок появления netdev (детерминированный вывод)
+	netdevs []netdev
+	aliases map[string]string // логическое имя интерфейса (как в UCI: lan, wan) → netdev
+	files   []uci.File
+
+	uci.Collector
+}
+
+// Render — аналог uci.RenderAll для systemd-networkd/nftables; Options те же
+// (SwitchMode не используется: мосты всегда через bridge netdev с VLAN filtering).
+func Render(nj map[string]any, opts uci.Options) ([]uci.File, error) {
+	c := &context{nj: nj, opts: opts, Collector: uci.Collector{Strict: opts.Strict}, links: map[string]*link{}, aliases: map[string]string{}}
+	// порядок важен: firewall ссылается на логические имена из network и wireguard
+	steps := []struct {
+		key string
+		fn  func(v any) error
+	}{
+		{"system", c.renderSystem},
+		{"network", c.renderNetwork},
+		{"wireguard", c.renderWireGuard},
+		{"firewall", c.renderFirewall},
+		{uci.FilesKey, c.renderFiles},
+	}
+	for _, s := range steps {
+		if err := s.fn(nj[s.key]); err != nil {
+			if !opts.Strict {
+				return nil, fmt.Errorf("networkd: render %s: %w", s.key, err)
+			}
+			c.Fail(s.key, err)
+		}
+	}
+
+	var keys []string
+	for k := range nj {
+		if !claimed[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if opts.Strict {
+		for _, k := range keys {
+			c.Invalid(uci.Pointer(k), "not supported by networkd backend")
+		}
+		if len(c.Errs) > 0 {
+			return nil, uci.ValidationErrors(c.Errs)
+		}
+	}
+
+	files := c.unitFiles()
+	files = append(files, c.files...)
+	if len(keys) > 0 {
+		return files, &uci.UnclaimedKeysError{Keys: keys}
+	}
+	return files, nil
+}
+
+// ===== system =====
+// system: { hostname, zonename, ntp: { enabled, servers[] } } → /etc/hostname, /etc/timezone
+// и drop-in systemd-timesyncd. Остальное (leds, log_*, root_password) — только OpenWrt.
+func (c *context) renderSystem(v any) error {
+	sys, _ := uci.AsMap(v)
+	hn := uci.GetString(sys, "hostname", c.opts.DeviceHostname)
+	if hn != "" {
+		c.addFile("etc/hostname", hn+"\n", 0644)
+	}
+	if zone := uci.GetString(sys, "zonename", ""); zone != "" {
+		c.addFile("etc/timezone", zone+"\n", 0644)
+	}
+	if ntp, ok := uci.AsMap(sys["ntp"]); ok && uci.GetBool(ntp, "enabled", true) {
+		if srv := uci.StrList(ntp["servers"]); len(srv) > 0 {
+			c.addFile("etc/systemd/timesyncd.conf.d/wisp.conf", "[Time]\nNTP="+strings.Join(srv, " ")+"\n", 0644)
+		}
+	}
+	for k := range sys {
+		switch k {
+		case "hostname", "zonename", "ntp":
+		default:
+			c.Invalid(uci.Pointer("system", k), "not supported by networkd backend")
+		}
+	}
+	return nil
+}
+
+func (c *context) renderFiles(v any) error {
+	files, err := uci.ParseFiles(v)
+	if err != nil {
+		return err
+	}
+	c.files = append(c.files, files...)
+	return nil
+}
+
+func (c *context) addFile(name, data string, mode int) {
+	c.files = append(c.files, uci.File{Name: name, Data: []byte(data), Mode: mode})
+}
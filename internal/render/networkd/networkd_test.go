@@ -0,0 +1,192 @@
+package networkd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"wisp/internal/render/uci"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.out from the current Render output")
+
+// TestRenderGolden: testdata/<name>.json → Render → сравнение с testdata/<name>.out
+// (.netdev/.network, nftables.conf и прочие файлы). После намеренного изменения вывода:
+// go test ./internal/render/networkd -update.
+func TestRenderGolden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no testdata/*.json")
+	}
+	for _, in := range inputs {
+		name := strings.TrimSuffix(filepath.Base(in), ".json")
+		t.Run(name, func(t *testing.T) {
+			files := render(t, in)
+			got := dumpFiles(files)
+			golden := strings.TrimSuffix(in, ".json") + ".out"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("output differs from %s:\n%s", golden, lineDiff(string(want), got))
+			}
+		})
+	}
+}
+
+func render(t *testing.T, path string) map[string]uci.File {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nj map[string]any
+	if err := json.Unmarshal(raw, &nj); err != nil {
+		t.Fatal(err)
+	}
+	files, err := Render(nj, uci.Options{DeviceHostname: "golden", Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]uci.File, len(files))
+	for _, f := range files {
+		out[f.Name] = f
+	}
+	return out
+}
+
+// Порядок в nftables важнее побайтового совпадения: проверяем его отдельно, чтобы -update
+// не закрепил случайно сломанный ruleset.
+func TestNftablesOrder(t *testing.T) {
+	nft := string(render(t, "testdata/firewall.json")[NftablesPath].Data)
+	chain := func(name string) []string {
+		start := strings.Index(nft, "\tchain "+name+" {\n")
+		if start < 0 {
+			t.Fatalf("no chain %s:\n%s", name, nft)
+		}
+		body := nft[start+len("\tchain "+name+" {\n"):]
+		body = body[:strings.Index(body, "\t}\n")]
+		var lines []string
+		for _, l := range strings.Split(strings.TrimSpace(body), "\n") {
+			lines = append(lines, strings.TrimSpace(l))
+		}
+		return lines
+	}
+	before := func(lines []string, a, b string) {
+		t.Helper()
+		ia, ib := -1, -1
+		for i, l := range lines {
+			if ia < 0 && strings.Contains(l, a) {
+				ia = i
+			}
+			if ib < 0 && strings.Contains(l, b) {
+				ib = i
+			}
+		}
+		if ia < 0 || ib < 0 || ia >= ib {
+			t.Errorf("%q must come before %q in:\n%s", a, b, strings.Join(lines, "\n"))
+		}
+	}
+
+	// базовые цепочки: established → переход в зоны; policy зоны — последняя строка её цепочки
+	in := chain("input")
+	before(in, "ct state established,related accept", `jump input_lan`)
+	before(in, `iifname "lo" accept`, `jump input_lan`)
+	before(in, "jump input_lan", "jump input_guest")
+	before(in, "jump input_guest", "jump input_wan")
+	fwd := chain("forward")
+	before(fwd, "tcp option maxseg size set rt mtu", "ct state established,related accept")
+	before(fwd, "ct status dnat accept", "jump forward_lan")
+	if !strings.Contains(fwd[0], "policy drop") {
+		t.Errorf("forward must default to drop: %s", fwd[0])
+	}
+
+	for zone, policy := range map[string][3]string{
+		"lan": {"accept", "accept", "accept"}, "guest": {"reject", "accept", "reject"}, "wan": {"drop", "accept", "reject"},
+	} {
+		for i, hook := range []string{"input", "output", "forward"} {
+			lines := chain(hook + "_" + zone)
+			if last := lines[len(lines)-1]; last != policy[i] {
+				t.Errorf("%s_%s ends with %q, want policy %q", hook, zone, last, policy[i])
+			}
+		}
+	}
+	// DROP-правило guest → lan раньше общего forwarding guest → wan и policy
+	guest := chain("forward_guest")
+	before(guest, `oifname "eth1" drop`, "reject")
+	before(guest, `comment "Block-Guest-LAN"`, `oifname "eth0" accept`)
+	before(chain("input_wan"), `comment "Allow-SSH"`, "drop")
+
+	// masquerade только в сторону wan и только для masq_src; DNAT — в prerouting
+	post := chain("postrouting")
+	if !contains(post, `oifname "eth0" meta nfproto ipv4 ip saddr { 192.168.1.0/24, 192.168.10.0/24 } masquerade`) {
+		t.Errorf("no masquerade to wan in postrouting:\n%s", strings.Join(post, "\n"))
+	}
+	for _, l := range post {
+		if strings.Contains(l, "masquerade") && !strings.Contains(l, `oifname "eth0"`) {
+			t.Errorf("masquerade not limited to wan: %s", l)
+		}
+	}
+	if !contains(chain("prerouting"), `iifname "eth0" meta l4proto tcp th dport 8080 dnat ip to 192.168.1.10:80 comment "web"`) {
+		t.Errorf("no DNAT in prerouting:\n%s", nft)
+	}
+}
+
+func contains(lines []string, s string) bool {
+	for _, l := range lines {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpFiles — файлы в том же виде, что печатает wisp-render.
+func dumpFiles(files map[string]uci.File) string {
+	names := make([]string, 0, len(files))
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, n := range names {
+		fmt.Fprintf(&b, "==> %s (%04o) <==\n%s\n", n, files[n].Mode, files[n].Data)
+	}
+	return b.String()
+}
+
+// lineDiff — первые расхождения построчно (want/got).
+func lineDiff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var b strings.Builder
+	n := 0
+	for i := 0; i < max(len(w), len(g)) && n < 10; i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			fmt.Fprintf(&b, "line %d:\n  want: %q\n  got:  %q\n", i+1, wl, gl)
+			n++
+		}
+	}
+	return b.String()
+}
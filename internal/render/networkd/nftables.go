@@ -0,0 +1,589 @@
+package networkd
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"wisp/internal/render/uci"
+)
+
+// firewall — та же схема, что у uci (zones/forwardings/rules/redirects/ipsets/includes, см. firewall.go там),
+// рендерится в /etc/nftables.conf (его грузит nftables.service) с одной таблицей inet wisp:
+//
+//	input/forward/output — базовые цепочки: established/related, затем правила src/dest "*", затем
+//	jump в input_<zone>/forward_<zone>/output_<zone> по iifname/oifname; в конце цепочки зоны — её policy.
+//	prerouting/postrouting — DNAT/SNAT из redirects и masquerade зон с masq.
+//
+// Трафик интерфейсов вне зон: input/output — accept, forward — drop (как у fw4 по умолчанию).
+// Чужие таблицы (docker, fail2ban) не трогаются: пересоздаётся только inet wisp.
+
+var nftVerdicts = map[string]string{"ACCEPT": "accept", "REJECT": "reject", "DROP": "drop"}
+
+var nftIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type nftZone struct {
+	name                   string
+	devs                   []string
+	input, output, forward string
+}
+
+type nftSet struct {
+	family string // ipv4 | ipv6
+	dir    string // saddr | daddr
+}
+
+type nftBuilder struct {
+	c      *context
+	zones  map[string]*nftZone
+	order  []string
+	chains map[string][]string
+	sets   map[string]nftSet
+	defs   []string // определения set
+	dnat   bool
+}
+
+func (c *context) renderFirewall(v any) error {
+	fw, _ := uci.AsMap(v)
+	if fw == nil {
+		return nil
+	}
+	b := &nftBuilder{c: c, zones: map[string]*nftZone{}, chains: map[string][]string{}, sets: map[string]nftSet{}}
+
+	if err := uci.EachItem(fw["zones"], []any{"firewall", "zones"}, b.zone); err != nil {
+		return err
+	}
+	if err := uci.EachItem(fw["ipsets"], []any{"firewall", "ipsets"}, b.ipset); err != nil {
+		return err
+	}
+	steps := []struct {
+		key string
+		fn  func(m map[string]any, i int) error
+	}{
+		// правила раньше forwardings: DROP/REJECT в правиле должен сработать до общего accept
+		{"rules", b.rule},
+		{"forwardings", b.forwarding},
+		{"redirects", b.redirect},
+	}
+	for _, s := range steps {
+		items, _ := uci.AsSlice(fw[s.key])
+		for i, it := range items {
+			m, _ := uci.AsMap(it)
+			if err := s.fn(m, i); err != nil {
+				return uci.At(err, "firewall", s.key, i)
+			}
+		}
+	}
+	for _, z := range b.order {
+		zone := b.zones[z]
+		for _, ch := range []struct{ name, policy string }{
+			{"input_" + z, zone.input}, {"output_" + z, zone.output}, {"forward_" + z, zone.forward},
+		} {
+			b.add(ch.name, nftVerdicts[ch.policy])
+		}
+	}
+	// zone masq/mtu_fix — из исходных описаний зон
+	zones, _ := uci.AsSlice(fw["zones"])
+	for _, z := range zones {
+		m, _ := uci.AsMap(z)
+		zone := b.zones[uci.GetString(m, "name", "")]
+		if zone == nil || len(zone.devs) == 0 {
+			continue
+		}
+		out := "oifname " + nftSetOf(quoteAll(zone.devs))
+		for _, fam := range []struct{ key, nf, sel string }{{"masq", "ipv4", "ip"}, {"masq6", "ipv6", "ip6"}} {
+			if !uci.GetBool(m, fam.key, false) {
+				continue
+			}
+			match := out + " meta nfproto " + fam.nf
+			if src := uci.StrList(m["masq_src"]); len(src) > 0 && fam.nf == "ipv4" {
+				match += " " + fam.sel + " saddr " + nftSetOf(src)
+			}
+			b.add("postrouting", match+" masquerade")
+		}
+		if uci.GetBool(m, "mtu_fix", false) {
+			b.add("mangle_forward", out+" tcp flags syn tcp option maxseg size set rt mtu")
+		}
+	}
+
+	includes, _ := uci.AsSlice(fw["includes"])
+	var incs []string
+	for i, x := range includes {
+		m, _ := uci.AsMap(x)
+		path := uci.GetString(m, "path", "")
+		if path == "" {
+			return uci.At(fmt.Errorf("path is required"), "firewall", "includes", i)
+		}
+		if typ := uci.GetString(m, "type", "script"); typ != "nftables" {
+			return uci.At(fmt.Errorf("include type %q is not supported by networkd backend (only nftables)", typ), "firewall", "includes", i)
+		}
+		incs = append(incs, fmt.Sprintf("include %q", path))
+	}
+
+	c.addFile(NftablesPath, b.String(incs), 0755)
+	return nil
+}
+
+func (b *nftBuilder) add(chain, line string) {
+	b.chains[chain] = append(b.chains[chain], line)
+}
+
+func (b *nftBuilder) zone(m map[string]any, p []any) error {
+	name := uci.GetString(m, "name", "")
+	if name == "" {
+		b.c.Invalid(uci.Pointer(p...), "zone without name is skipped")
+		return nil
+	}
+	if len(name) > 11 || !nftIdent.MatchString(name) {
+		return uci.At(fmt.Errorf("bad zone name %q", name), p...)
+	}
+	if b.zones[name] != nil {
+		return uci.At(fmt.Errorf("duplicate zone %q", name), p...)
+	}
+	z := &nftZone{name: name}
+	for _, k := range []struct {
+		key, def string
+		dst      *string
+	}{{"input", "ACCEPT", &z.input}, {"output", "ACCEPT", &z.output}, {"forward", "REJECT", &z.forward}} {
+		pol := strings.ToUpper(uci.GetString(m, k.key, k.def))
+		if nftVerdicts[pol] == "" {
+			return uci.At(fmt.Errorf("zone %s: bad %s policy %q", name, k.key, pol), p...)
+		}
+		*k.dst = pol
+	}
+	seen := map[string]bool{}
+	addDev := func(d string) {
+		if !seen[d] {
+			seen[d] = true
+			z.devs = append(z.devs, d)
+		}
+	}
+	// wan и wan6 обычно живут на одном netdev
+	for i, n := range uci.StrList(m["networks"]) {
+		if _, ok := b.c.aliases[n]; !ok {
+			b.c.Invalid(uci.Pointer(append(p, "networks", i)...), "unknown network %q", n)
+		}
+		addDev(b.c.netdevFor(n))
+	}
+	for _, d := range uci.StrList(m["devices"]) {
+		addDev(d)
+	}
+	if len(uci.StrList(m["subnets"])) > 0 {
+		return uci.At(fmt.Errorf("subnets are not supported by networkd backend"), append(p, "subnets")...)
+	}
+	if len(z.devs) == 0 {
+		b.c.Invalid(uci.Pointer(p...), "zone %s has no networks or devices", name)
+	}
+	b.zones[name] = z
+	b.order = append(b.order, name)
+	return nil
+}
+
+// zoneRef — как у uci: ссылки проверяются, если зоны описаны.
+func (b *nftBuilder) zoneRef(z string) error {
+	if z == "" || z == "*" || len(b.zones) == 0 || b.zones[z] != nil {
+		return nil
+	}
+	return fmt.Errorf("unknown zone %q", z)
+}
+
+func (b *nftBuilder) devs(z string) []string {
+	if zone := b.zones[z]; zone != nil {
+		return zone.devs
+	}
+	return nil
+}
+
+func (b *nftBuilder) forwarding(m map[string]any, _ int) error {
+	src, dest := uci.GetString(m, "src", ""), uci.GetString(m, "dest", "")
+	if src == "" || dest == "" {
+		return fmt.Errorf("src and dest are required")
+	}
+	for _, z := range []string{src, dest} {
+		if err := b.zoneRef(z); err != nil {
+			return err
+		}
+	}
+	line := "accept"
+	if dest != "*" {
+		line = "oifname " + nftSetOf(quoteAll(b.devs(dest))) + " accept"
+	}
+	if f := uci.GetString(m, "family", ""); f == "ipv4" || f == "ipv6" {
+		line = "meta nfproto " + f + " " + line
+	}
+	b.add(zoneChain("forward", src), line)
+	return nil
+}
+
+func (b *nftBuilder) ipset(m map[string]any, p []any) error {
+	name := uci.GetString(m, "name", "")
+	match := uci.StrList(m["match"])
+	if name == "" || len(match) == 0 {
+		return uci.At(fmt.Errorf("name and match are required"), p...)
+	}
+	if !nftIdent.MatchString(name) {
+		return uci.At(fmt.Errorf("bad set name %q", name), p...)
+	}
+	dir, kind, _ := strings.Cut(match[0], "_")
+	if len(match) > 1 || (dir != "src" && dir != "dest") || (kind != "ip" && kind != "net") {
+		return uci.At(fmt.Errorf("only single src_ip/src_net/dest_ip/dest_net match is supported by networkd backend"), append(p, "match")...)
+	}
+	entries := uci.StrList(m["entries"])
+	family := uci.GetString(m, "family", "")
+	for _, e := range entries {
+		f := uci.AddrFamily(e)
+		if f == "" || (family != "" && family != f) {
+			return uci.At(fmt.Errorf("bad entry %q", e), append(p, "entries")...)
+		}
+		family = f
+	}
+	if family == "" {
+		family = "ipv4"
+	}
+	typ := "ipv4_addr"
+	if family == "ipv6" {
+		typ = "ipv6_addr"
+	}
+	def := fmt.Sprintf("set %s {\n\t\ttype %s\n\t\tflags interval", name, typ)
+	if len(entries) > 0 {
+		def += "\n\t\telements = { " + strings.Join(entries, ", ") + " }"
+	}
+	b.defs = append(b.defs, def+"\n\t}")
+	s := nftSet{family: family, dir: "saddr"}
+	if dir == "dest" {
+		s.dir = "daddr"
+	}
+	b.sets[name] = s
+	return nil
+}
+
+// rule: src+dest → forward_<src>, только src → input_<src>, только dest (или ничего) → output_<dest>.
+func (b *nftBuilder) rule(m map[string]any, i int) error {
+	if !uci.GetBool(m, "enabled", true) {
+		return nil
+	}
+	src, dest := uci.GetString(m, "src", ""), uci.GetString(m, "dest", "")
+	for _, z := range []string{src, dest} {
+		if err := b.zoneRef(z); err != nil {
+			return err
+		}
+	}
+	match, err := b.match(m, "tcpudp", "src_port", "dest_port")
+	if err != nil {
+		return err
+	}
+	var chain string
+	switch {
+	case src != "" && dest != "":
+		chain = zoneChain("forward", src)
+		if dest != "*" {
+			match = append([]string{"oifname " + nftSetOf(quoteAll(b.devs(dest)))}, match...)
+		}
+	case src != "":
+		chain = zoneChain("input", src)
+	default:
+		chain = zoneChain("output", dest)
+	}
+
+	if lim := uci.GetString(m, "limit", ""); lim != "" {
+		rate, err := nftLimit(lim)
+		if err != nil {
+			return err
+		}
+		if burst := uci.GetInt(m, "limit_burst", 0); burst > 0 {
+			rate += fmt.Sprintf(" burst %d packets", burst)
+		}
+		match = append(match, "limit rate "+rate)
+	}
+	target := strings.ToUpper(uci.GetString(m, "target", "ACCEPT"))
+	verdict := nftVerdicts[target]
+	switch {
+	case verdict != "":
+	case target == "MARK":
+		mark := uci.GetString(m, "set_mark", "")
+		if mark == "" {
+			return fmt.Errorf("MARK needs set_mark")
+		}
+		verdict = "meta mark set " + mark
+	default:
+		return fmt.Errorf("target %q is not supported by networkd backend", target)
+	}
+	name := uci.GetString(m, "name", fmt.Sprintf("rule_%d", i+1))
+	b.add(chain, strings.Join(append(match, verdict), " ")+fmt.Sprintf(" comment %q", name))
+	return nil
+}
+
+// redirect: DNAT (проброс из src на dest_ip:dest_port) или SNAT (подмена источника на src_dip).
+func (b *nftBuilder) redirect(m map[string]any, i int) error {
+	if !uci.GetBool(m, "enabled", true) {
+		return nil
+	}
+	target := strings.ToUpper(uci.GetString(m, "target", "DNAT"))
+	proto := uci.GetString(m, "proto", "tcp udp")
+	name := uci.GetString(m, "name", fmt.Sprintf("redirect_%d", i+1))
+	switch target {
+	case "DNAT":
+		src := uci.GetString(m, "src", "wan")
+		if err := b.zoneRef(src); err != nil {
+			return err
+		}
+		ip, port := uci.GetString(m, "dest_ip", ""), uci.GetString(m, "dest_port", "")
+		if ip == "" && port == "" {
+			return fmt.Errorf("DNAT needs dest_ip or dest_port")
+		}
+		if uci.GetString(m, "src_dport", "") == "" && proto != "all" && proto != "icmp" {
+			return fmt.Errorf("DNAT needs src_dport for proto %s", proto)
+		}
+		match, err := b.match(map[string]any{
+			"proto": proto, "src_ip": m["src_ip"], "dest_ip": m["src_dip"],
+			"src_port": m["src_port"], "dest_port": m["src_dport"],
+		}, proto, "src_port", "dest_port")
+		if err != nil {
+			return err
+		}
+		if devs := b.devs(src); len(devs) > 0 {
+			match = append([]string{"iifname " + nftSetOf(quoteAll(devs))}, match...)
+		}
+		var to string
+		switch {
+		case ip == "":
+			to = "redirect to :" + port
+		case uci.AddrFamily(ip) == "ipv4":
+			to = "dnat ip to " + ip + portSuffix(port)
+		case uci.AddrFamily(ip) == "ipv6":
+			to = "dnat ip6 to [" + ip + "]" + portSuffix(port)
+		default:
+			return fmt.Errorf("bad dest_ip %q", ip)
+		}
+		b.add("prerouting", strings.Join(append(match, to), " ")+fmt.Sprintf(" comment %q", name))
+		b.dnat = true
+	case "SNAT":
+		dip, dest := uci.GetString(m, "src_dip", ""), uci.GetString(m, "dest", "")
+		if dip == "" {
+			return fmt.Errorf("SNAT needs src_dip")
+		}
+		if dest == "" {
+			return fmt.Errorf("SNAT needs dest zone")
+		}
+		if err := b.zoneRef(dest); err != nil {
+			return err
+		}
+		match, err := b.match(map[string]any{
+			"proto": proto, "src_ip": m["src_ip"], "dest_ip": m["dest_ip"],
+			"src_port": m["src_port"], "dest_port": m["dest_port"],
+		}, proto, "src_port", "dest_port")
+		if err != nil {
+			return err
+		}
+		if devs := b.devs(dest); len(devs) > 0 {
+			match = append([]string{"oifname " + nftSetOf(quoteAll(devs))}, match...)
+		}
+		family := "ip"
+		if uci.AddrFamily(dip) == "ipv6" {
+			family = "ip6"
+		}
+		b.add("postrouting", strings.Join(append(match, "snat "+family+" to "+dip), " ")+fmt.Sprintf(" comment %q", name))
+	default:
+		return fmt.Errorf("unknown target %q", target)
+	}
+	return nil
+}
+
+// match — общие условия rule/redirect: family, адреса, ipset, протокол и порты, icmp_type, src_mac.
+func (b *nftBuilder) match(m map[string]any, defProto, sportKey, dportKey string) ([]string, error) {
+	family := uci.GetString(m, "family", "")
+	var out []string
+	for _, k := range []struct{ key, dir string }{{"src_ip", "saddr"}, {"dest_ip", "daddr"}} {
+		addrs := uci.StrList(m[k.key])
+		if len(addrs) == 0 {
+			continue
+		}
+		f := ""
+		for _, a := range addrs {
+			af := uci.AddrFamily(a)
+			if af == "" || (f != "" && af != f) {
+				return nil, fmt.Errorf("bad or mixed-family %s %q", k.key, a)
+			}
+			f = af
+		}
+		if family != "" && family != "any" && family != f {
+			return nil, fmt.Errorf("family %s does not match %s addresses", family, f)
+		}
+		family = f
+		sel := "ip"
+		if f == "ipv6" {
+			sel = "ip6"
+		}
+		out = append(out, sel+" "+k.dir+" "+nftSetOf(addrs))
+	}
+	if family == "ipv4" || family == "ipv6" {
+		out = append([]string{"meta nfproto " + family}, out...)
+	} else if family != "" && family != "any" {
+		return nil, fmt.Errorf("unknown family %q", family)
+	}
+	if name := uci.GetString(m, "ipset", ""); name != "" {
+		s, ok := b.sets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown ipset %q", name)
+		}
+		sel := "ip"
+		if s.family == "ipv6" {
+			sel = "ip6"
+		}
+		out = append(out, sel+" "+s.dir+" @"+name)
+	}
+	if mac := uci.GetString(m, "src_mac", ""); mac != "" {
+		if _, err := net.ParseMAC(mac); err != nil {
+			return nil, fmt.Errorf("bad src_mac %q", mac)
+		}
+		out = append(out, "ether saddr "+mac)
+	}
+
+	var protos []string
+	for _, p := range strings.Fields(strings.ReplaceAll(uci.GetString(m, "proto", defProto), ",", " ")) {
+		if p == "tcpudp" {
+			protos = append(protos, "tcp", "udp")
+			continue
+		}
+		protos = append(protos, p)
+	}
+	all := len(protos) == 0 || (len(protos) == 1 && protos[0] == "all")
+	if !all {
+		out = append(out, "meta l4proto "+nftSetOf(protos))
+	}
+	for _, k := range []struct{ key, dir string }{{sportKey, "sport"}, {dportKey, "dport"}} {
+		ports := strings.Fields(strings.ReplaceAll(uci.GetString(m, k.key, ""), ",", " "))
+		if len(ports) == 0 {
+			continue
+		}
+		for _, p := range protos {
+			if p != "tcp" && p != "udp" && p != "sctp" && p != "udplite" {
+				return nil, fmt.Errorf("%s needs proto tcp/udp, got %s", k.key, strings.Join(protos, " "))
+			}
+		}
+		for _, p := range ports {
+			if !portRange.MatchString(p) {
+				return nil, fmt.Errorf("bad %s %q", k.key, p)
+			}
+		}
+		if all {
+			return nil, fmt.Errorf("%s needs proto tcp/udp", k.key)
+		}
+		out = append(out, "th "+k.dir+" "+nftSetOf(ports))
+	}
+	if icmp := uci.StrList(m["icmp_type"]); len(icmp) > 0 {
+		switch {
+		case len(protos) == 1 && protos[0] == "icmp":
+			out = append(out, "icmp type "+nftSetOf(icmp))
+		case len(protos) == 1 && protos[0] == "icmpv6":
+			out = append(out, "icmpv6 type "+nftSetOf(icmp))
+		default:
+			return nil, fmt.Errorf("icmp_type needs proto icmp or icmpv6")
+		}
+	}
+	return out, nil
+}
+
+var portRange = regexp.MustCompile(`^[0-9]{1,5}(-[0-9]{1,5})?$`)
+
+// nftLimit — "10/sec", "5/minute" (как у fw4) → "10/second".
+func nftLimit(l string) (string, error) {
+	n, unit, ok := strings.Cut(l, "/")
+	if _, err := strconv.Atoi(n); !ok || err != nil {
+		return "", fmt.Errorf("bad limit %q", l)
+	}
+	for _, u := range []string{"second", "minute", "hour", "day"} {
+		if unit != "" && strings.HasPrefix(u, unit) {
+			return n + "/" + u, nil
+		}
+	}
+	return "", fmt.Errorf("bad limit unit in %q", l)
+}
+
+func portSuffix(port string) string {
+	if port == "" {
+		return ""
+	}
+	return ":" + port
+}
+
+// zoneChain — цепочка зоны или базовая для "*"/пустой зоны.
+func zoneChain(hook, zone string) string {
+	if zone == "" || zone == "*" {
+		return hook
+	}
+	return hook + "_" + zone
+}
+
+func quoteAll(xs []string) []string {
+	out := make([]string, len(xs))
+	for i, x := range xs {
+		out[i] = strconv.Quote(x)
+	}
+	return out
+}
+
+// nftSetOf — один элемент как есть, несколько — анонимный set { a, b }.
+func nftSetOf(xs []string) string {
+	if len(xs) == 1 {
+		return xs[0]
+	}
+	return "{ " + strings.Join(xs, ", ") + " }"
+}
+
+func (b *nftBuilder) String(includes []string) string {
+	var s strings.Builder
+	s.WriteString("#!/usr/sbin/nft -f\n# generated by wisp, do not edit\n\n")
+	// пересоздаём только свою таблицу: "table" гарантирует, что delete не упадёт на первом запуске
+	s.WriteString("table inet wisp\ndelete table inet wisp\n\ntable inet wisp {\n")
+	for _, d := range b.defs {
+		s.WriteString("\t" + d + "\n\n")
+	}
+
+	chain := func(name, head string, pre, post []string) {
+		fmt.Fprintf(&s, "\tchain %s {\n", name)
+		if head != "" {
+			s.WriteString("\t\t" + head + "\n")
+		}
+		lines := append(append(append([]string{}, pre...), b.chains[name]...), post...)
+		for _, l := range lines {
+			s.WriteString("\t\t" + l + "\n")
+		}
+		s.WriteString("\t}\n\n")
+	}
+	jumps := func(hook, dir string) []string {
+		var out []string
+		for _, z := range b.order {
+			if devs := b.zones[z].devs; len(devs) > 0 {
+				out = append(out, dir+" "+nftSetOf(quoteAll(devs))+" jump "+hook+"_"+z)
+			}
+		}
+		return out
+	}
+	established := []string{"ct state established,related accept", "ct state invalid drop"}
+
+	// базовые цепочки: служебное, затем правила "*", затем переход в цепочки зон
+	chain("input", "type filter hook input priority filter; policy accept;",
+		append(established, `iifname "lo" accept`), jumps("input", "iifname"))
+	fwd := append(append([]string{}, b.chains["mangle_forward"]...), established...)
+	if b.dnat {
+		fwd = append(fwd, "ct status dnat accept")
+	}
+	chain("forward", "type filter hook forward priority filter; policy drop;", fwd, jumps("forward", "iifname"))
+	chain("output", "type filter hook output priority filter; policy accept;",
+		append(established, `oifname "lo" accept`), jumps("output", "oifname"))
+	chain("prerouting", "type nat hook prerouting priority dstnat; policy accept;", nil, nil)
+	chain("postrouting", "type nat hook postrouting priority srcnat; policy accept;", nil, nil)
+	for _, z := range b.order {
+		for _, hook := range []string{"input", "forward", "output"} {
+			chain(hook+"_"+z, "", nil, nil)
+		}
+	}
+	out := strings.TrimSuffix(s.String(), "\n") + "}\n"
+	for _, inc := range includes {
+		out += "\n" + inc + "\n"
+	}
+	return out
+}
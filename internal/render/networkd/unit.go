@@ -0,0 +1,56 @@
+package networkd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unit — INI-файл systemd: секции в порядке добавления, повтор секции ([Route], [WireGuardPeer]) допустим.
+type unit struct {
+	sections []*section
+}
+
+type section struct {
+	name string
+	kv   [][2]string
+}
+
+// add открывает новую секцию (для повторяемых: [Route], [BridgeVLAN], ...).
+func (u *unit) add(name string) *section {
+	s := &section{name: name}
+	u.sections = append(u.sections, s)
+	return s
+}
+
+// get — первая секция с таким именем или новая ([Match], [Network], [Link]).
+func (u *unit) get(name string) *section {
+	for _, s := range u.sections {
+		if s.name == name {
+			return s
+		}
+	}
+	return u.add(name)
+}
+
+// set пишет ключ; пустое значение пропускается.
+func (s *section) set(k, v string) *section {
+	if v != "" {
+		s.kv = append(s.kv, [2]string{k, v})
+	}
+	return s
+}
+
+func (u *unit) String() string {
+	var b strings.Builder
+	b.WriteString("# generated by wisp, do not edit\n")
+	for _, s := range u.sections {
+		if len(s.kv) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n[%s]\n", s.name)
+		for _, kv := range s.kv {
+			fmt.Fprintf(&b, "%s=%s\n", kv[0], kv[1])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,158 @@
+package routeros
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"wisp/internal/render/uci"
+)
+
+// ===== dhcp =====
+// Схема та же, что у uci (servers/hosts/domains/dnsmasq). Сервер: пул wisp-<interface>
+// из start/limit (как у OpenWrt: смещение от адреса сети), сеть с шлюзом и DNS = адрес
+// интерфейса; из dhcp_option понимаются 3 (router), 6 (dns), 15 (domain).
+// RA/DHCPv6 (odhcpd) у RouterOS настраиваются иначе — в строгом режиме это ошибка.
+func (c *context) renderDHCP(v any) error {
+	d, _ := uci.AsMap(v)
+	if d == nil {
+		return nil
+	}
+	if dm, ok := uci.AsMap(d["dnsmasq"]); ok {
+		for i, srv := range uci.StrList(dm["servers"]) {
+			if net.ParseIP(srv) == nil {
+				c.Invalid(uci.Pointer("dhcp", "dnsmasq", "servers", i), "only plain upstream IPs are supported by routeros backend")
+				continue
+			}
+			c.addDNS(srv)
+		}
+	}
+
+	err := uci.EachItem(d["servers"], []any{"dhcp", "servers"}, func(m map[string]any, p []any) error {
+		name := uci.GetString(m, "interface", "")
+		if name == "" {
+			c.Invalid(uci.Pointer(p...), "server without interface is skipped")
+			return nil
+		}
+		for _, k := range []string{"ra", "dhcpv6", "ndp", "ra_flags"} {
+			if _, ok := m[k]; ok {
+				c.Invalid(uci.Pointer(append(p, k)...), "not supported by routeros backend")
+			}
+		}
+		if uci.GetString(m, "dhcpv4", "server") == "disabled" || uci.GetBool(m, "ignore", false) {
+			return nil
+		}
+		dev := c.ifaceFor(name)
+		cidr := c.v4[dev]
+		if cidr == "" {
+			return uci.At(fmt.Errorf("interface %s has no static IPv4 address", name), append(p, "interface")...)
+		}
+		ip, ipnet, _ := net.ParseCIDR(cidr)
+		from, to, err := poolRange(ipnet, uci.GetInt(m, "start", 100), uci.GetInt(m, "limit", 150))
+		if err != nil {
+			return uci.At(err, p...)
+		}
+		pool := "wisp-" + name
+		c.addTagged("/ip pool", "", "name", pool, "ranges", from+"-"+to)
+		c.addTagged("/ip dhcp-server", "", "name", pool, "interface", dev, "address-pool", pool,
+			"lease-time", uci.GetString(m, "leasetime", "12h"))
+
+		gw, dns, domain := ip.String(), ip.String(), ""
+		for i, o := range uci.StrList(m["dhcp_option"]) {
+			code, val, ok := strings.Cut(o, ",")
+			if !ok {
+				return uci.At(fmt.Errorf("dhcp_option %q must be <code>,<value>", o), append(p, "dhcp_option", i)...)
+			}
+			switch code {
+			case "3", "option:router":
+				gw = val
+			case "6", "option:dns-server":
+				dns = val
+			case "15", "option:domain-name":
+				domain = val
+			default:
+				return uci.At(fmt.Errorf("dhcp_option %s is not supported by routeros backend", code), append(p, "dhcp_option", i)...)
+			}
+		}
+		c.addTagged("/ip dhcp-server network", "", "address", ipnet.String(), "gateway", gw, "dns-server", dns, "domain", domain)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	hosts, err := list(d["hosts"], "hosts")
+	if err != nil {
+		return err
+	}
+	seenMAC, seenIP := map[string]int{}, map[string]int{}
+	for i, h := range hosts {
+		m, _ := uci.AsMap(h)
+		mac, merr := net.ParseMAC(uci.GetString(m, "mac", ""))
+		ip := uci.GetString(m, "ip", "")
+		switch {
+		case merr != nil:
+			return uci.At(fmt.Errorf("bad mac %q (single mac only)", uci.GetString(m, "mac", "")), "dhcp", "hosts", i)
+		case net.ParseIP(ip) == nil || net.ParseIP(ip).To4() == nil:
+			return uci.At(fmt.Errorf("bad ip %q", ip), "dhcp", "hosts", i)
+		}
+		macStr := strings.ToUpper(mac.String())
+		if j, dup := seenMAC[macStr]; dup {
+			return uci.At(fmt.Errorf("mac %s already used by hosts[%d]", macStr, j), "dhcp", "hosts", i)
+		}
+		if j, dup := seenIP[ip]; dup {
+			return uci.At(fmt.Errorf("ip %s already used by hosts[%d]", ip, j), "dhcp", "hosts", i)
+		}
+		seenMAC[macStr], seenIP[ip] = i, i
+		c.addTagged("/ip dhcp-server lease", uci.GetString(m, "name", ""), "mac-address", macStr, "address", ip,
+			"lease-time", uci.GetString(m, "leasetime", ""))
+	}
+
+	domains, err := list(d["domains"], "domains")
+	if err != nil {
+		return err
+	}
+	for i, x := range domains {
+		m, _ := uci.AsMap(x)
+		name, ip := uci.GetString(m, "name", ""), uci.GetString(m, "ip", "")
+		if name == "" || net.ParseIP(ip) == nil {
+			return uci.At(fmt.Errorf("name and a valid ip are required"), "dhcp", "domains", i)
+		}
+		c.addTagged("/ip dns static", "", "name", name, "address", ip)
+	}
+	return nil
+}
+
+// poolRange — адреса пула: сеть + start .. сеть + start + limit - 1, не выходя за broadcast.
+func poolRange(n *net.IPNet, start, limit int) (string, string, error) {
+	base := n.IP.To4()
+	if base == nil {
+		return "", "", fmt.Errorf("dhcp server needs an IPv4 subnet")
+	}
+	ones, bits := n.Mask.Size()
+	size := 1 << (bits - ones)
+	if start < 1 || limit < 1 || start >= size-1 {
+		return "", "", fmt.Errorf("start %d / limit %d do not fit into %s", start, limit, n)
+	}
+	end := min(start+limit-1, size-2)
+	b := binary.BigEndian.Uint32(base)
+	ip := func(off int) string {
+		out := make(net.IP, 4)
+		binary.BigEndian.PutUint32(out, b+uint32(off))
+		return out.String()
+	}
+	return ip(start), ip(end), nil
+}
+
+// list — массив NetJSON; оставшийся {"$var": ...} значит, что переменной у устройства нет.
+func list(v any, key string) ([]any, error) {
+	if m, ok := uci.AsMap(v); ok {
+		if path, ok := m["$var"].(string); ok {
+			return nil, fmt.Errorf("%s: unresolved variable %q", key, path)
+		}
+		return nil, fmt.Errorf("%s: expected array", key)
+	}
+	items, _ := uci.AsSlice(v)
+	return items, nil
+}
@@ -0,0 +1,561 @@
+package routeros
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"wisp/internal/render/uci"
+)
+
+// ===== firewall =====
+// Схема та же, что у uci. Зона → /interface list wisp-<zone> с членами; фильтр строится как у fw4:
+//
+//	input/forward/output — established/related, затем правила src/dest "*", затем jump
+//	в wisp-in-<zone>/wisp-fwd-<zone>/wisp-out-<zone> по списку интерфейсов; в конце цепочки зоны — policy.
+//	Неизвестные зонам интерфейсы: input/output — accept, forward — drop.
+//
+// Фильтр пишется и в /ip, и в /ipv6 (правила с адресами одного семейства или icmp/icmpv6 — только
+// в своё); NAT (redirects, masq) — только IPv4. Правила добавляются в конец цепочек: defconf-правила
+// RouterOS, если они есть, срабатывают раньше.
+
+var rosActions = map[string]string{"ACCEPT": "accept", "REJECT": "reject", "DROP": "drop"}
+
+var rosZoneName = regexp.MustCompile(`^[A-Za-z0-9_]{1,11}$`)
+
+// icmpTypes — имена icmp_type (как у fw4) → icmp-options RouterOS; числа "8" / "8:0" — как есть.
+var icmpTypes = map[string]map[string]string{
+	"ipv4": {
+		"echo-reply": "0:0", "destination-unreachable": "3:0-255", "source-quench": "4:0", "redirect": "5:0-255",
+		"echo-request": "8:0", "router-advertisement": "9:0", "router-solicitation": "10:0",
+		"time-exceeded": "11:0-255", "parameter-problem": "12:0-255",
+	},
+	"ipv6": {
+		"destination-unreachable": "1:0-255", "packet-too-big": "2:0", "time-exceeded": "3:0-255",
+		"parameter-problem": "4:0-255", "echo-request": "128:0", "echo-reply": "129:0",
+		"router-solicitation": "133:0", "router-advertisement": "134:0",
+		"neighbour-solicitation": "135:0", "neighbor-solicitation": "135:0",
+		"neighbour-advertisement": "136:0", "neighbor-advertisement": "136:0",
+	},
+}
+
+var icmpNumeric = regexp.MustCompile(`^[0-9]{1,3}(:[0-9]{1,3}(-[0-9]{1,3})?)?$`)
+
+type rosZone struct {
+	name                   string
+	input, output, forward string
+	hasDevs                bool
+}
+
+// rosRule — правило фильтра: family "" — в /ip и /ipv6.
+type rosRule struct {
+	family string
+	name   string
+	kv     []string
+}
+
+type rosSet struct {
+	family string // ipv4 | ipv6
+	key    string // src-address-list | dst-address-list
+}
+
+type fwBuilder struct {
+	c      *context
+	zones  map[string]*rosZone
+	order  []string
+	chains map[string][]rosRule
+	sets   map[string]rosSet
+	dnat   bool
+}
+
+func (c *context) renderFirewall(v any) error {
+	fw, _ := uci.AsMap(v)
+	if fw == nil {
+		return nil
+	}
+	b := &fwBuilder{c: c, zones: map[string]*rosZone{}, chains: map[string][]rosRule{}, sets: map[string]rosSet{}}
+	if err := uci.EachItem(fw["zones"], []any{"firewall", "zones"}, b.zone); err != nil {
+		return err
+	}
+	if err := uci.EachItem(fw["ipsets"], []any{"firewall", "ipsets"}, b.ipset); err != nil {
+		return err
+	}
+	steps := []struct {
+		key string
+		fn  func(m map[string]any, i int) error
+	}{
+		// правила раньше forwardings: DROP/REJECT в правиле должен сработать до общего accept
+		{"rules", b.rule},
+		{"forwardings", b.forwarding},
+		{"redirects", b.redirect},
+	}
+	for _, s := range steps {
+		items, _ := uci.AsSlice(fw[s.key])
+		for i, it := range items {
+			m, _ := uci.AsMap(it)
+			if err := s.fn(m, i); err != nil {
+				return uci.At(err, "firewall", s.key, i)
+			}
+		}
+	}
+	if inc, _ := uci.AsSlice(fw["includes"]); len(inc) > 0 {
+		return uci.At(fmt.Errorf("includes are not supported by routeros backend"), "firewall", "includes")
+	}
+	b.emit()
+	return nil
+}
+
+func (b *fwBuilder) zone(m map[string]any, p []any) error {
+	name := uci.GetString(m, "name", "")
+	if name == "" {
+		b.c.Invalid(uci.Pointer(p...), "zone without name is skipped")
+		return nil
+	}
+	if !rosZoneName.MatchString(name) {
+		return uci.At(fmt.Errorf("bad zone name %q", name), p...)
+	}
+	if b.zones[name] != nil {
+		return uci.At(fmt.Errorf("duplicate zone %q", name), p...)
+	}
+	z := &rosZone{name: name}
+	for _, k := range []struct {
+		key, def string
+		dst      *string
+	}{{"input", "ACCEPT", &z.input}, {"output", "ACCEPT", &z.output}, {"forward", "REJECT", &z.forward}} {
+		pol := strings.ToUpper(uci.GetString(m, k.key, k.def))
+		if rosActions[pol] == "" {
+			return uci.At(fmt.Errorf("zone %s: bad %s policy %q", name, k.key, pol), p...)
+		}
+		*k.dst = rosActions[pol]
+	}
+	if len(uci.StrList(m["subnets"])) > 0 {
+		return uci.At(fmt.Errorf("subnets are not supported by routeros backend"), append(p, "subnets")...)
+	}
+	list := "wisp-" + name
+	b.c.addTagged("/interface list", "", "name", list)
+	seen := map[string]bool{}
+	member := func(dev string) {
+		if !seen[dev] {
+			seen[dev] = true
+			b.c.addTagged("/interface list member", "", "list", list, "interface", dev)
+		}
+	}
+	for i, n := range uci.StrList(m["networks"]) {
+		if _, ok := b.c.aliases[n]; !ok {
+			b.c.Invalid(uci.Pointer(append(p, "networks", i)...), "unknown network %q", n)
+		}
+		member(b.c.ifaceFor(n))
+	}
+	for _, d := range uci.StrList(m["devices"]) {
+		member(d)
+	}
+	z.hasDevs = len(seen) > 0
+	if !z.hasDevs {
+		b.c.Invalid(uci.Pointer(p...), "zone %s has no networks or devices", name)
+	}
+
+	if z.hasDevs && uci.GetBool(m, "masq", false) {
+		srcs := uci.StrList(m["masq_src"])
+		if len(srcs) == 0 {
+			srcs = []string{""}
+		}
+		for _, src := range srcs {
+			b.c.addTagged("/ip firewall nat", "", "chain", "srcnat", "out-interface-list", list, "src-address", src, "action", "masquerade")
+		}
+	}
+	if uci.GetBool(m, "masq6", false) {
+		return uci.At(fmt.Errorf("masq6 is not supported by routeros backend"), append(p, "masq6")...)
+	}
+	if z.hasDevs && uci.GetBool(m, "mtu_fix", false) {
+		b.c.addTagged("/ip firewall mangle", "", "chain", "forward", "out-interface-list", list, "protocol", "tcp",
+			"tcp-flags", "syn", "action", "change-mss", "new-mss", "clamp-to-pmtu", "passthrough", "yes")
+	}
+	b.zones[name] = z
+	b.order = append(b.order, name)
+	return nil
+}
+
+func (b *fwBuilder) zoneRef(z string) error {
+	if z == "" || z == "*" || len(b.zones) == 0 || b.zones[z] != nil {
+		return nil
+	}
+	return fmt.Errorf("unknown zone %q", z)
+}
+
+// chain — цепочка зоны или базовая для "*"/пустой зоны.
+func chain(hook, zone string) string {
+	if zone == "" || zone == "*" {
+		return hook
+	}
+	short := map[string]string{"input": "in", "forward": "fwd", "output": "out"}[hook]
+	return "wisp-" + short + "-" + zone
+}
+
+func (b *fwBuilder) ipset(m map[string]any, p []any) error {
+	name := uci.GetString(m, "name", "")
+	match := uci.StrList(m["match"])
+	if name == "" || len(match) == 0 {
+		return uci.At(fmt.Errorf("name and match are required"), p...)
+	}
+	dir, kind, _ := strings.Cut(match[0], "_")
+	if len(match) > 1 || (dir != "src" && dir != "dest") || (kind != "ip" && kind != "net") {
+		return uci.At(fmt.Errorf("only single src_ip/src_net/dest_ip/dest_net match is supported by routeros backend"), append(p, "match")...)
+	}
+	family := uci.GetString(m, "family", "")
+	for _, e := range uci.StrList(m["entries"]) {
+		f := uci.AddrFamily(e)
+		if f == "" || (family != "" && family != f) {
+			return uci.At(fmt.Errorf("bad entry %q", e), append(p, "entries")...)
+		}
+		family = f
+	}
+	if family == "" {
+		family = "ipv4"
+	}
+	menu := "/ip firewall address-list"
+	if family == "ipv6" {
+		menu = "/ipv6 firewall address-list"
+	}
+	for _, e := range uci.StrList(m["entries"]) {
+		b.c.addTagged(menu, "", "list", "wisp-"+name, "address", e)
+	}
+	s := rosSet{family: family, key: "src-address-list"}
+	if dir == "dest" {
+		s.key = "dst-address-list"
+	}
+	b.sets[name] = s
+	return nil
+}
+
+func (b *fwBuilder) forwarding(m map[string]any, _ int) error {
+	src, dest := uci.GetString(m, "src", ""), uci.GetString(m, "dest", "")
+	if src == "" || dest == "" {
+		return fmt.Errorf("src and dest are required")
+	}
+	for _, z := range []string{src, dest} {
+		if err := b.zoneRef(z); err != nil {
+			return err
+		}
+	}
+	r := rosRule{family: uci.GetString(m, "family", "")}
+	if r.family != "" && r.family != "ipv4" && r.family != "ipv6" {
+		r.family = ""
+	}
+	if dest != "*" {
+		r.kv = []string{"out-interface-list", "wisp-" + dest}
+	}
+	r.kv = append(r.kv, "action", "accept")
+	b.chains[chain("forward", src)] = append(b.chains[chain("forward", src)], r)
+	return nil
+}
+
+// rule: src+dest → wisp-fwd-<src>, только src → wisp-in-<src>, только dest (или ничего) → wisp-out-<dest>.
+func (b *fwBuilder) rule(m map[string]any, i int) error {
+	if !uci.GetBool(m, "enabled", true) {
+		return nil
+	}
+	src, dest := uci.GetString(m, "src", ""), uci.GetString(m, "dest", "")
+	for _, z := range []string{src, dest} {
+		if err := b.zoneRef(z); err != nil {
+			return err
+		}
+	}
+	family, variants, err := b.match(m, "tcpudp", "src_port", "dest_port")
+	if err != nil {
+		return err
+	}
+	var ch string
+	var pre []string
+	switch {
+	case src != "" && dest != "":
+		ch = chain("forward", src)
+		if dest != "*" {
+			pre = []string{"out-interface-list", "wisp-" + dest}
+		}
+	case src != "":
+		ch = chain("input", src)
+	default:
+		ch = chain("output", dest)
+	}
+	var post []string
+	if lim := uci.GetString(m, "limit", ""); lim != "" {
+		l, err := rosLimit(lim, uci.GetInt(m, "limit_burst", 5))
+		if err != nil {
+			return err
+		}
+		post = append(post, "limit", l)
+	}
+	target := strings.ToUpper(uci.GetString(m, "target", "ACCEPT"))
+	action := rosActions[target]
+	if action == "" {
+		return fmt.Errorf("target %q is not supported by routeros backend", target)
+	}
+	post = append(post, "action", action)
+	name := uci.GetString(m, "name", fmt.Sprintf("rule_%d", i+1))
+	for _, v := range variants {
+		kv := append(append(append([]string{}, pre...), v...), post...)
+		b.chains[ch] = append(b.chains[ch], rosRule{family: family, name: name, kv: kv})
+	}
+	return nil
+}
+
+// redirect: DNAT (dst-nat/redirect из src) или SNAT (src-nat на src_dip), только IPv4.
+func (b *fwBuilder) redirect(m map[string]any, i int) error {
+	if !uci.GetBool(m, "enabled", true) {
+		return nil
+	}
+	target := strings.ToUpper(uci.GetString(m, "target", "DNAT"))
+	proto := uci.GetString(m, "proto", "tcp udp")
+	name := uci.GetString(m, "name", fmt.Sprintf("redirect_%d", i+1))
+	switch target {
+	case "DNAT":
+		src := uci.GetString(m, "src", "wan")
+		if err := b.zoneRef(src); err != nil {
+			return err
+		}
+		ip, port := uci.GetString(m, "dest_ip", ""), uci.GetString(m, "dest_port", "")
+		if ip == "" && port == "" {
+			return fmt.Errorf("DNAT needs dest_ip or dest_port")
+		}
+		if uci.GetString(m, "src_dport", "") == "" && proto != "all" && proto != "icmp" {
+			return fmt.Errorf("DNAT needs src_dport for proto %s", proto)
+		}
+		if ip != "" && uci.AddrFamily(ip) != "ipv4" {
+			return fmt.Errorf("dest_ip %q: only IPv4 DNAT is supported by routeros backend", ip)
+		}
+		_, variants, err := b.match(map[string]any{
+			"proto": proto, "src_ip": m["src_ip"], "dest_ip": m["src_dip"],
+			"src_port": m["src_port"], "dest_port": m["src_dport"], "family": "ipv4",
+		}, proto, "src_port", "dest_port")
+		if err != nil {
+			return err
+		}
+		post := []string{"action", "dst-nat", "to-addresses", ip, "to-ports", port}
+		if ip == "" {
+			post = []string{"action", "redirect", "to-ports", port}
+		}
+		for _, v := range variants {
+			kv := append(append([]string{"chain", "dstnat", "in-interface-list", "wisp-" + src}, v...), post...)
+			b.c.addTagged("/ip firewall nat", name, kv...)
+		}
+		b.dnat = true
+	case "SNAT":
+		dip, dest := uci.GetString(m, "src_dip", ""), uci.GetString(m, "dest", "")
+		if dip == "" {
+			return fmt.Errorf("SNAT needs src_dip")
+		}
+		if dest == "" {
+			return fmt.Errorf("SNAT needs dest zone")
+		}
+		if err := b.zoneRef(dest); err != nil {
+			return err
+		}
+		_, variants, err := b.match(map[string]any{
+			"proto": proto, "src_ip": m["src_ip"], "dest_ip": m["dest_ip"],
+			"src_port": m["src_port"], "dest_port": m["dest_port"], "family": "ipv4",
+		}, proto, "src_port", "dest_port")
+		if err != nil {
+			return err
+		}
+		for _, v := range variants {
+			kv := append(append([]string{"chain", "srcnat", "out-interface-list", "wisp-" + dest}, v...),
+				"action", "src-nat", "to-addresses", dip)
+			b.c.addTagged("/ip firewall nat", name, kv...)
+		}
+	default:
+		return fmt.Errorf("unknown target %q", target)
+	}
+	return nil
+}
+
+// match — условия правила. RouterOS не знает множеств протоколов и адресов в одном правиле,
+// поэтому возвращаются варианты (декартово произведение protocol × src × dst × icmp-options).
+func (b *fwBuilder) match(m map[string]any, defProto, sportKey, dportKey string) (string, [][]string, error) {
+	family := uci.GetString(m, "family", "")
+	if family == "any" {
+		family = ""
+	}
+	if family != "" && family != "ipv4" && family != "ipv6" {
+		return "", nil, fmt.Errorf("unknown family %q", family)
+	}
+	addrs := map[string][]string{}
+	for _, k := range []string{"src_ip", "dest_ip"} {
+		for _, a := range uci.StrList(m[k]) {
+			f := uci.AddrFamily(a)
+			if f == "" {
+				return "", nil, fmt.Errorf("bad %s %q", k, a)
+			}
+			if family != "" && family != f {
+				return "", nil, fmt.Errorf("mixed ipv4/ipv6 addresses")
+			}
+			family = f
+			addrs[k] = append(addrs[k], a)
+		}
+	}
+
+	var protos []string
+	for _, p := range strings.Fields(strings.ReplaceAll(uci.GetString(m, "proto", defProto), ",", " ")) {
+		switch p {
+		case "tcpudp":
+			protos = append(protos, "tcp", "udp")
+		case "all":
+		case "icmp", "icmpv6":
+			want := map[string]string{"icmp": "ipv4", "icmpv6": "ipv6"}[p]
+			if family != "" && family != want {
+				return "", nil, fmt.Errorf("proto %s does not match family %s", p, family)
+			}
+			family = want
+			protos = append(protos, p)
+		default:
+			protos = append(protos, p)
+		}
+	}
+
+	variants := [][]string{{}}
+	cross := func(key string, vals []string) {
+		if len(vals) == 0 {
+			return
+		}
+		var out [][]string
+		for _, v := range variants {
+			for _, x := range vals {
+				out = append(out, append(append([]string{}, v...), key, x))
+			}
+		}
+		variants = out
+	}
+	cross("protocol", protos)
+	cross("src-address", addrs["src_ip"])
+	cross("dst-address", addrs["dest_ip"])
+
+	for _, k := range []struct{ key, ros string }{{sportKey, "src-port"}, {dportKey, "dst-port"}} {
+		ports := strings.Fields(strings.ReplaceAll(uci.GetString(m, k.key, ""), ",", " "))
+		if len(ports) == 0 {
+			continue
+		}
+		if len(protos) == 0 {
+			return "", nil, fmt.Errorf("%s needs proto tcp/udp", k.key)
+		}
+		for _, p := range protos {
+			if p != "tcp" && p != "udp" && p != "sctp" && p != "udp-lite" {
+				return "", nil, fmt.Errorf("%s needs proto tcp/udp, got %s", k.key, strings.Join(protos, " "))
+			}
+		}
+		for _, p := range ports {
+			if !portRange.MatchString(p) {
+				return "", nil, fmt.Errorf("bad %s %q", k.key, p)
+			}
+		}
+		for i := range variants {
+			variants[i] = append(variants[i], k.ros, strings.Join(ports, ","))
+		}
+	}
+
+	if icmp := uci.StrList(m["icmp_type"]); len(icmp) > 0 {
+		if len(protos) != 1 || (protos[0] != "icmp" && protos[0] != "icmpv6") {
+			return "", nil, fmt.Errorf("icmp_type needs proto icmp or icmpv6")
+		}
+		var opts []string
+		for _, t := range icmp {
+			o := icmpTypes[family][t]
+			if o == "" && icmpNumeric.MatchString(t) {
+				o = t
+			}
+			if o == "" {
+				return "", nil, fmt.Errorf("unknown icmp_type %q", t)
+			}
+			opts = append(opts, o)
+		}
+		cross("icmp-options", opts)
+	}
+
+	if name := uci.GetString(m, "ipset", ""); name != "" {
+		s, ok := b.sets[name]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown ipset %q", name)
+		}
+		if family != "" && family != s.family {
+			return "", nil, fmt.Errorf("ipset %s is %s, rule is %s", name, s.family, family)
+		}
+		family = s.family
+		for i := range variants {
+			variants[i] = append(variants[i], s.key, "wisp-"+name)
+		}
+	}
+	if mac := uci.GetString(m, "src_mac", ""); mac != "" {
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			return "", nil, fmt.Errorf("bad src_mac %q", mac)
+		}
+		for i := range variants {
+			variants[i] = append(variants[i], "src-mac-address", strings.ToUpper(hw.String()))
+		}
+	}
+	return family, variants, nil
+}
+
+var portRange = regexp.MustCompile(`^[0-9]{1,5}(-[0-9]{1,5})?$`)
+
+// rosLimit — "10/sec" (как у fw4) → "10/1s,5:packet".
+func rosLimit(l string, burst int) (string, error) {
+	n, unit, ok := strings.Cut(l, "/")
+	if _, err := strconv.Atoi(n); !ok || err != nil {
+		return "", fmt.Errorf("bad limit %q", l)
+	}
+	for _, u := range []struct{ name, ros string }{{"second", "1s"}, {"minute", "1m"}, {"hour", "1h"}, {"day", "1d"}} {
+		if unit != "" && strings.HasPrefix(u.name, unit) {
+			return fmt.Sprintf("%s/%s,%d:packet", n, u.ros, burst), nil
+		}
+	}
+	return "", fmt.Errorf("bad limit unit in %q", l)
+}
+
+// emit раскладывает цепочки по /ip и /ipv6 firewall filter.
+func (b *fwBuilder) emit() {
+	for _, fam := range []struct{ family, menu string }{{"ipv4", "/ip firewall filter"}, {"ipv6", "/ipv6 firewall filter"}} {
+		add := func(ch string, r rosRule) {
+			if r.family == "" || r.family == fam.family {
+				b.c.addTagged(fam.menu, r.name, append([]string{"chain", ch}, r.kv...)...)
+			}
+		}
+		base := func(ch, dir string, pre, post []rosRule) {
+			for _, r := range pre {
+				add(ch, r)
+			}
+			for _, r := range b.chains[ch] {
+				add(ch, r)
+			}
+			for _, z := range b.order {
+				if b.zones[z].hasDevs {
+					add(ch, rosRule{kv: []string{dir, "wisp-" + z, "action", "jump", "jump-target", chain(ch, z)}})
+				}
+			}
+			for _, r := range post {
+				add(ch, r)
+			}
+		}
+		established := []rosRule{
+			{kv: []string{"connection-state", "established,related", "action", "accept"}},
+			{kv: []string{"connection-state", "invalid", "action", "drop"}},
+		}
+		base("input", "in-interface-list", established, nil)
+		fwd := established
+		if b.dnat {
+			fwd = append(append([]rosRule{}, established...), rosRule{family: "ipv4", kv: []string{"connection-nat-state", "dstnat", "action", "accept"}})
+		}
+		base("forward", "in-interface-list", fwd, []rosRule{{name: "unzoned forward", kv: []string{"action", "drop"}}})
+		base("output", "out-interface-list", established, nil)
+		for _, z := range b.order {
+			zone := b.zones[z]
+			for _, hp := range []struct{ hook, policy string }{{"input", zone.input}, {"forward", zone.forward}, {"output", zone.output}} {
+				ch := chain(hp.hook, z)
+				for _, r := range b.chains[ch] {
+					add(ch, r)
+				}
+				add(ch, rosRule{name: z + " " + hp.hook + " policy", kv: []string{"action", hp.policy}})
+			}
+		}
+	}
+}
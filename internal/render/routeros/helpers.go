@@ -0,0 +1,18 @@
+package routeros
+
+// ===== small helpers (общие — в uci: AsMap, GetString, EachItem, ...) =====
+
+// yesIf — "yes" или пусто (параметр не выводится, остаётся умолчание RouterOS).
+func yesIf(b bool) string {
+	if b {
+		return "yes"
+	}
+	return ""
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
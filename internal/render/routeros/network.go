@@ -0,0 +1,536 @@
+package routeros
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"wisp/internal/render/uci"
+)
+
+// ===== network =====
+// Логических интерфейсов в RouterOS нет: lan/wan из NetJSON отображаются на интерфейс
+// (ether2, bridge, bridge.10), адреса и DHCP-клиенты вешаются прямо на него.
+func (c *context) renderNetwork(v any) error {
+	netw, _ := uci.AsMap(v)
+	if err := c.renderBridges(netw); err != nil {
+		return err
+	}
+	renderIface := func(m map[string]any, p []any) error {
+		_, hasAddrs := m["addresses"]
+		_, hasType := m["type"]
+		if hasAddrs || hasType {
+			return c.netjsonInterface(m, p)
+		}
+		return c.flatInterface(m, p)
+	}
+	if err := uci.EachItem(netw["interfaces"], []any{"network", "interfaces"}, renderIface); err != nil {
+		return err
+	}
+	if err := uci.EachItem(c.nj["interfaces"], []any{"interfaces"}, renderIface); err != nil {
+		return err
+	}
+	for i, d := range uci.StrList(c.nj["dns_servers"]) {
+		if net.ParseIP(d) == nil {
+			c.Invalid(uci.Pointer("dns_servers", i), "%q is not an IP address", d)
+		}
+		c.addDNS(d)
+	}
+
+	for _, rt := range []struct {
+		v    any
+		path []any
+	}{{netw["routes"], []any{"network", "routes"}}, {c.nj["routes"], []any{"routes"}}} {
+		err := uci.EachItem(rt.v, rt.path, func(m map[string]any, p []any) error {
+			if err := c.route(m); err != nil {
+				return uci.At(err, p...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// RouterOS проверяет правила по порядку — сортируем по priority, как ядро
+	type rule struct {
+		m    map[string]any
+		p    []any
+		prio int
+	}
+	var rules []rule
+	for _, rt := range []struct {
+		v    any
+		path []any
+	}{{netw["ip_rules"], []any{"network", "ip_rules"}}, {c.nj["ip_rules"], []any{"ip_rules"}}} {
+		_ = uci.EachItem(rt.v, rt.path, func(m map[string]any, p []any) error {
+			rules = append(rules, rule{m: m, p: p, prio: uci.GetInt(m, "priority", 32766)})
+			return nil
+		})
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].prio < rules[j].prio })
+	for _, r := range rules {
+		if err := c.ipRule(r.m); err != nil {
+			return uci.At(err, r.p...)
+		}
+	}
+	return nil
+}
+
+func (c *context) addDNS(ip string) {
+	for _, d := range c.dns {
+		if d == ip {
+			return
+		}
+	}
+	c.dns = append(c.dns, ip)
+}
+
+// ifaceFor — интерфейс RouterOS для логического имени; неизвестное имя считается интерфейсом.
+func (c *context) ifaceFor(name string) string {
+	if d, ok := c.aliases[name]; ok {
+		return d
+	}
+	return name
+}
+
+// vlan — /interface vlan <parent>.<vid> (один на пару).
+func (c *context) vlan(parent string, vid int) (string, error) {
+	if vid < 1 || vid > 4094 {
+		return "", fmt.Errorf("vlan must be 1..4094")
+	}
+	name := fmt.Sprintf("%s.%d", parent, vid)
+	if c.vlans[name] {
+		return name, nil
+	}
+	c.vlans[name] = true
+	c.addTagged("/interface vlan", "", "name", name, "interface", parent, "vlan-id", strconv.Itoa(vid))
+	return name, nil
+}
+
+// flatInterface — { name, device, vlan, proto, ipaddr, netmask, gateway, ip6addr[], ip6gw, dns[], mtu, disabled }.
+// proto: static, dhcp, dhcpv6, none.
+func (c *context) flatInterface(m map[string]any, p []any) error {
+	name := uci.GetString(m, "name", "")
+	if name == "" {
+		c.Invalid(uci.Pointer(p...), "interface without name is skipped")
+		return nil
+	}
+	dev := uci.GetString(m, "device", name)
+	if vid := uci.GetInt(m, "vlan", 0); vid != 0 {
+		var err error
+		if dev, err = c.vlan(dev, vid); err != nil {
+			return uci.At(err, append(p, "vlan")...)
+		}
+	}
+	c.aliases[name] = dev
+	disabled := yesIf(uci.GetBool(m, "disabled", false))
+
+	switch proto := uci.GetString(m, "proto", "static"); proto {
+	case "static":
+		if ip := uci.GetString(m, "ipaddr", ""); ip != "" {
+			cidr, err := v4CIDR(ip, uci.GetString(m, "netmask", "255.255.255.0"))
+			if err != nil {
+				return uci.At(err, append(p, "ipaddr")...)
+			}
+			c.address(dev, cidr, disabled)
+		}
+		for i, a := range uci.StrList(m["ip6addr"]) {
+			if _, _, err := net.ParseCIDR(a); err != nil {
+				return uci.At(fmt.Errorf("%q is not a CIDR prefix", a), append(p, "ip6addr", i)...)
+			}
+			c.address(dev, a, disabled)
+		}
+		for _, k := range []string{"gateway", "ip6gw"} {
+			if gw := uci.GetString(m, k, ""); gw != "" {
+				if err := c.defaultRoute(gw); err != nil {
+					return uci.At(err, append(p, k)...)
+				}
+			}
+		}
+	case "dhcp":
+		c.addTagged("/ip dhcp-client", name, "interface", dev, "disabled", disabled)
+	case "dhcpv6":
+		c.addTagged("/ipv6 dhcp-client", name, "interface", dev, "request", "address", "add-default-route", "yes", "disabled", disabled)
+	case "none":
+	default:
+		return uci.At(fmt.Errorf("proto %q is not supported by routeros backend", proto), append(p, "proto")...)
+	}
+	for i, d := range uci.StrList(m["dns"]) {
+		if net.ParseIP(d) == nil {
+			return uci.At(fmt.Errorf("%q is not an IP address", d), append(p, "dns", i)...)
+		}
+		c.addDNS(d)
+	}
+	if mtu := uci.GetInt(m, "mtu", 0); mtu > 0 {
+		c.add("/interface", fmt.Sprintf("set [find where name=%s]", strq(dev)), "mtu", strconv.Itoa(mtu))
+	}
+	return nil
+}
+
+// netjsonInterface — схема netjsonconfig: name — интерфейс, network — логическое имя,
+// type bridge создаёт мост из bridge_members.
+func (c *context) netjsonInterface(m map[string]any, p []any) error {
+	dev := uci.GetString(m, "name", "")
+	if dev == "" {
+		return uci.At(fmt.Errorf("interface without name"), p...)
+	}
+	logical := uci.GetString(m, "network", strings.NewReplacer("-", "_", ".", "_").Replace(dev))
+	c.aliases[logical] = dev
+	c.aliases[dev] = dev
+	disabled := yesIf(uci.GetBool(m, "disabled", false) || !uci.GetBool(m, "autostart", true))
+
+	switch typ := uci.GetString(m, "type", "ethernet"); typ {
+	case "bridge":
+		c.addTagged("/interface bridge", "", "name", dev)
+		for _, port := range uci.StrList(m["bridge_members"]) {
+			c.addTagged("/interface bridge port", "", "bridge", dev, "interface", port)
+		}
+	case "ethernet", "wireless", "virtual", "loopback", "other":
+	default:
+		return uci.At(fmt.Errorf("unknown type %q", typ), append(p, "type")...)
+	}
+
+	err := uci.EachItem(m["addresses"], append(p, "addresses"), func(am map[string]any, ap []any) error {
+		proto, family := uci.GetString(am, "proto", "static"), uci.GetString(am, "family", "")
+		addr := uci.GetString(am, "address", "")
+		if family == "" {
+			family = uci.AddrFamily(addr)
+		}
+		switch {
+		case proto == "dhcp" && family == "ipv6":
+			c.addTagged("/ipv6 dhcp-client", logical, "interface", dev, "request", "address", "add-default-route", "yes", "disabled", disabled)
+		case proto == "dhcp":
+			c.addTagged("/ip dhcp-client", logical, "interface", dev, "disabled", disabled)
+		case proto == "none":
+		case proto == "static":
+			if f := uci.AddrFamily(addr); f == "" || (family != "" && f != family) {
+				return uci.At(fmt.Errorf("%q is not an %s address", addr, family), ap...)
+			}
+			bits := 32
+			if family == "ipv6" {
+				bits = 128
+			}
+			mask := uci.GetInt(am, "mask", min(bits, 64))
+			if mask < 0 || mask > bits {
+				return uci.At(fmt.Errorf("bad mask %d", mask), ap...)
+			}
+			c.address(dev, fmt.Sprintf("%s/%d", addr, mask), disabled)
+			if gw := uci.GetString(am, "gateway", ""); gw != "" {
+				if err := c.defaultRoute(gw); err != nil {
+					return uci.At(err, ap...)
+				}
+			}
+		default:
+			return uci.At(fmt.Errorf("unsupported proto %q", proto), ap...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if mtu := uci.GetInt(m, "mtu", 0); mtu > 0 {
+		c.add("/interface", fmt.Sprintf("set [find where name=%s]", strq(dev)), "mtu", strconv.Itoa(mtu))
+	}
+	return nil
+}
+
+// address — /ip address или /ipv6 address; первый IPv4 запоминается для DHCP-сервера.
+func (c *context) address(dev, cidr, disabled string) {
+	if uci.AddrFamily(cidr) == "ipv6" {
+		c.addTagged("/ipv6 address", "", "address", cidr, "interface", dev, "advertise", "no", "disabled", disabled)
+		return
+	}
+	if c.v4[dev] == "" {
+		c.v4[dev] = cidr
+	}
+	c.addTagged("/ip address", "", "address", cidr, "interface", dev, "disabled", disabled)
+}
+
+func (c *context) defaultRoute(gw string) error {
+	switch uci.AddrFamily(gw) {
+	case "ipv4":
+		c.addTagged("/ip route", "default", "dst-address", "0.0.0.0/0", "gateway", gw)
+	case "ipv6":
+		c.addTagged("/ipv6 route", "default", "dst-address", "::/0", "gateway", gw)
+	default:
+		return fmt.Errorf("%q is not an IP address", gw)
+	}
+	return nil
+}
+
+// renderBridges — network.bridges (схема как у uci): /interface bridge с vlan-filtering,
+// порты с pvid и /interface bridge vlan; сам мост — tagged-член каждого VLAN.
+func (c *context) renderBridges(netw map[string]any) error {
+	return uci.EachItem(netw["bridges"], []any{"network", "bridges"}, func(m map[string]any, p []any) error {
+		name := uci.GetString(m, "name", "")
+		if name == "" {
+			return uci.At(fmt.Errorf("name is required"), p...)
+		}
+		c.aliases[name] = name
+
+		type vlan struct {
+			vid              int
+			tagged, untagged []string
+		}
+		var vlans []vlan
+		pvid := map[string]int{}
+		ports := append([]string{}, uci.StrList(m["ports"])...)
+		hasPort := map[string]bool{}
+		for _, pt := range ports {
+			hasPort[pt] = true
+		}
+		seen := map[int]bool{}
+		items, _ := uci.AsSlice(m["vlans"])
+		for i, it := range items {
+			vm, _ := uci.AsMap(it)
+			vid := uci.GetInt(vm, "vid", 0)
+			if vid < 1 || vid > 4094 {
+				return uci.At(fmt.Errorf("vid must be 1..4094"), append(p, "vlans", i)...)
+			}
+			if seen[vid] {
+				return uci.At(fmt.Errorf("duplicate vid %d", vid), append(p, "vlans", i)...)
+			}
+			seen[vid] = true
+			v := vlan{vid: vid, tagged: []string{name}}
+			vports, _ := uci.AsSlice(vm["ports"])
+			for _, pt := range vports {
+				var port string
+				var tagged, isPVID bool
+				switch t := pt.(type) {
+				case string: // "lan1", "lan1:t", "lan1:u*" — как в OpenWrt
+					var flags string
+					port, flags, _ = strings.Cut(t, ":")
+					tagged, isPVID = strings.Contains(flags, "t"), strings.Contains(flags, "*")
+				case map[string]any:
+					port, tagged, isPVID = uci.GetString(t, "name", ""), uci.GetBool(t, "tagged", false), uci.GetBool(t, "pvid", false)
+				}
+				if port == "" {
+					return uci.At(fmt.Errorf("port without name"), append(p, "vlans", i)...)
+				}
+				if tagged {
+					v.tagged = append(v.tagged, port)
+				} else {
+					v.untagged = append(v.untagged, port)
+				}
+				if isPVID {
+					pvid[port] = vid
+				}
+				if !hasPort[port] {
+					hasPort[port] = true
+					ports = append(ports, port)
+				}
+			}
+			vlans = append(vlans, v)
+		}
+
+		kv := []string{"name", name, "vlan-filtering", yesNo(len(vlans) > 0)}
+		if mtu := uci.GetInt(m, "mtu", 0); mtu > 0 {
+			kv = append(kv, "mtu", strconv.Itoa(mtu))
+		}
+		if mac := uci.GetString(m, "mac", ""); mac != "" {
+			kv = append(kv, "auto-mac", "no", "admin-mac", mac)
+		}
+		c.addTagged("/interface bridge", "", kv...)
+		for _, pt := range ports {
+			kv := []string{"bridge", name, "interface", pt}
+			if v := pvid[pt]; v > 0 {
+				kv = append(kv, "pvid", strconv.Itoa(v))
+			}
+			c.addTagged("/interface bridge port", "", kv...)
+		}
+		for _, v := range vlans {
+			c.addTagged("/interface bridge vlan", "", "bridge", name, "vlan-ids", strconv.Itoa(v.vid),
+				"tagged", strings.Join(v.tagged, ","), "untagged", strings.Join(v.untagged, ","))
+		}
+		return nil
+	})
+}
+
+// route — routes[]: device — логический интерфейс; без next шлюзом служит сам интерфейс.
+func (c *context) route(m map[string]any) error {
+	dev := uci.GetString(m, "interface", uci.GetString(m, "device", ""))
+	dest := uci.GetString(m, "destination", "")
+	if dev == "" || dest == "" {
+		return fmt.Errorf("device and destination are required")
+	}
+	if !strings.Contains(dest, "/") {
+		switch uci.AddrFamily(dest) {
+		case "ipv4":
+			dest += "/32"
+		case "ipv6":
+			dest += "/128"
+		}
+	}
+	_, ipnet, err := net.ParseCIDR(dest)
+	if err != nil {
+		return fmt.Errorf("bad destination %q", dest)
+	}
+	family := uci.AddrFamily(ipnet.IP.String())
+	gw := uci.GetString(m, "next", uci.GetString(m, "gateway", ""))
+	if gw != "" && uci.AddrFamily(gw) != family {
+		return fmt.Errorf("gateway %q is not an %s address", gw, family)
+	}
+	if gw == "" {
+		gw = c.ifaceFor(dev)
+	}
+	kv := []string{"dst-address", ipnet.String(), "gateway", gw}
+	if src := uci.GetString(m, "source", ""); src != "" {
+		if uci.AddrFamily(src) != family {
+			return fmt.Errorf("source %q is not an %s address", src, family)
+		}
+		kv = append(kv, "pref-src", src)
+	}
+	if _, ok := m["cost"]; ok {
+		metric := uci.GetInt(m, "cost", -1)
+		if metric < 0 || metric > 255 {
+			return fmt.Errorf("cost must be 0..255 (RouterOS distance), got %v", m["cost"])
+		}
+		kv = append(kv, "distance", strconv.Itoa(metric))
+	}
+	if t := c.table(uci.GetString(m, "table", "")); t != "" {
+		kv = append(kv, "routing-table", t)
+	}
+	switch typ := uci.GetString(m, "type", "unicast"); typ {
+	case "unicast":
+	case "blackhole":
+		kv = append(kv, "blackhole", "yes")
+	default:
+		return fmt.Errorf("route type %q is not supported by routeros backend", typ)
+	}
+	menu := "/ip route"
+	if family == "ipv6" {
+		menu = "/ipv6 route"
+	}
+	c.addTagged(menu, "", kv...)
+	return nil
+}
+
+// table — таблица маршрутизации (v7 требует /routing table add ... fib); main — встроенная.
+func (c *context) table(t string) string {
+	if t == "" || t == "main" || t == "254" {
+		return ""
+	}
+	if !c.tables[t] {
+		c.tables[t] = true
+		c.addTagged("/routing table", "", "name", t, "fib", flag)
+	}
+	return t
+}
+
+// ipRuleActions — action ip rule → action /routing rule.
+var ipRuleActions = map[string]string{"prohibit": "unreachable", "unreachable": "unreachable", "blackhole": "drop"}
+
+func (c *context) ipRule(m map[string]any) error {
+	family := uci.GetString(m, "family", "")
+	for _, k := range []string{"src", "dest"} {
+		a := uci.GetString(m, k, "")
+		if a == "" {
+			continue
+		}
+		f := uci.AddrFamily(a)
+		if f == "" {
+			return fmt.Errorf("bad %s %q", k, a)
+		}
+		if family != "" && family != f {
+			return fmt.Errorf("%s %q does not match family %s", k, a, family)
+		}
+		family = f
+	}
+	lookup, action := uci.GetString(m, "lookup", ""), uci.GetString(m, "action", "")
+	if uci.GetString(m, "goto", "") != "" {
+		return fmt.Errorf("goto is not supported by routeros backend")
+	}
+	if (lookup == "") == (action == "") {
+		return fmt.Errorf("exactly one of lookup or action is required")
+	}
+	kv := []string{"src-address", uci.GetString(m, "src", ""), "dst-address", uci.GetString(m, "dest", "")}
+	if in := uci.GetString(m, "in", ""); in != "" {
+		kv = append(kv, "interface", c.ifaceFor(in))
+	}
+	if uci.GetString(m, "out", "") != "" || uci.GetString(m, "mark", "") != "" || uci.GetString(m, "tos", "") != "" || uci.GetBool(m, "invert", false) {
+		return fmt.Errorf("out, mark, tos and invert are not supported by routeros backend")
+	}
+	if lookup != "" {
+		t := c.table(lookup)
+		if t == "" {
+			t = "main"
+		}
+		kv = append(kv, "action", "lookup", "table", t)
+	} else {
+		a, ok := ipRuleActions[action]
+		if !ok {
+			return fmt.Errorf("action %q is not supported by routeros backend", action)
+		}
+		kv = append(kv, "action", a)
+	}
+	c.addTagged("/routing rule", "", kv...)
+	return nil
+}
+
+// ===== WireGuard =====
+// wireguard: { interface, address, private_key, listen_port, peers[] } — блок тот же, что для OpenWrt.
+func (c *context) renderWireGuard(v any) error {
+	wg, _ := uci.AsMap(v)
+	if wg == nil {
+		return nil
+	}
+	iface := uci.GetString(wg, "interface", "wg0")
+	key := uci.GetString(wg, "private_key", "")
+	if key == "" {
+		return uci.At(fmt.Errorf("private_key is required"), "wireguard")
+	}
+	kv := []string{"name", iface, "private-key", key}
+	if port := uci.GetInt(wg, "listen_port", uci.GetInt(wg, "port", 0)); port > 0 {
+		kv = append(kv, "listen-port", strconv.Itoa(port))
+	}
+	c.addTagged("/interface wireguard", "", kv...)
+	c.aliases[iface] = iface
+	for _, a := range uci.StrList(wg["address"]) {
+		if _, _, err := net.ParseCIDR(a); err != nil {
+			return uci.At(fmt.Errorf("%q is not a CIDR prefix", a), "wireguard", "address")
+		}
+		c.address(iface, a, "")
+	}
+	return uci.EachItem(wg["peers"], []any{"wireguard", "peers"}, func(m map[string]any, p []any) error {
+		pub := uci.GetString(m, "public_key", "")
+		if pub == "" {
+			return uci.At(fmt.Errorf("public_key is required"), p...)
+		}
+		kv := []string{"interface", iface, "public-key", pub, "preshared-key", uci.GetString(m, "preshared_key", "")}
+		if ep := uci.GetString(m, "endpoint", ""); ep != "" {
+			host, port, err := net.SplitHostPort(ep)
+			if err != nil {
+				return uci.At(fmt.Errorf("endpoint must be host:port: %v", err), append(p, "endpoint")...)
+			}
+			kv = append(kv, "endpoint-address", host, "endpoint-port", port)
+		}
+		kv = append(kv, "allowed-address", strings.Join(uci.StrList(m["allowed_ips"]), ","))
+		if ka := uci.GetInt(m, "keepalive", 0); ka > 0 {
+			kv = append(kv, "persistent-keepalive", strconv.Itoa(ka)+"s")
+		}
+		c.addTagged("/interface wireguard peers", "", kv...)
+		return nil
+	})
+}
+
+// v4CIDR — ipaddr + netmask (точечная или длина префикса) → "a.b.c.d/len".
+func v4CIDR(ip, mask string) (string, error) {
+	if p := net.ParseIP(ip); p == nil || p.To4() == nil {
+		return "", fmt.Errorf("%q is not an IPv4 address", ip)
+	}
+	if n, err := strconv.Atoi(mask); err == nil && n >= 0 && n <= 32 {
+		return fmt.Sprintf("%s/%d", ip, n), nil
+	}
+	m := net.ParseIP(mask).To4()
+	if m == nil {
+		return "", fmt.Errorf("bad netmask %q", mask)
+	}
+	ones, bits := net.IPMask(m).Size()
+	if bits == 0 {
+		return "", fmt.Errorf("bad netmask %q", mask)
+	}
+	return fmt.Sprintf("%s/%d", ip, ones), nil
+}
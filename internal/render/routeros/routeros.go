@@ -0,0 +1,314 @@
+// Package routeros — backend для MikroTik (RouterOS v7): тот же NetJSON рендерится в один
+// идемпотентный скрипт wisp.rsc для /import.
+//
+// Идемпотентность: каждый создаваемый объект помечается comment="wisp" (или "wisp: <имя>").
+// Скрипт безопасен при обрыве /import на середине: сначала метка всех прежних объектов меняется
+// на "wisp-stale" (они продолжают работать — firewall и адреса не пропадают), затем создаются
+// новые, и только в конце устаревшие удаляются (в обратном порядке зависимостей). Объект с
+// уникальным ключом (см. keys) заменяет устаревшего близнеца: с name — обновляется на месте (set),
+// остальные — remove близнеца непосредственно перед add. Если импорт оборвался, устаревшие
+// объекты остаются и снимаются следующим импортом. Объекты, заведённые руками без метки
+// (в том числе с комментарием вроде "wisphub"), не трогаются; singleton-настройки
+// (/system identity, /ip dns, ...) выставляются через set.
+//
+// Поддерживаются: system (hostname, zonename, ntp), network.interfaces / interfaces, network.bridges,
+// dns_servers, routes, ip_rules, wireguard, dhcp (servers, hosts, domains, dnsmasq.servers) и firewall.
+// Остальные ключи — *uci.UnclaimedKeysError, как у uci.RenderAll.
+package routeros
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"wisp/internal/render/uci"
+)
+
+// ScriptName — единственный файл, который отдаёт этот backend.
+const ScriptName = "wisp.rsc"
+
+// tag — метка управляемых объектов; stale — метка объектов прошлого импорта до их удаления.
+const (
+	tag   = "wisp"
+	stale = "wisp-stale"
+)
+
+// managed — регэксп RouterOS для comment управляемых объектов (и оставшихся от оборванного импорта).
+const managed = `^wisp(-stale)?(:|$)`
+
+var claimed = map[string]bool{
+	"type": true, "system": true, "network": true, "interfaces": true, "dns_servers": true,
+	"routes": true, "ip_rules": true, "wireguard": true, "dhcp": true, "firewall": true,
+}
+
+// menus — разделы RouterOS в порядке создания (зависимости раньше зависимых).
+// removable — устаревшие объекты с меткой удаляются в конце скрипта в обратном порядке.
+var menus = []struct {
+	path      string
+	removable bool
+}{
+	{"/system identity", false},
+	{"/system clock", false},
+	{"/system ntp client", false},
+	{"/interface bridge", true},
+	{"/interface vlan", true},
+	{"/interface wireguard", true},
+	{"/interface wireguard peers", true},
+	{"/interface bridge port", true},
+	{"/interface bridge vlan", true},
+	{"/interface", false},
+	{"/interface list", true},
+	{"/interface list member", true},
+	{"/ip address", true},
+	{"/ipv6 address", true},
+	{"/ip dhcp-client", true},
+	{"/ipv6 dhcp-client", true},
+	{"/ip dns", false},
+	{"/ip dns static", true},
+	{"/routing table", true},
+	{"/ip route", true},
+	{"/ipv6 route", true},
+	{"/routing rule", true},
+	{"/ip pool", true},
+	{"/ip dhcp-server", true},
+	{"/ip dhcp-server network", true},
+	{"/ip dhcp-server lease", true},
+	{"/ip firewall address-list", true},
+	{"/ipv6 firewall address-list", true},
+	{"/ip firewall mangle", true},
+	{"/ip firewall filter", true},
+	{"/ipv6 firewall filter", true},
+	{"/ip firewall nat", true},
+}
+
+// keys — поля, уникальные для объекта меню в RouterOS: новый объект с теми же значениями
+// заменяет устаревший (иначе add упадёт на дубликате). Меню без ключа (правила firewall,
+// policy routing) допускают дубликаты — старые правила работают, пока не удалены в конце.
+var keys = map[string][]string{
+	"/interface bridge":           {"name"},
+	"/interface vlan":             {"name"},
+	"/interface wireguard":        {"name"},
+	"/interface wireguard peers":  {"interface", "public-key"},
+	"/interface bridge port":      {"interface"},
+	"/interface bridge vlan":      {"bridge", "vlan-ids"},
+	"/interface list":             {"name"},
+	"/interface list member":      {"list", "interface"},
+	"/ip address":                 {"address", "interface"},
+	"/ipv6 address":               {"address", "interface"},
+	"/ip dhcp-client":             {"interface"},
+	"/ipv6 dhcp-client":           {"interface"},
+	"/ip dns static":              {"name"},
+	"/routing table":              {"name"},
+	"/ip route":                   {"dst-address", "gateway"},
+	"/ipv6 route":                 {"dst-address", "gateway"},
+	"/ip pool":                    {"name"},
+	"/ip dhcp-server":             {"name"},
+	"/ip dhcp-server network":     {"address"},
+	"/ip dhcp-server lease":       {"mac-address"},
+	"/ip firewall address-list":   {"list", "address"},
+	"/ipv6 firewall address-list": {"list", "address"},
+}
+
+type context struct {
+	nj   map[string]any
+	opts uci.Options
+
+	lines   map[string][]string // меню → команды
+	aliases map[string]string   // логическое имя интерфейса (lan, wan) → интерфейс RouterOS
+	v4      map[string]string   // интерфейс → первый статический IPv4 в CIDR (для DHCP-сервера)
+	dns     []string
+	tables  map[string]bool
+	vlans   map[string]bool
+
+	uci.Collector
+}
+
+// Render — аналог uci.RenderAll: один файл ScriptName.
+func Render(nj map[string]any, opts uci.Options) ([]uci.File, error) {
+	c := &context{nj: nj, opts: opts, Collector: uci.Collector{Strict: opts.Strict}, lines: map[string][]string{}, aliases: map[string]string{},
+		v4: map[string]string{}, tables: map[string]bool{}, vlans: map[string]bool{}}
+	steps := []struct {
+		key string
+		fn  func(v any) error
+	}{
+		{"system", c.renderSystem},
+		{"network", c.renderNetwork},
+		{"wireguard", c.renderWireGuard},
+		{"dhcp", c.renderDHCP},
+		{"firewall", c.renderFirewall},
+	}
+	for _, s := range steps {
+		if err := s.fn(nj[s.key]); err != nil {
+			if !opts.Strict {
+				return nil, fmt.Errorf("routeros: render %s: %w", s.key, err)
+			}
+			c.Fail(s.key, err)
+		}
+	}
+	if len(c.dns) > 0 {
+		c.add("/ip dns", "set", "servers", strings.Join(c.dns, ","))
+	}
+
+	var keys []string
+	for k := range nj {
+		if !claimed[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if opts.Strict {
+		for _, k := range keys {
+			c.Invalid(uci.Pointer(k), "not supported by routeros backend")
+		}
+		if len(c.Errs) > 0 {
+			return nil, uci.ValidationErrors(c.Errs)
+		}
+	}
+
+	files := []uci.File{{Name: ScriptName, Data: []byte(c.script()), Mode: 0644}}
+	if len(keys) > 0 {
+		return files, &uci.UnclaimedKeysError{Keys: keys}
+	}
+	return files, nil
+}
+
+// flag — значение-маркер для параметров без значения ("fib" у /routing table add).
+const flag = "\x00"
+
+// add дописывает команду в меню: kv — пары ключ/значение, пустые значения пропускаются.
+func (c *context) add(menu, verb string, kv ...string) {
+	c.lines[menu] = append(c.lines[menu], command(verb, kv...))
+}
+
+// command — "verb k=v ..." с теми же правилами, что у add.
+func command(verb string, kv ...string) string {
+	parts := []string{verb}
+	for i := 0; i+1 < len(kv); i += 2 {
+		switch kv[i+1] {
+		case "":
+		case flag:
+			parts = append(parts, kv[i])
+		default:
+			parts = append(parts, kv[i]+"="+quote(kv[i+1]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// addTagged — add с меткой: comment="wisp" или "wisp: <name>". Устаревший близнец по keys
+// обновляется на месте (объект с name: зависимые остаются привязанными) или удаляется перед add.
+func (c *context) addTagged(menu, name string, kv ...string) {
+	comment := tag
+	if name != "" {
+		comment += ": " + name
+	}
+	kv = append(kv, "comment", comment)
+	find := twin(menu, kv)
+	switch {
+	case find == "":
+		c.add(menu, "add", kv...)
+	case keys[menu][0] == "name":
+		set := make([]string, 0, len(kv))
+		for i := 0; i+1 < len(kv); i += 2 {
+			if kv[i+1] != flag { // флаги задаются только при создании
+				set = append(set, kv[i], kv[i+1])
+			}
+		}
+		c.lines[menu] = append(c.lines[menu], fmt.Sprintf(":if ([:len [%s find where %s]] > 0) do={ %s %s } else={ %s %s }",
+			menu, find, menu, command("set [find where "+find+"]", set...), menu, command("add", kv...)))
+	default:
+		c.add(menu, "remove [find where "+find+"]")
+		c.add(menu, "add", kv...)
+	}
+}
+
+// twin — условие find для устаревшего объекта с теми же keys; "" — у меню нет ключа
+// или в kv нет значения ключевого поля.
+func twin(menu string, kv []string) string {
+	if len(keys[menu]) == 0 {
+		return ""
+	}
+	conds := []string{"comment=" + strq(stale)}
+	for _, k := range keys[menu] {
+		v := ""
+		for i := 0; i+1 < len(kv); i += 2 {
+			if kv[i] == k {
+				v = kv[i+1]
+			}
+		}
+		if v == "" || v == flag {
+			return ""
+		}
+		conds = append(conds, k+"="+strq(v))
+	}
+	return strings.Join(conds, " and ")
+}
+
+func (c *context) script() string {
+	var b strings.Builder
+	b.WriteString("# generated by wisp, do not edit\n")
+	b.WriteString("# objects tagged comment=\"wisp...\" are replaced on every import: the previous ones are\n")
+	b.WriteString("# marked \"wisp-stale\" and keep working until the new ones are in place, then removed\n")
+	for _, m := range menus {
+		if m.removable {
+			fmt.Fprintf(&b, "%s set [find where comment~%s] comment=%s\n", m.path, strq(managed), stale)
+		}
+	}
+	for _, m := range menus {
+		if len(c.lines[m.path]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s\n", m.path)
+		for _, l := range c.lines[m.path] {
+			b.WriteString(l + "\n")
+		}
+	}
+	b.WriteString("\n")
+	for i := len(menus) - 1; i >= 0; i-- {
+		if menus[i].removable {
+			fmt.Fprintf(&b, "%s remove [find where comment=%s]\n", menus[i].path, strq(stale))
+		}
+	}
+	return b.String()
+}
+
+// bare — значения, которые RouterOS принимает без кавычек.
+var bare = regexp.MustCompile(`^[A-Za-z0-9._:/,*-]+$`)
+
+// quote — строка RouterOS: в кавычках экранируются \ " $ ?.
+func quote(s string) string {
+	if bare.MatchString(s) {
+		return s
+	}
+	return strq(s)
+}
+
+// strq — всегда в кавычках (для выражений [find where name=...]).
+func strq(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, `?`, `\?`).Replace(s) + `"`
+}
+
+// ===== system =====
+// system: { hostname, zonename, ntp: { enabled, servers[] } }; leds, log_*, root_password — только OpenWrt.
+func (c *context) renderSystem(v any) error {
+	sys, _ := uci.AsMap(v)
+	if hn := uci.GetString(sys, "hostname", c.opts.DeviceHostname); hn != "" {
+		c.add("/system identity", "set", "name", hn)
+	}
+	if zone := uci.GetString(sys, "zonename", ""); zone != "" {
+		c.add("/system clock", "set", "time-zone-autodetect", "no", "time-zone-name", zone)
+	}
+	if ntp, ok := uci.AsMap(sys["ntp"]); ok {
+		enabled := uci.GetBool(ntp, "enabled", true)
+		c.add("/system ntp client", "set", "enabled", yesNo(enabled), "servers", strings.Join(uci.StrList(ntp["servers"]), ","))
+	}
+	for k := range sys {
+		switch k {
+		case "hostname", "zonename", "ntp":
+		default:
+			c.Invalid(uci.Pointer("system", k), "not supported by routeros backend")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package routeros
+
+import (
+	"encoding/json"
+	stdflag "flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"wisp/internal/render/uci"
+)
+
+var update = stdflag.Bool("update", false, "rewrite testdata/*.rsc from the current Render output")
+
+// TestRenderGolden: testdata/<name>.json → Render → сравнение с testdata/<name>.rsc.
+// После намеренного изменения вывода: go test ./internal/render/routeros -update.
+func TestRenderGolden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no testdata/*.json")
+	}
+	for _, in := range inputs {
+		name := strings.TrimSuffix(filepath.Base(in), ".json")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var nj map[string]any
+			if err := json.Unmarshal(raw, &nj); err != nil {
+				t.Fatal(err)
+			}
+			files, err := Render(nj, uci.Options{DeviceHostname: "golden", Strict: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1 || files[0].Name != ScriptName {
+				t.Fatalf("want only %s, got %d files", ScriptName, len(files))
+			}
+			got := string(files[0].Data)
+			golden := strings.TrimSuffix(in, ".json") + ".rsc"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("output differs from %s:\n%s", golden, lineDiff(string(want), got))
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	cases := []struct{ in, quote, strq string }{
+		{"ether1", "ether1", `"ether1"`},
+		{"192.168.1.0/24", "192.168.1.0/24", `"192.168.1.0/24"`},
+		{"", `""`, `""`},
+		{"two words", `"two words"`, `"two words"`},
+		{`say "hi"`, `"say \"hi\""`, `"say \"hi\""`},
+		{`C:\path`, `"C:\\path"`, `"C:\\path"`},
+		{"$var", `"\$var"`, `"\$var"`},
+		{"what?", `"what\?"`, `"what\?"`},
+		{"a;b", `"a;b"`, `"a;b"`},
+		{"key=value", `"key=value"`, `"key=value"`},
+		{"base64+/==", `"base64+/=="`, `"base64+/=="`},
+	}
+	for _, c := range cases {
+		if got := quote(c.in); got != c.quote {
+			t.Errorf("quote(%q) = %s, want %s", c.in, got, c.quote)
+		}
+		if got := strq(c.in); got != c.strq {
+			t.Errorf("strq(%q) = %s, want %s", c.in, got, c.strq)
+		}
+	}
+}
+
+// Прежние объекты не удаляются, пока не добавлены новые: при обрыве /import на середине
+// firewall и адреса прошлой конфигурации продолжают работать.
+func TestScriptSafeOrder(t *testing.T) {
+	raw, err := os.ReadFile("testdata/dhcp-firewall.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nj map[string]any
+	if err := json.Unmarshal(raw, &nj); err != nil {
+		t.Fatal(err)
+	}
+	files, err := Render(nj, uci.Options{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastAdd, firstDrop := -1, -1
+	for i, l := range strings.Split(string(files[0].Data), "\n") {
+		switch {
+		case strings.HasPrefix(l, "#"):
+		case strings.HasPrefix(l, "add ") || strings.HasPrefix(l, ":if "):
+			lastAdd = i
+		case strings.HasSuffix(l, `remove [find where comment="wisp-stale"]`):
+			if firstDrop < 0 {
+				firstDrop = i
+			}
+		case strings.Contains(l, "remove") && !strings.Contains(l, `comment="wisp-stale" and `):
+			t.Errorf("line %d removes more than a stale twin: %s", i+1, l)
+		}
+	}
+	if lastAdd < 0 || firstDrop < lastAdd {
+		t.Errorf("stale objects are removed at line %d, before the last add at line %d", firstDrop+1, lastAdd+1)
+	}
+}
+
+func TestManagedComment(t *testing.T) {
+	re := regexp.MustCompile(managed)
+	for comment, want := range map[string]bool{
+		"wisp": true, "wisp: lan": true, "wisp:x": true, "wisp-stale": true,
+		"wisphub": false, "wisp-old": false, "my wisp": false, "": false,
+	} {
+		if got := re.MatchString(comment); got != want {
+			t.Errorf("managed ~ %q = %v, want %v", comment, got, want)
+		}
+	}
+}
+
+func TestAddTaggedTwin(t *testing.T) {
+	c := &context{lines: map[string][]string{}}
+	c.addTagged("/interface bridge", "", "name", "bridge", "vlan-filtering", "yes")
+	c.addTagged("/ip address", "", "address", "10.0.0.1/24", "interface", "bridge")
+	c.addTagged("/ip firewall filter", "", "chain", "input", "action", "accept")
+	c.addTagged("/routing table", "", "name", "wan2", "fib", flag)
+	want := map[string][]string{
+		"/interface bridge": {`:if ([:len [/interface bridge find where comment="wisp-stale" and name="bridge"]] > 0) do={ ` +
+			`/interface bridge set [find where comment="wisp-stale" and name="bridge"] name=bridge vlan-filtering=yes comment=wisp } ` +
+			`else={ /interface bridge add name=bridge vlan-filtering=yes comment=wisp }`},
+		"/ip address": {`remove [find where comment="wisp-stale" and address="10.0.0.1/24" and interface="bridge"]`,
+			`add address=10.0.0.1/24 interface=bridge comment=wisp`},
+		"/ip firewall filter": {`add chain=input action=accept comment=wisp`},
+		"/routing table": {`:if ([:len [/routing table find where comment="wisp-stale" and name="wan2"]] > 0) do={ ` +
+			`/routing table set [find where comment="wisp-stale" and name="wan2"] name=wan2 comment=wisp } ` +
+			`else={ /routing table add name=wan2 fib comment=wisp }`},
+	}
+	for menu, lines := range want {
+		if got := strings.Join(c.lines[menu], "\n"); got != strings.Join(lines, "\n") {
+			t.Errorf("%s:\n got %s\nwant %s", menu, got, strings.Join(lines, "\n"))
+		}
+	}
+}
+
+// lineDiff — первые расхождения построчно (want/got).
+func lineDiff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var b strings.Builder
+	n := 0
+	for i := 0; i < max(len(w), len(g)) && n < 10; i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			fmt.Fprintf(&b, "line %d:\n  want: %q\n  got:  %q\n", i+1, wl, gl)
+			n++
+		}
+	}
+	return b.String()
+}
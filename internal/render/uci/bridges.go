@@ -0,0 +1,276 @@
+package uci
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Режимы switch: DSA (OpenWrt 21.02+, config device/bridge-vlan) и legacy swconfig (switch_vlan).
+const (
+	SwitchDSA      = "dsa"
+	SwitchSwconfig = "swconfig"
+)
+
+// network.bridges:
+//
+//	[{"name": "br-lan", "ports": ["lan1", "lan2", "lan3"],
+//	  "vlans": [{"vid": 1, "ports": [{"name": "lan1", "pvid": true}, "lan2"]},
+//	            {"vid": 10, "ports": [{"name": "lan3", "tagged": true}]}],
+//	  "swconfig": {"device": "switch0", "cpu_port": 6, "cpu_ifname": "eth0",
+//	               "port_map": {"lan1": 1, "lan2": 2, "lan3": 3}}}]
+//
+// В режиме DSA рендерятся config device (type bridge) + config bridge-vlan;
+// в режиме swconfig — config switch + switch_vlan по port_map и отдельный мост <name>_<vid>
+// из <cpu_ifname>.<vid> на каждый VLAN; ссылки интерфейсов на "<name>.<vid>" переводятся
+// на него (см. bridgeDevice). Режим выбирается Options.SwitchMode (по модели устройства).
+
+type vlanPort struct {
+	name         string
+	tagged, pvid bool
+}
+
+type bridgeVLAN struct {
+	vid   int
+	ports []vlanPort
+}
+
+func renderBridges(netw map[string]any, c *Context) error {
+	bridges, _ := AsSlice(netw["bridges"])
+	mode := c.Opts.SwitchMode
+	if mode == "" {
+		mode = SwitchDSA
+	}
+	for i, b := range bridges {
+		m, _ := AsMap(b)
+		name := GetString(m, "name", "")
+		if name == "" {
+			return At(fmt.Errorf("name is required"), "network", "bridges", i)
+		}
+		// в DSA bridge-vlan может ссылаться только на порты самого моста; в swconfig порты VLAN —
+		// порты свитча из port_map, а мост собирается из <cpu_ifname>.<vid>
+		var members map[string]bool
+		if mode == SwitchDSA {
+			members = map[string]bool{}
+			for _, p := range StrList(m["ports"]) {
+				members[p] = true
+			}
+		}
+		vlans, err := parseBridgeVLANs(m, members)
+		if err != nil {
+			return At(err, "network", "bridges", i)
+		}
+		switch mode {
+		case SwitchDSA:
+			err = renderBridgeDSA(name, m, vlans, c)
+		case SwitchSwconfig:
+			err = renderBridgeSwconfig(name, m, vlans, c)
+		default:
+			err = fmt.Errorf("unknown switch mode %q", mode)
+		}
+		if err != nil {
+			return At(err, "network", "bridges", i)
+		}
+	}
+	return nil
+}
+
+// parseBridgeVLANs разбирает vlans моста; members != nil — порты VLAN обязаны быть в нём.
+func parseBridgeVLANs(m map[string]any, members map[string]bool) ([]bridgeVLAN, error) {
+	items, _ := AsSlice(m["vlans"])
+	out := make([]bridgeVLAN, 0, len(items))
+	seen := map[int]bool{}
+	for i, it := range items {
+		vm, _ := AsMap(it)
+		vid := GetInt(vm, "vid", 0)
+		if vid < 1 || vid > 4094 {
+			return nil, At(fmt.Errorf("vid must be 1..4094"), "vlans", i)
+		}
+		if seen[vid] {
+			return nil, At(fmt.Errorf("duplicate vid %d", vid), "vlans", i)
+		}
+		seen[vid] = true
+		v := bridgeVLAN{vid: vid}
+		ports, _ := AsSlice(vm["ports"])
+		for _, p := range ports {
+			switch t := p.(type) {
+			case string: // "lan1", "lan1:t", "lan1:u*" — как в самом OpenWrt
+				name, flags, _ := strings.Cut(t, ":")
+				v.ports = append(v.ports, vlanPort{name: name, tagged: strings.Contains(flags, "t"), pvid: strings.Contains(flags, "*")})
+			case map[string]any:
+				v.ports = append(v.ports, vlanPort{name: GetString(t, "name", ""), tagged: GetBool(t, "tagged", false), pvid: GetBool(t, "pvid", false)})
+			}
+		}
+		for j, p := range v.ports {
+			if p.name == "" {
+				return nil, At(fmt.Errorf("port without name"), "vlans", i)
+			}
+			if members != nil && !members[p.name] {
+				return nil, At(fmt.Errorf("port %q is not a member of the bridge", p.name), "vlans", i, "ports", j)
+			}
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func renderBridgeDSA(name string, m map[string]any, vlans []bridgeVLAN, c *Context) error {
+	d := &Section{Type: "device"}
+	opt(d, "name", name)
+	opt(d, "type", "bridge")
+	for _, p := range StrList(m["ports"]) {
+		lst(d, "ports", p)
+	}
+	if mtu := GetInt(m, "mtu", 0); mtu > 0 {
+		opt(d, "mtu", strconv.Itoa(mtu))
+	}
+	opt(d, "macaddr", GetString(m, "mac", ""))
+	if err := c.Doc.Add("network", d); err != nil {
+		return err
+	}
+	for _, v := range vlans {
+		s := &Section{Type: "bridge-vlan"}
+		opt(s, "device", name)
+		opt(s, "vlan", strconv.Itoa(v.vid))
+		for _, p := range v.ports {
+			flags := ""
+			if p.tagged {
+				flags += "t"
+			} else {
+				flags += "u"
+			}
+			if p.pvid {
+				flags += "*"
+			}
+			lst(s, "ports", p.name+":"+flags)
+		}
+		if err := c.Doc.Add("network", s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderBridgeSwconfig(name string, m map[string]any, vlans []bridgeVLAN, c *Context) error {
+	sw, _ := AsMap(m["swconfig"])
+	if sw == nil {
+		return fmt.Errorf("swconfig mode needs a swconfig block with port_map")
+	}
+	swName := GetString(sw, "device", "switch0")
+	cpuPort := GetString(sw, "cpu_port", "")
+	cpuIf := GetString(sw, "cpu_ifname", "eth0")
+	portMap, _ := AsMap(sw["port_map"])
+	if cpuPort == "" {
+		return fmt.Errorf("swconfig: cpu_port is required")
+	}
+
+	// одна секция switch на чип, даже если мостов несколько
+	if c.Doc.Package("network").Section(swName) == nil {
+		s := &Section{Type: "switch", Name: swName}
+		opt(s, "name", swName)
+		opt(s, "reset", "1")
+		opt(s, "enable_vlan", "1")
+		if err := c.Doc.Add("network", s); err != nil {
+			return err
+		}
+	}
+
+	if len(vlans) == 0 {
+		d := &Section{Type: "device"}
+		opt(d, "name", name)
+		opt(d, "type", "bridge")
+		for _, p := range StrList(m["ports"]) {
+			lst(d, "ports", p)
+		}
+		if err := c.Doc.Add("network", d); err != nil {
+			return err
+		}
+	}
+	// общий мост из всех <cpu_ifname>.<vid> слил бы VLAN в один L2-сегмент — мост на каждый VLAN
+	if len(vlans) > 0 && c.swVLANs == nil {
+		c.swVLANs = map[string]map[int]string{}
+	}
+	for _, v := range vlans {
+		dev := fmt.Sprintf("%s_%d", name, v.vid)
+		if len(dev) > 15 {
+			return fmt.Errorf("swconfig: bridge name %q for VLAN %d is longer than 15 characters", dev, v.vid)
+		}
+		d := &Section{Type: "device"}
+		opt(d, "name", dev)
+		opt(d, "type", "bridge")
+		lst(d, "ports", fmt.Sprintf("%s.%d", cpuIf, v.vid))
+		if mtu := GetInt(m, "mtu", 0); mtu > 0 {
+			opt(d, "mtu", strconv.Itoa(mtu))
+		}
+		if err := c.Doc.Add("network", d); err != nil {
+			return err
+		}
+		if c.swVLANs[name] == nil {
+			c.swVLANs[name] = map[int]string{}
+		}
+		c.swVLANs[name][v.vid] = dev
+	}
+
+	for _, v := range vlans {
+		// порты свитча — по номеру (строкой "10" < "2")
+		type swPort struct {
+			num    int
+			tagged bool
+		}
+		ports := make([]swPort, 0, len(v.ports))
+		for _, p := range v.ports {
+			raw := GetString(portMap, p.name, "")
+			if raw == "" {
+				return fmt.Errorf("swconfig: port %q missing in port_map", p.name)
+			}
+			num, err := strconv.Atoi(raw)
+			if err != nil || num < 0 {
+				return fmt.Errorf("swconfig: port_map %q: bad port number %q", p.name, raw)
+			}
+			ports = append(ports, swPort{num: num, tagged: p.tagged})
+		}
+		sort.SliceStable(ports, func(a, b int) bool { return ports[a].num < ports[b].num })
+		nums := make([]string, 0, len(ports)+1)
+		for _, p := range ports {
+			num := strconv.Itoa(p.num)
+			if p.tagged {
+				num += "t"
+			}
+			nums = append(nums, num)
+		}
+		nums = append(nums, cpuPort+"t")
+		s := &Section{Type: "switch_vlan"}
+		opt(s, "device", swName)
+		opt(s, "vlan", strconv.Itoa(v.vid))
+		opt(s, "vid", strconv.Itoa(v.vid))
+		opt(s, "ports", strings.Join(nums, " "))
+		if err := c.Doc.Add("network", s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bridgeDevice переводит ссылку интерфейса на устройство: "<мост>.<vid>" моста, разнесённого
+// по VLAN в режиме swconfig, — его мост <мост>_<vid> (устройства br-lan.<vid> там нет);
+// остальные ссылки не меняются.
+func (c *Context) bridgeDevice(dev string) (string, error) {
+	br, vid := dev, 0
+	if i := strings.LastIndexByte(dev, '.'); i > 0 {
+		if n, err := strconv.Atoi(dev[i+1:]); err == nil {
+			br, vid = dev[:i], n
+		}
+	}
+	vl, ok := c.swVLANs[br]
+	if !ok {
+		return dev, nil
+	}
+	if d, ok := vl[vid]; ok {
+		return d, nil
+	}
+	if vid == 0 {
+		return dev, fmt.Errorf("bridge %s is split per VLAN in swconfig mode: set vlan", br)
+	}
+	return dev, fmt.Errorf("bridge %s has no VLAN %d", br, vid)
+}
@@ -0,0 +1,128 @@
+package uci
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const twoVLANBridge = `{"network": {
+	"bridges": [{"name": "br-lan", "ports": ["lan1", "lan2", "lan3", "lan4"],
+		"vlans": [{"vid": 1, "ports": ["lan1", "lan2:u*"]},
+		          {"vid": 10, "ports": [{"name": "lan3", "tagged": true}, "lan4"]}],
+		"swconfig": {"device": "switch0", "cpu_port": 6, "cpu_ifname": "eth0",
+		             "port_map": {"lan1": 1, "lan2": 2, "lan3": 3, "lan4": 4}}}],
+	"interfaces": [
+		{"name": "lan", "device": "br-lan", "vlan": 1, "ipaddr": "192.168.1.1", "netmask": "255.255.255.0"},
+		{"name": "guest", "device": "br-lan", "vlan": 10, "ipaddr": "192.168.10.1", "netmask": "255.255.255.0"}]}}`
+
+func renderNetworkPkg(t *testing.T, src string, opts Options) *Package {
+	t.Helper()
+	var nj map[string]any
+	if err := json.Unmarshal([]byte(src), &nj); err != nil {
+		t.Fatal(err)
+	}
+	opts.Strict = true
+	files, err := RenderAll(nj, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if f.Name == "etc/config/network" {
+			p, err := Parse(f.Name, strings.NewReader(string(f.Data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return p
+		}
+	}
+	t.Fatal("no etc/config/network")
+	return nil
+}
+
+// swconfig: у каждого VLAN свой мост из единственного <cpu_ifname>.<vid> — VLAN не сливаются,
+// а интерфейсы с device br-lan + vlan ссылаются на мост своего VLAN.
+func TestSwconfigVLANsIsolated(t *testing.T) {
+	p := renderNetworkPkg(t, twoVLANBridge, Options{SwitchMode: SwitchSwconfig})
+
+	bridges := map[string][]string{}
+	for _, d := range p.Find("device") {
+		if d.Get("type") == "bridge" {
+			bridges[d.Get("name")] = d.Values("ports")
+		}
+	}
+	want := map[string][]string{"br-lan_1": {"eth0.1"}, "br-lan_10": {"eth0.10"}}
+	if !reflect.DeepEqual(bridges, want) {
+		t.Errorf("bridges = %v, want %v", bridges, want)
+	}
+
+	devs := map[string]string{}
+	for _, s := range p.Find("interface") {
+		devs[s.Name] = s.Get("device")
+	}
+	if want := map[string]string{"lan": "br-lan_1", "guest": "br-lan_10"}; !reflect.DeepEqual(devs, want) {
+		t.Errorf("interface devices = %v, want %v", devs, want)
+	}
+
+	vlans := map[string]string{}
+	for _, s := range p.Find("switch_vlan") {
+		vlans[s.Get("vid")] = s.Get("ports")
+	}
+	if want := map[string]string{"1": "1 2 6t", "10": "3t 4 6t"}; !reflect.DeepEqual(vlans, want) {
+		t.Errorf("switch_vlan ports = %v, want %v", vlans, want)
+	}
+}
+
+func TestSwconfigDeviceReferences(t *testing.T) {
+	for _, c := range []struct {
+		name, iface string
+		err         bool
+	}{
+		{"dotted device", `{"name": "guest", "device": "br-lan.10", "proto": "dhcp"}`, false},
+		{"bridge without vlan", `{"name": "mgmt", "device": "br-lan", "proto": "dhcp"}`, true},
+		{"unknown vlan", `{"name": "iot", "device": "br-lan", "vlan": 20, "proto": "dhcp"}`, true},
+		{"netjsonconfig", `{"name": "br-lan.10", "type": "ethernet", "network": "guest"}`, false},
+	} {
+		src := strings.Replace(twoVLANBridge, `"interfaces": [`, `"interfaces": [`+c.iface+`, `, 1)
+		src = strings.Replace(src, `{"name": "guest", "device": "br-lan", "vlan": 10, "ipaddr": "192.168.10.1", "netmask": "255.255.255.0"}`,
+			`{"name": "other", "device": "eth1", "proto": "dhcp"}`, 1)
+		var nj map[string]any
+		if err := json.Unmarshal([]byte(src), &nj); err != nil {
+			t.Fatal(err)
+		}
+		files, err := RenderAll(nj, Options{SwitchMode: SwitchSwconfig, Strict: true})
+		var ve ValidationErrors
+		if c.err {
+			if !errors.As(err, &ve) {
+				t.Errorf("%s: err = %v, want ValidationErrors", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		for _, f := range files {
+			if f.Name == "etc/config/network" && !strings.Contains(string(f.Data), "option device 'br-lan_10'") {
+				t.Errorf("%s: guest is not on br-lan_10:\n%s", c.name, f.Data)
+			}
+		}
+	}
+}
+
+// DSA: один мост с bridge-vlan, ссылки — br-lan.<vid>.
+func TestDSABridgeVLANs(t *testing.T) {
+	p := renderNetworkPkg(t, twoVLANBridge, Options{})
+	devs := map[string]string{}
+	for _, s := range p.Find("interface") {
+		devs[s.Name] = s.Get("device")
+	}
+	if want := map[string]string{"lan": "br-lan.1", "guest": "br-lan.10"}; !reflect.DeepEqual(devs, want) {
+		t.Errorf("interface devices = %v, want %v", devs, want)
+	}
+	if n := len(p.Find("bridge-vlan")); n != 2 {
+		t.Errorf("%d bridge-vlan sections, want 2", n)
+	}
+}
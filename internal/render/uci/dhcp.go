@@ -0,0 +1,219 @@
+package uci
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dhcp:
+//
+//	{"dnsmasq": {"domain": "lan", "local": "/lan/", "rebind_protection": true, "servers": ["1.1.1.1", "/corp/10.0.0.53"]},
+//	 "servers": [{"interface": "lan", "start": 100, "limit": 150, "leasetime": "12h", "dhcp_option": ["6,192.168.1.1"]}],
+//	 "hosts":   [{"name": "printer", "mac": "{{.printer_mac}}", "ip": "{{.printer_ip}}"}],
+//	 "domains": [{"name": "nas.lan", "ip": "192.168.1.20"}]}
+//
+// hosts обычно заполняются из переменных устройства (ApplyVars): либо строками-шаблонами,
+// либо целиком — "hosts": {"$var": "leases", "default": []}. Невычисленная переменная
+// даёт ошибку рендера, а не аренду с мусорным MAC.
+
+var hostLabel = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?$`)
+
+func renderDHCP(v any, c *Context) error {
+	d, _ := AsMap(v)
+	if d == nil {
+		return nil
+	}
+	c.Doc.Package("dhcp")
+
+	if dm, ok := AsMap(d["dnsmasq"]); ok {
+		if err := c.Doc.Add("dhcp", dnsmasqSection(dm)); err != nil {
+			return err
+		}
+	}
+
+	// []{ interface, start, limit, leasetime, dhcpv4, ra, dhcpv6, ndp, ra_flags[], ra_default, master, dhcp_option[] }
+	servers, _ := AsSlice(d["servers"])
+	for i, srv := range servers {
+		m, _ := AsMap(srv)
+		name := GetString(m, "interface", "")
+		if name == "" {
+			c.Invalid(Pointer("dhcp", "servers", i), "server without interface is skipped")
+			continue
+		}
+		s := &Section{Type: "dhcp", Name: name}
+		opt(s, "interface", name)
+		if v := GetInt(m, "start", 0); v > 0 {
+			opt(s, "start", strconv.Itoa(v))
+		}
+		if v := GetInt(m, "limit", 0); v > 0 {
+			opt(s, "limit", strconv.Itoa(v))
+		}
+		opt(s, "leasetime", GetString(m, "leasetime", "12h"))
+		// odhcpd: режимы RA/DHCPv6/NDP-proxy — server|relay|hybrid|disabled
+		opt(s, "dhcpv4", GetString(m, "dhcpv4", ""))
+		for _, k := range []string{"ra", "dhcpv6", "ndp"} {
+			opt(s, k, GetString(m, k, ""))
+		}
+		for _, f := range StrList(m["ra_flags"]) {
+			lst(s, "ra_flags", f)
+		}
+		if v := GetInt(m, "ra_default", 0); v > 0 {
+			opt(s, "ra_default", strconv.Itoa(v))
+		}
+		optBool(s, "master", GetBool(m, "master", false))
+		optBool(s, "force", GetBool(m, "force", false))
+		for _, k := range []string{"dhcp_option", "dhcp_option_force"} {
+			for _, o := range StrList(m[k]) {
+				if !strings.Contains(o, ",") {
+					return fmt.Errorf("dhcp %s: %s %q must be <code>,<value>", name, k, o)
+				}
+				lst(s, k, o)
+			}
+		}
+		if err := c.Doc.Add("dhcp", s); err != nil {
+			return err
+		}
+	}
+
+	hosts, err := varList(d["hosts"], "hosts")
+	if err != nil {
+		return err
+	}
+	seenMAC, seenIP := map[string]int{}, map[string]int{}
+	for i, h := range hosts {
+		m, _ := AsMap(h)
+		s, err := dhcpHost(m)
+		if err != nil {
+			return At(err, "dhcp", "hosts", i)
+		}
+		for _, mac := range s.Values("mac") {
+			if j, dup := seenMAC[mac]; dup {
+				return At(fmt.Errorf("mac %s already used by hosts[%d]", mac, j), "dhcp", "hosts", i)
+			}
+			seenMAC[mac] = i
+		}
+		if ip := s.Get("ip"); ip != "" && ip != "ignore" {
+			if j, dup := seenIP[ip]; dup {
+				return At(fmt.Errorf("ip %s already used by hosts[%d]", ip, j), "dhcp", "hosts", i)
+			}
+			seenIP[ip] = i
+		}
+		if err := c.Doc.Add("dhcp", s); err != nil {
+			return err
+		}
+	}
+
+	domains, err := varList(d["domains"], "domains")
+	if err != nil {
+		return err
+	}
+	for i, x := range domains {
+		m, _ := AsMap(x)
+		name, ip := GetString(m, "name", ""), GetString(m, "ip", "")
+		if name == "" || net.ParseIP(ip) == nil {
+			return At(fmt.Errorf("name and a valid ip are required"), "dhcp", "domains", i)
+		}
+		s := &Section{Type: "domain"}
+		opt(s, "name", name)
+		opt(s, "ip", ip)
+		if err := c.Doc.Add("dhcp", s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dnsmasqSection — глобальная config dnsmasq. Булевы флаги пишутся только если заданы явно,
+// чтобы не перебивать умолчания OpenWrt.
+func dnsmasqSection(m map[string]any) *Section {
+	s := &Section{Type: "dnsmasq"}
+	domain := GetString(m, "domain", "")
+	opt(s, "domain", domain)
+	local := GetString(m, "local", "")
+	if local == "" && domain != "" {
+		local = "/" + domain + "/"
+	}
+	opt(s, "local", local)
+	for _, k := range []string{"domainneeded", "boguspriv", "localise_queries", "rebind_protection", "rebind_localhost",
+		"expandhosts", "authoritative", "readethers", "noresolv", "localservice", "nonwildcard", "logqueries"} {
+		if _, ok := m[k]; ok {
+			opt(s, k, boolStr(GetBool(m, k, false)))
+		}
+	}
+	for _, k := range []string{"leasefile", "resolvfile", "cachesize", "port"} {
+		opt(s, k, GetString(m, k, ""))
+	}
+	for _, srv := range StrList(m["servers"]) {
+		lst(s, "server", srv)
+	}
+	for _, d := range StrList(m["rebind_domain"]) {
+		lst(s, "rebind_domain", d)
+	}
+	for _, a := range StrList(m["addnhosts"]) {
+		lst(s, "addnhosts", a)
+	}
+	return s
+}
+
+// dhcpHost — статическая аренда: mac (один или список), ip (IPv4 или "ignore"), name.
+func dhcpHost(m map[string]any) (*Section, error) {
+	if m == nil {
+		return nil, fmt.Errorf("expected object")
+	}
+	s := &Section{Type: "host"}
+	name := GetString(m, "name", "")
+	if name != "" {
+		if !hostLabel.MatchString(name) {
+			return nil, fmt.Errorf("bad host name %q", name)
+		}
+		opt(s, "name", name)
+	}
+	macs := StrList(m["mac"])
+	if len(macs) == 0 {
+		return nil, fmt.Errorf("mac is required")
+	}
+	for _, mac := range macs {
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			return nil, fmt.Errorf("bad mac %q", mac)
+		}
+		if len(macs) == 1 {
+			opt(s, "mac", hw.String())
+		} else {
+			lst(s, "mac", hw.String())
+		}
+	}
+	if ip := GetString(m, "ip", ""); ip != "" {
+		if ip != "ignore" && (net.ParseIP(ip) == nil || net.ParseIP(ip).To4() == nil) {
+			return nil, fmt.Errorf("bad ip %q", ip)
+		}
+		opt(s, "ip", ip)
+	}
+	opt(s, "leasetime", GetString(m, "leasetime", ""))
+	opt(s, "tag", GetString(m, "tag", ""))
+	optBool(s, "dns", GetBool(m, "dns", false))
+	return s, nil
+}
+
+// varList — массив, который мог прийти из переменной; оставшийся {"$var": ...} значит,
+// что переменной у устройства нет и default не задан.
+func varList(v any, key string) ([]any, error) {
+	if m, ok := AsMap(v); ok {
+		if path, ok := m["$var"].(string); ok {
+			return nil, fmt.Errorf("%s: unresolved variable %q", key, path)
+		}
+		return nil, fmt.Errorf("%s: expected array", key)
+	}
+	items, _ := AsSlice(v)
+	for i, it := range items {
+		if m, ok := AsMap(it); ok {
+			if path, ok := m["$var"].(string); ok {
+				return nil, fmt.Errorf("%s[%d]: unresolved variable %q", key, i, path)
+			}
+		}
+	}
+	return items, nil
+}
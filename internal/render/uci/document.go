@@ -0,0 +1,125 @@
+package uci
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Document — UCI-конфигурация в памяти: пакеты → упорядоченные секции → options/lists.
+// Рендереры добавляют в него секции, а Files сериализует ровно один файл на пакет,
+// поэтому network от renderNetwork и renderWireGuard попадает в один etc/config/network.
+type Document struct {
+	pkgs  []*Package
+	index map[string]*Package
+	files []File // не-UCI файлы (блок files)
+}
+
+func NewDocument() *Document { return &Document{index: map[string]*Package{}} }
+
+// Package возвращает пакет по имени, создавая пустой при первом обращении.
+func (d *Document) Package(name string) *Package {
+	if p, ok := d.index[name]; ok {
+		return p
+	}
+	p := &Package{Name: name}
+	d.index[name] = p
+	d.pkgs = append(d.pkgs, p)
+	return p
+}
+
+// Lookup — пакет по имени или nil; в отличие от Package не создаёт пустой пакет (и файл).
+func (d *Document) Lookup(name string) *Package { return d.index[name] }
+
+// Packages — пакеты в порядке появления.
+func (d *Document) Packages() []*Package { return d.pkgs }
+
+// Add добавляет секцию в пакет. Именованная секция должна быть уникальной в пакете
+// (как и в самом uci, независимо от типа) — повтор считается ошибкой, а не перезаписью.
+func (d *Document) Add(pkg string, s *Section) error {
+	p := d.Package(pkg)
+	if s.Name != "" {
+		if prev := p.Section(s.Name); prev != nil {
+			return fmt.Errorf("uci: %s: duplicate section %q (%s and %s)", pkg, s.Name, prev.Type, s.Type)
+		}
+	}
+	p.Sections = append(p.Sections, s)
+	return nil
+}
+
+// AddFile добавляет в документ произвольный файл (не UCI-пакет).
+func (d *Document) AddFile(f File) { d.files = append(d.files, f) }
+
+// Files сериализует документ: один File на пакет (etc/config/<package>) плюс файлы из AddFile.
+// Файл, путь которого совпадает с пакетом или другим файлом, — ошибка.
+func (d *Document) Files() ([]File, error) {
+	files := make([]File, 0, len(d.pkgs)+len(d.files))
+	seen := map[string]bool{}
+	for _, p := range d.pkgs {
+		name := "etc/config/" + p.Name
+		seen[name] = true
+		files = append(files, File{Name: name, Data: p.Bytes(), Mode: 0644})
+	}
+	for _, f := range d.files {
+		if seen[f.Name] {
+			return nil, fmt.Errorf("uci: file %q collides with generated config", f.Name)
+		}
+		seen[f.Name] = true
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// Section ищет именованную секцию пакета.
+func (p *Package) Section(name string) *Section {
+	for _, s := range p.Sections {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Bytes — текст пакета в формате /etc/config.
+func (p *Package) Bytes() []byte {
+	var b strings.Builder
+	for _, s := range p.Sections {
+		if s.Name != "" {
+			fmt.Fprintf(&b, "config %s '%s'\n", s.Type, q(s.Name))
+		} else {
+			fmt.Fprintf(&b, "config %s\n", s.Type)
+		}
+		for _, o := range s.Options {
+			kw := "option"
+			if o.List {
+				kw = "list"
+			}
+			for _, v := range o.Values {
+				fmt.Fprintf(&b, "\t%s %s '%s'\n", kw, o.Name, q(v))
+			}
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// Set задаёт option (повторный Set перезаписывает значение, list превращается в option).
+func (s *Section) Set(name, val string) {
+	if o := s.Option(name); o != nil {
+		o.Values, o.List = []string{val}, false
+		return
+	}
+	s.Options = append(s.Options, &Option{Name: name, Values: []string{val}})
+}
+
+// Append добавляет значение в list (option с тем же именем превращается в list).
+func (s *Section) Append(name, val string) {
+	o := s.Option(name)
+	if o == nil {
+		s.Options = append(s.Options, &Option{Name: name, Values: []string{val}, List: true})
+		return
+	}
+	if !o.List {
+		o.Values, o.List = nil, true
+	}
+	o.Values = append(o.Values, val)
+}
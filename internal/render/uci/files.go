@@ -0,0 +1,112 @@
+package uci
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// FilesKey — произвольные файлы в архиве конфигурации:
+//
+//	"files": [
+//	  {"path": "/etc/dropbear/authorized_keys", "mode": "0600", "contents": "ssh-ed25519 ..."},
+//	  {"path": "/etc/banner", "contents": "V2VsY29tZQo=", "encoding": "base64"}
+//	]
+//
+// contents проходит через ApplyVars как любая строка NetJSON; mode — восьмеричная строка
+// (по умолчанию 0644).
+const FilesKey = "files"
+
+// ParseFiles разбирает и проверяет блок files: пути без "..", без дублей, валидный mode.
+func ParseFiles(v any) ([]File, error) {
+	if v == nil {
+		return nil, nil
+	}
+	items, ok := AsSlice(v)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected array", FilesKey)
+	}
+	seen := map[string]bool{}
+	out := make([]File, 0, len(items))
+	for i, it := range items {
+		m, _ := AsMap(it)
+		name, err := cleanFilePath(GetString(m, "path", ""))
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d]: %w", FilesKey, i, err)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s[%d]: duplicate path %q", FilesKey, i, name)
+		}
+		seen[name] = true
+
+		mode, err := fileMode(m["mode"])
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d]: %w", FilesKey, i, err)
+		}
+
+		contents, _ := m["contents"].(string)
+		var data []byte
+		switch enc := GetString(m, "encoding", "plain"); enc {
+		case "plain":
+			data = []byte(contents)
+		case "base64":
+			data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(contents))
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: bad base64 contents: %w", FilesKey, i, err)
+			}
+		default:
+			return nil, fmt.Errorf("%s[%d]: unknown encoding %q", FilesKey, i, enc)
+		}
+		out = append(out, File{Name: name, Data: data, Mode: mode})
+	}
+	return out, nil
+}
+
+// cleanFilePath приводит путь к виду внутри tar ("etc/banner") и отсекает выход за корень.
+func cleanFilePath(p string) (string, error) {
+	if strings.TrimSpace(p) == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("path %q escapes archive root", p)
+		}
+	}
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" || strings.HasSuffix(p, "/") {
+		return "", fmt.Errorf("path %q is not a file", p)
+	}
+	return name, nil
+}
+
+func fileMode(v any) (int, error) {
+	var s string
+	switch t := v.(type) {
+	case nil:
+		return 0644, nil
+	case string:
+		s = t
+	case float64:
+		s = strconv.FormatFloat(t, 'f', -1, 64) // 644 → 0644
+	default:
+		return 0, fmt.Errorf("bad mode %v", v)
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 07777 {
+		return 0, fmt.Errorf("bad mode %q", s)
+	}
+	return int(mode), nil
+}
+
+func renderFiles(v any, c *Context) error {
+	files, err := ParseFiles(v)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		c.Doc.AddFile(f)
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package uci
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// firewall:
+//
+//	{"zones": [{"name": "lan", "networks": ["lan"]},
+//	           {"name": "wan", "networks": ["wan", "wan6"], "input": "REJECT", "masq": true, "mtu_fix": true}],
+//	 "forwardings": [{"src": "lan", "dest": "wan"}],
+//	 "rules": [{"name": "Allow-Ping", "src": "wan", "proto": "icmp", "icmp_type": ["echo-request"], "limit": "10/sec"}],
+//	 "redirects": [{"name": "web", "src": "wan", "src_dport": 8080, "dest": "lan", "dest_ip": "192.168.1.10", "dest_port": 80}],
+//	 "ipsets": [{"name": "blocked", "match": ["src_net"], "entries": ["203.0.113.0/24"]}],
+//	 "includes": [{"path": "/etc/firewall.user", "type": "script"}]}
+//
+// Ссылки forwardings/redirects/rules на зоны проверяются, если зоны описаны в том же NetJSON.
+
+var fwTargets = map[string]bool{"ACCEPT": true, "REJECT": true, "DROP": true}
+
+func renderFirewall(v any, c *Context) error {
+	fw, _ := AsMap(v)
+	if fw == nil {
+		return nil
+	}
+	c.Doc.Package("firewall")
+
+	known := map[string]bool{}
+	zones, _ := AsSlice(fw["zones"])
+	for i, z := range zones {
+		m, _ := AsMap(z)
+		s, err := fwZone(m)
+		if err != nil {
+			return At(err, "firewall", "zones", i)
+		}
+		if s == nil {
+			c.Invalid(Pointer("firewall", "zones", i), "zone without name is skipped")
+			continue
+		}
+		name := s.Get("name")
+		if known[name] {
+			return At(fmt.Errorf("duplicate zone %q", name), "firewall", "zones", i)
+		}
+		known[name] = true
+		if err := c.Doc.Add("firewall", s); err != nil {
+			return err
+		}
+	}
+	zoneRef := func(z string) error {
+		if z == "" || z == "*" || len(known) == 0 || known[z] {
+			return nil
+		}
+		return fmt.Errorf("unknown zone %q", z)
+	}
+
+	fwds, _ := AsSlice(fw["forwardings"])
+	for i, f := range fwds {
+		m, _ := AsMap(f)
+		src, dest := GetString(m, "src", ""), GetString(m, "dest", "")
+		if src == "" || dest == "" {
+			return At(fmt.Errorf("src and dest are required"), "firewall", "forwardings", i)
+		}
+		for _, z := range []string{src, dest} {
+			if err := zoneRef(z); err != nil {
+				return At(err, "firewall", "forwardings", i)
+			}
+		}
+		s := &Section{Type: "forwarding"}
+		opt(s, "src", src)
+		opt(s, "dest", dest)
+		opt(s, "family", GetString(m, "family", ""))
+		if err := c.Doc.Add("firewall", s); err != nil {
+			return err
+		}
+	}
+
+	rules, _ := AsSlice(fw["rules"])
+	for i, r := range rules {
+		m, _ := AsMap(r)
+		s, err := fwRule(m, i)
+		if err == nil {
+			err = zoneRef(s.Get("src"))
+		}
+		if err == nil {
+			err = zoneRef(s.Get("dest"))
+		}
+		if err != nil {
+			return At(err, "firewall", "rules", i)
+		}
+		if err := c.Doc.Add("firewall", s); err != nil {
+			return err
+		}
+	}
+
+	redirects, _ := AsSlice(fw["redirects"])
+	for i, r := range redirects {
+		m, _ := AsMap(r)
+		s, err := fwRedirect(m, i)
+		if err == nil {
+			err = zoneRef(s.Get("src"))
+		}
+		if err == nil {
+			err = zoneRef(s.Get("dest"))
+		}
+		if err != nil {
+			return At(err, "firewall", "redirects", i)
+		}
+		if err := c.Doc.Add("firewall", s); err != nil {
+			return err
+		}
+	}
+
+	ipsets, _ := AsSlice(fw["ipsets"])
+	for i, x := range ipsets {
+		m, _ := AsMap(x)
+		name := GetString(m, "name", "")
+		match := StrList(m["match"])
+		if name == "" || len(match) == 0 {
+			return At(fmt.Errorf("name and match are required"), "firewall", "ipsets", i)
+		}
+		s := &Section{Type: "ipset"}
+		opt(s, "name", name)
+		opt(s, "family", GetString(m, "family", ""))
+		for _, mt := range match {
+			lst(s, "match", mt)
+		}
+		for _, e := range StrList(m["entries"]) {
+			lst(s, "entry", e)
+		}
+		opt(s, "loadfile", GetString(m, "loadfile", ""))
+		opt(s, "timeout", GetString(m, "timeout", ""))
+		if err := c.Doc.Add("firewall", s); err != nil {
+			return err
+		}
+	}
+
+	includes, _ := AsSlice(fw["includes"])
+	for i, x := range includes {
+		m, _ := AsMap(x)
+		path := GetString(m, "path", "")
+		if path == "" {
+			return At(fmt.Errorf("path is required"), "firewall", "includes", i)
+		}
+		typ := GetString(m, "type", "script")
+		if typ != "script" && typ != "nftables" && typ != "restore" {
+			return At(fmt.Errorf("unknown type %q", typ), "firewall", "includes", i)
+		}
+		s := &Section{Type: "include"}
+		opt(s, "path", path)
+		opt(s, "type", typ)
+		opt(s, "family", GetString(m, "family", ""))
+		opt(s, "position", GetString(m, "position", ""))
+		opt(s, "chain", GetString(m, "chain", ""))
+		if _, ok := m["reload"]; ok {
+			opt(s, "reload", boolStr(GetBool(m, "reload", false)))
+		}
+		if err := c.Doc.Add("firewall", s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fwZone: policy + networks/devices/subnets и NAT (masq, masq_src/masq_dest, mtu_fix).
+func fwZone(m map[string]any) (*Section, error) {
+	name := GetString(m, "name", "")
+	if name == "" {
+		return nil, nil
+	}
+	if len(name) > 11 {
+		return nil, fmt.Errorf("zone name %q longer than 11 characters", name)
+	}
+	s := &Section{Type: "zone"}
+	opt(s, "name", name)
+	for _, k := range []struct{ key, def string }{{"input", "ACCEPT"}, {"output", "ACCEPT"}, {"forward", "REJECT"}} {
+		p := strings.ToUpper(GetString(m, k.key, k.def))
+		if !fwTargets[p] {
+			return nil, fmt.Errorf("zone %s: bad %s policy %q", name, k.key, p)
+		}
+		opt(s, k.key, p)
+	}
+	opt(s, "family", GetString(m, "family", ""))
+	for _, n := range StrList(m["networks"]) {
+		lst(s, "network", n)
+	}
+	for _, d := range StrList(m["devices"]) {
+		lst(s, "device", d)
+	}
+	for _, n := range StrList(m["subnets"]) {
+		lst(s, "subnet", n)
+	}
+	optBool(s, "masq", GetBool(m, "masq", false))
+	optBool(s, "masq6", GetBool(m, "masq6", false))
+	for _, a := range StrList(m["masq_src"]) {
+		lst(s, "masq_src", a)
+	}
+	for _, a := range StrList(m["masq_dest"]) {
+		lst(s, "masq_dest", a)
+	}
+	optBool(s, "mtu_fix", GetBool(m, "mtu_fix", false))
+	optBool(s, "log", GetBool(m, "log", false))
+	return s, nil
+}
+
+func fwRule(m map[string]any, i int) (*Section, error) {
+	family, err := ruleFamily(m)
+	if err != nil {
+		return nil, err
+	}
+	proto := GetString(m, "proto", "tcpudp")
+	target := strings.ToUpper(GetString(m, "target", "ACCEPT"))
+	if !fwTargets[target] && target != "MARK" && target != "NOTRACK" {
+		return nil, fmt.Errorf("bad target %q", target)
+	}
+	icmp := StrList(m["icmp_type"])
+	if len(icmp) > 0 && proto != "icmp" && proto != "icmpv6" && proto != "all" {
+		return nil, fmt.Errorf("icmp_type needs proto icmp, got %s", proto)
+	}
+	s := &Section{Type: "rule"}
+	opt(s, "name", GetString(m, "name", fmt.Sprintf("rule_%d", i+1)))
+	opt(s, "src", GetString(m, "src", ""))
+	opt(s, "dest", GetString(m, "dest", ""))
+	opt(s, "proto", proto)
+	for _, a := range StrList(m["src_ip"]) {
+		lst(s, "src_ip", a)
+	}
+	opt(s, "src_mac", GetString(m, "src_mac", ""))
+	opt(s, "src_port", GetString(m, "src_port", ""))
+	for _, a := range StrList(m["dest_ip"]) {
+		lst(s, "dest_ip", a)
+	}
+	opt(s, "dest_port", GetString(m, "dest_port", ""))
+	for _, t := range icmp {
+		lst(s, "icmp_type", t)
+	}
+	opt(s, "ipset", GetString(m, "ipset", ""))
+	if lim := GetString(m, "limit", ""); lim != "" {
+		if err := checkLimit(lim); err != nil {
+			return nil, err
+		}
+		opt(s, "limit", lim)
+		opt(s, "limit_burst", GetString(m, "limit_burst", ""))
+	}
+	opt(s, "target", target)
+	opt(s, "set_mark", GetString(m, "set_mark", ""))
+	opt(s, "family", family)
+	if !GetBool(m, "enabled", true) {
+		opt(s, "enabled", "0")
+	}
+	return s, nil
+}
+
+// fwRedirect: DNAT (проброс порта из src в dest_ip:dest_port) или SNAT (подмена источника на src_dip).
+func fwRedirect(m map[string]any, i int) (*Section, error) {
+	target := strings.ToUpper(GetString(m, "target", "DNAT"))
+	family, err := ruleFamily(m)
+	if err != nil {
+		return nil, err
+	}
+	s := &Section{Type: "redirect"}
+	opt(s, "name", GetString(m, "name", fmt.Sprintf("redirect_%d", i+1)))
+	opt(s, "target", target)
+	proto := GetString(m, "proto", "tcp udp")
+	switch target {
+	case "DNAT":
+		src := GetString(m, "src", "wan")
+		if GetString(m, "dest_ip", "") == "" && GetString(m, "dest_port", "") == "" {
+			return nil, fmt.Errorf("DNAT needs dest_ip or dest_port")
+		}
+		if GetString(m, "src_dport", "") == "" && proto != "all" && proto != "icmp" {
+			return nil, fmt.Errorf("DNAT needs src_dport for proto %s", proto)
+		}
+		opt(s, "src", src)
+		opt(s, "dest", GetString(m, "dest", "lan"))
+	case "SNAT":
+		if GetString(m, "src_dip", "") == "" {
+			return nil, fmt.Errorf("SNAT needs src_dip")
+		}
+		if GetString(m, "dest", "") == "" {
+			return nil, fmt.Errorf("SNAT needs dest zone")
+		}
+		opt(s, "src", GetString(m, "src", ""))
+		opt(s, "dest", GetString(m, "dest", ""))
+	default:
+		return nil, fmt.Errorf("unknown target %q", target)
+	}
+	opt(s, "proto", proto)
+	for _, k := range []string{"src_ip", "src_dip", "src_port", "src_dport", "dest_ip", "dest_port", "ipset"} {
+		opt(s, k, GetString(m, k, ""))
+	}
+	if _, ok := m["reflection"]; ok {
+		opt(s, "reflection", boolStr(GetBool(m, "reflection", true)))
+	}
+	opt(s, "family", family)
+	if !GetBool(m, "enabled", true) {
+		opt(s, "enabled", "0")
+	}
+	return s, nil
+}
+
+// checkLimit — формат limit у fw3/fw4: "<n>/<sec|minute|hour|day>" (допускаются сокращения).
+func checkLimit(l string) error {
+	n, unit, ok := strings.Cut(l, "/")
+	if _, err := strconv.Atoi(n); !ok || err != nil {
+		return fmt.Errorf("bad limit %q", l)
+	}
+	for _, u := range []string{"second", "minute", "hour", "day"} {
+		if unit != "" && strings.HasPrefix(u, unit) {
+			return nil
+		}
+	}
+	return fmt.Errorf("bad limit unit in %q", l)
+}
+
+// ruleFamily — family правила: явный ("ipv4"|"ipv6"|"any") или выведенный из src_ip/dest_ip.
+// Адреса разных семейств в одном правиле, как и адреса не того семейства, — ошибка.
+func ruleFamily(m map[string]any) (string, error) {
+	family := GetString(m, "family", "")
+	switch family {
+	case "", "any", "ipv4", "ipv6":
+	default:
+		return "", fmt.Errorf("unknown family %q", family)
+	}
+	detected := ""
+	for _, a := range append(StrList(m["src_ip"]), StrList(m["dest_ip"])...) {
+		f := AddrFamily(a)
+		if f == "" {
+			continue // имена ipset/хостов — без семейства
+		}
+		if detected != "" && detected != f {
+			return "", fmt.Errorf("mixed ipv4/ipv6 addresses")
+		}
+		detected = f
+	}
+	if detected != "" && family != "" && family != "any" && family != detected {
+		return "", fmt.Errorf("family %s does not match %s addresses", family, detected)
+	}
+	if family == "" {
+		family = detected
+	}
+	return family, nil
+}
+
+// AddrFamily — "ipv4"/"ipv6" для адреса или префикса, "" если это не IP.
+func AddrFamily(a string) string {
+	a = strings.TrimPrefix(a, "!")
+	if ip, _, err := net.ParseCIDR(a); err == nil {
+		a = ip.String()
+	}
+	ip := net.ParseIP(a)
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return "ipv4"
+	default:
+		return "ipv6"
+	}
+}
@@ -0,0 +1,87 @@
+package uci
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.uci from the current RenderAll output")
+
+// TestRenderGolden: testdata/<name>.json → RenderAll → сравнение
+// с testdata/<name>.uci. После намеренного изменения вывода: go test ./internal/render/uci -update.
+func TestRenderGolden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no testdata/*.json")
+	}
+	for _, in := range inputs {
+		name := strings.TrimSuffix(filepath.Base(in), ".json")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var nj map[string]any
+			if err := json.Unmarshal(raw, &nj); err != nil {
+				t.Fatal(err)
+			}
+			files, err := RenderAll(nj, Options{DeviceHostname: "golden", Strict: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := dumpFiles(files)
+			golden := strings.TrimSuffix(in, ".json") + ".uci"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("output differs from %s:\n%s", golden, lineDiff(string(want), got))
+			}
+		})
+	}
+}
+
+// dumpFiles — файлы в том же виде, что печатает wisp-render.
+func dumpFiles(files []File) string {
+	var b strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&b, "==> %s (%04o) <==\n%s\n", f.Name, f.Mode, f.Data)
+	}
+	return b.String()
+}
+
+// lineDiff — первые расхождения построчно (want/got), без внешних зависимостей.
+func lineDiff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var b strings.Builder
+	n := 0
+	for i := 0; i < max(len(w), len(g)) && n < 10; i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			fmt.Fprintf(&b, "line %d:\n  want: %q\n  got:  %q\n", i+1, wl, gl)
+			n++
+		}
+	}
+	return b.String()
+}
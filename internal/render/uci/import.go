@@ -0,0 +1,758 @@
+package uci
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Import — обратное преобразование к RenderAll: разобранные UCI-пакеты → NetJSON
+// в той же форме, которую потребляют рендереры (system, network, wireless, dhcp,
+// firewall, wireguard, openvpn, zerotier, mwan3). Всё, что в эти схемы не укладывается
+// (незнакомые пакеты и секции вроде firewall defaults или switch, лишние опции system,
+// interface и dnsmasq), переносится как есть в блок PassthroughKey — RenderAll вернёт их на место.
+func Import(pkgs []*Package) (map[string]any, error) {
+	byName := map[string]*Package{}
+	for _, p := range pkgs {
+		if _, dup := byName[p.Name]; dup {
+			return nil, fmt.Errorf("uci import: duplicate package %q", p.Name)
+		}
+		byName[p.Name] = p
+	}
+
+	nj := map[string]any{}
+	im := imported{}
+	if p := byName["system"]; p != nil {
+		importSystem(p, nj, im)
+	}
+	if p := byName["network"]; p != nil {
+		importNetwork(p, nj, im)
+	}
+	if p := byName["wireless"]; p != nil {
+		importWireless(p, nj, im)
+	}
+	if p := byName["dhcp"]; p != nil {
+		importDHCP(p, nj, im)
+	}
+	if p := byName["firewall"]; p != nil {
+		importFirewall(p, nj, im)
+	}
+	if p := byName["openvpn"]; p != nil {
+		importOpenVPN(p, nj, im)
+	}
+	if p := byName["zerotier"]; p != nil {
+		importZeroTier(p, nj, im)
+	}
+	if p := byName["mwan3"]; p != nil {
+		importMWAN3(p, nj, im)
+	}
+	setItems(nj, PassthroughKey, im.passthrough(pkgs))
+	return nj, nil
+}
+
+// imported — исходные секции, перенесённые в NetJSON: nil — целиком, иначе только эти опции.
+type imported map[*Section]map[string]bool
+
+func (im imported) all(s *Section) { im[s] = nil }
+
+func (im imported) only(s *Section, opts ...string) {
+	if im[s] == nil {
+		im[s] = map[string]bool{}
+	}
+	for _, o := range opts {
+		im[s][o] = true
+	}
+}
+
+// passthrough — непереносённые секции и опции в формате блока PassthroughKey. Остаток
+// перенесённой секции ссылается на неё по имени, анонимной — как "@type[n]".
+func (im imported) passthrough(pkgs []*Package) []any {
+	var out []any
+	for _, p := range pkgs {
+		var secs []any
+		idx := map[string]int{}
+		for _, s := range p.Sections {
+			n := idx[s.Type]
+			idx[s.Type]++
+			used, partial := im[s]
+			if partial && used == nil {
+				continue
+			}
+			opts, lists := map[string]any{}, map[string]any{}
+			for _, o := range s.Options {
+				switch {
+				case used[o.Name]:
+				case o.List:
+					setList(lists, o.Name, o.Values)
+				default:
+					opts[o.Name] = s.Get(o.Name)
+				}
+			}
+			if partial && len(opts)+len(lists) == 0 {
+				continue
+			}
+			m := map[string]any{"type": s.Type}
+			setStr(m, "name", s.Name)
+			if partial && s.Name == "" {
+				m["name"] = fmt.Sprintf("@%s[%d]", s.Type, n)
+			}
+			if len(opts) > 0 {
+				m["options"] = opts
+			}
+			if len(lists) > 0 {
+				m["lists"] = lists
+			}
+			secs = append(secs, m)
+		}
+		if len(secs) > 0 {
+			out = append(out, map[string]any{"name": p.Name, "sections": secs})
+		}
+	}
+	return out
+}
+
+// ===== system =====
+func importSystem(p *Package, nj map[string]any, im imported) {
+	sys := map[string]any{}
+	for _, s := range p.Find("system") {
+		for _, k := range []string{"hostname", "zonename", "timezone", "log_ip", "log_proto", "conloglevel", "cronloglevel"} {
+			setStr(sys, k, s.Get(k))
+			im.only(s, k)
+		}
+		im.only(s, "log_port", "log_size")
+		setInt(sys, "log_port", s.Get("log_port"))
+		setInt(sys, "log_size", s.Get("log_size"))
+		if zone, ok := sys["zonename"].(string); ok && zoneinfo[zone] == sys["timezone"] {
+			delete(sys, "timezone") // выводится из zonename
+		}
+		break
+	}
+	for _, s := range p.Find("timeserver") {
+		ntp := map[string]any{"enabled": s.Get("enabled") != "0", "enable_server": s.Get("enable_server") == "1"}
+		setList(ntp, "servers", s.Values("server"))
+		sys["ntp"] = ntp
+		im.all(s)
+		break
+	}
+	var leds []any
+	for _, s := range p.Find("led") {
+		m := map[string]any{}
+		for _, k := range []string{"name", "sysfs", "trigger", "dev", "mode", "delayon", "delayoff", "interval"} {
+			setStr(m, k, s.Get(k))
+		}
+		if v := s.Get("default"); v != "" {
+			m["default"] = v == "1"
+		}
+		leds = append(leds, m)
+		im.all(s)
+	}
+	setItems(sys, "leds", leds)
+	if len(sys) > 0 {
+		nj["system"] = sys
+	}
+}
+
+// ===== network (+ wireguard) =====
+func importNetwork(p *Package, nj map[string]any, im imported) {
+	var ifaces []any
+	bridges := importBridges(p, im)
+	for _, s := range p.Find("interface") {
+		if s.Name == "" {
+			continue
+		}
+		if s.Get("proto") == "wireguard" {
+			// NetJSON описывает один WG-интерфейс — берём первый, остальные уходят в passthrough
+			if _, ok := nj["wireguard"]; !ok {
+				nj["wireguard"] = importWireGuard(p, s, im)
+			}
+			continue
+		}
+		m := map[string]any{"name": s.Name}
+		setStr(m, "proto", s.Get("proto"))
+		// list ipaddr (CIDR) или несколько адресов — списком, один адрес с netmask — строкой
+		if addrs := s.Values("ipaddr"); len(addrs) == 1 && !strings.Contains(addrs[0], "/") {
+			m["ipaddr"] = addrs[0]
+		} else {
+			setList(m, "ipaddr", addrs)
+		}
+		setStr(m, "netmask", s.Get("netmask"))
+		setStr(m, "gateway", s.Get("gateway"))
+		setList(m, "ip6addr", s.Values("ip6addr"))
+		setStr(m, "ip6gw", s.Get("ip6gw"))
+		setList(m, "ip6prefix", s.Values("ip6prefix"))
+		setInt(m, "ip6assign", s.Get("ip6assign"))
+		setStr(m, "ip6hint", s.Get("ip6hint"))
+		setStr(m, "ip6ifaceid", s.Get("ip6ifaceid"))
+		for _, k := range protoOptions[s.Get("proto")] {
+			setStr(m, k, s.Get(k))
+			im.only(s, k)
+		}
+		setList(m, "dns", s.Values("dns"))
+		setStr(m, "device", s.Get("device"))
+		im.only(s, "proto", "ipaddr", "netmask", "gateway", "ip6addr", "ip6gw", "ip6prefix", "ip6assign",
+			"ip6hint", "ip6ifaceid", "dns", "device", "disabled")
+		if ifname := s.Get("ifname"); ifname != "" && s.Get("device") == "" {
+			// до 21.02: устройство в ifname, мост — type bridge + список портов в ifname
+			ports := strings.Fields(ifname)
+			switch vid, ok := vlanFromIfname(s.Name, ifname); {
+			case ok:
+				m["vlan"] = vid
+				im.only(s, "ifname")
+			case s.Get("type") == "bridge":
+				br := "br-" + s.Name
+				if !hasBridge(bridges, br) {
+					bridges = append(bridges, map[string]any{"name": br, "ports": toAny(ports)})
+				}
+				m["device"] = br
+				im.only(s, "ifname", "type")
+			case len(ports) == 1:
+				m["device"] = ports[0]
+				im.only(s, "ifname")
+			}
+		}
+		setFlag(m, "disabled", s.Get("disabled"))
+		ifaces = append(ifaces, m)
+	}
+	netw := map[string]any{}
+	if len(ifaces) > 0 {
+		netw["interfaces"] = ifaces
+	}
+	setItems(netw, "bridges", bridges)
+	if len(netw) > 0 {
+		nj["network"] = netw
+	}
+	importRoutes(p, nj, im)
+}
+
+// importRoutes — route/route6 → routes, rule/rule6 → ip_rules (схема netjsonconfig, верхний уровень).
+func importRoutes(p *Package, nj map[string]any, im imported) {
+	var routes []any
+	for _, s := range p.Sections {
+		if s.Type != "route" && s.Type != "route6" {
+			continue
+		}
+		dest := s.Get("target")
+		if mask := s.Get("netmask"); mask != "" {
+			if ones, _ := net.IPMask(net.ParseIP(mask).To4()).Size(); ones > 0 || mask == "0.0.0.0" {
+				dest += "/" + strconv.Itoa(ones)
+			}
+		}
+		m := map[string]any{"device": s.Get("interface"), "destination": dest}
+		setStr(m, "next", s.Get("gateway"))
+		setStr(m, "source", s.Get("source"))
+		setInt(m, "cost", s.Get("metric"))
+		setStr(m, "table", s.Get("table"))
+		setStr(m, "type", s.Get("type"))
+		setInt(m, "mtu", s.Get("mtu"))
+		setFlag(m, "onlink", s.Get("onlink"))
+		routes = append(routes, m)
+		im.all(s)
+	}
+	setItems(nj, "routes", routes)
+
+	var rules []any
+	for _, s := range p.Sections {
+		if s.Type != "rule" && s.Type != "rule6" {
+			continue
+		}
+		m := map[string]any{}
+		if s.Type == "rule6" {
+			m["family"] = "ipv6"
+		}
+		for _, k := range []string{"in", "out", "src", "dest", "tos", "mark", "priority", "lookup", "action", "goto"} {
+			setStr(m, k, s.Get(k))
+		}
+		setFlag(m, "invert", s.Get("invert"))
+		rules = append(rules, m)
+		im.all(s)
+	}
+	setItems(nj, "ip_rules", rules)
+}
+
+// importBridges — config device (type bridge) + bridge-vlan (DSA) → network.bridges.
+func importBridges(p *Package, im imported) []any {
+	var out []any
+	for _, d := range p.Find("device") {
+		name := d.Get("name")
+		if d.Get("type") != "bridge" || name == "" {
+			continue
+		}
+		m := map[string]any{"name": name}
+		setList(m, "ports", d.Values("ports"))
+		setInt(m, "mtu", d.Get("mtu"))
+		setStr(m, "mac", d.Get("macaddr"))
+		var vlans []any
+		for _, bv := range p.Find("bridge-vlan") {
+			if bv.Get("device") != name {
+				continue
+			}
+			vid, err := strconv.Atoi(bv.Get("vlan"))
+			if err != nil {
+				continue
+			}
+			ports := make([]any, 0)
+			for _, pt := range bv.Values("ports") {
+				pn, flags, _ := strings.Cut(pt, ":")
+				pm := map[string]any{"name": pn}
+				if strings.Contains(flags, "t") {
+					pm["tagged"] = true
+				}
+				if strings.Contains(flags, "*") {
+					pm["pvid"] = true
+				}
+				ports = append(ports, pm)
+			}
+			vlans = append(vlans, map[string]any{"vid": vid, "ports": ports})
+			im.all(bv)
+		}
+		if len(vlans) > 0 {
+			m["vlans"] = vlans
+		}
+		out = append(out, m)
+		im.all(d)
+	}
+	return out
+}
+
+func hasBridge(bridges []any, name string) bool {
+	for _, b := range bridges {
+		if m, _ := AsMap(b); GetString(m, "name", "") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// vlanFromIfname распознаёт "ifname '<name>.<vid>'", который пишет renderNetwork.
+func vlanFromIfname(name, ifname string) (int, bool) {
+	rest, ok := strings.CutPrefix(ifname, name+".")
+	if !ok {
+		return 0, false
+	}
+	vid, err := strconv.Atoi(rest)
+	if err != nil || vid <= 0 {
+		return 0, false
+	}
+	return vid, true
+}
+
+func importWireGuard(p *Package, s *Section, im imported) map[string]any {
+	wg := map[string]any{"interface": s.Name}
+	setStr(wg, "private_key", s.Get("private_key"))
+	if addrs := s.Values("addresses"); len(addrs) > 0 {
+		wg["address"] = addrs[0]
+	}
+	var peers []any
+	for _, ps := range p.Find("wireguard_" + s.Name) {
+		m := map[string]any{}
+		setStr(m, "public_key", ps.Get("public_key"))
+		setStr(m, "preshared_key", ps.Get("preshared_key"))
+		if h := ps.Get("endpoint_host"); h != "" {
+			port := ps.Get("endpoint_port")
+			if port == "" {
+				port = "51820"
+			}
+			m["endpoint"] = net.JoinHostPort(h, port)
+		}
+		setList(m, "allowed_ips", ps.Values("allowed_ips"))
+		if ka, err := strconv.Atoi(ps.Get("persistent_keepalive")); err == nil && ka > 0 {
+			m["keepalive"] = ka
+		}
+		peers = append(peers, m)
+		im.all(ps)
+	}
+	if len(peers) > 0 {
+		wg["peers"] = peers
+	}
+	im.all(s)
+	return wg
+}
+
+// ===== wireless =====
+func importWireless(p *Package, nj map[string]any, im imported) {
+	var radios, ifs []any
+	for _, s := range p.Find("wifi-device") {
+		if s.Name == "" {
+			continue
+		}
+		m := map[string]any{"name": s.Name}
+		for _, k := range []string{"type", "band", "hwmode", "channel", "htmode", "country"} {
+			setStr(m, k, s.Get(k))
+		}
+		setInt(m, "txpower", s.Get("txpower"))
+		setFlag(m, "disabled", s.Get("disabled"))
+		radios = append(radios, m)
+		im.all(s)
+	}
+	for _, s := range p.Find("wifi-iface") {
+		m := map[string]any{}
+		setStr(m, "name", s.Name)
+		for _, k := range []string{"device", "mode", "ssid", "encryption", "key", "network", "mesh_id",
+			"mobility_domain", "eap_type", "auth", "identity", "password", "ca_cert"} {
+			setStr(m, k, s.Get(k))
+		}
+		for _, k := range []string{"hidden", "isolate", "wds", "ieee80211r", "ft_psk_generate_local", "disabled"} {
+			setFlag(m, k, s.Get(k))
+		}
+		if v := s.Get("mesh_fwding"); v != "" {
+			m["mesh_fwding"] = v == "1"
+		}
+		if v := s.Get("ft_over_ds"); v != "" {
+			m["ft_over_ds"] = v == "1"
+		}
+		setInt(m, "mesh_rssi_threshold", s.Get("mesh_rssi_threshold"))
+		setInt(m, "ieee80211w", s.Get("ieee80211w"))
+		r := map[string]any{}
+		for _, k := range []string{"auth_server", "auth_port", "auth_secret", "acct_server", "acct_port", "acct_secret", "nasid"} {
+			setStr(r, k, s.Get(k))
+		}
+		setFlag(r, "dynamic_vlan", s.Get("dynamic_vlan"))
+		if len(r) > 0 {
+			m["radius"] = r
+		}
+		ifs = append(ifs, m)
+		im.all(s)
+	}
+	w := map[string]any{}
+	if len(radios) > 0 {
+		w["radios"] = radios
+	}
+	if len(ifs) > 0 {
+		w["interfaces"] = ifs
+	}
+	if len(w) > 0 {
+		nj["wireless"] = w
+	}
+}
+
+// ===== dhcp =====
+func importDHCP(p *Package, nj map[string]any, im imported) {
+	d := map[string]any{}
+	for _, s := range p.Find("dnsmasq") {
+		m := map[string]any{}
+		for _, o := range s.Options {
+			switch o.Name {
+			case "server":
+				setList(m, "servers", o.Values)
+			case "rebind_domain", "addnhosts":
+				setList(m, o.Name, o.Values)
+			case "domain", "local", "leasefile", "resolvfile", "cachesize", "port":
+				setStr(m, o.Name, s.Get(o.Name))
+			default:
+				if v := s.Get(o.Name); !o.List && (v == "0" || v == "1") {
+					m[o.Name] = v == "1"
+				} else {
+					continue
+				}
+			}
+			im.only(s, o.Name)
+		}
+		d["dnsmasq"] = m
+		break
+	}
+
+	var servers []any
+	for _, s := range p.Find("dhcp") {
+		iface := s.Get("interface")
+		if iface == "" {
+			iface = s.Name
+		}
+		if iface == "" || s.Get("ignore") == "1" {
+			continue
+		}
+		m := map[string]any{"interface": iface}
+		setInt(m, "start", s.Get("start"))
+		setInt(m, "limit", s.Get("limit"))
+		setStr(m, "leasetime", s.Get("leasetime"))
+		for _, k := range []string{"dhcpv4", "ra", "dhcpv6", "ndp"} {
+			setStr(m, k, s.Get(k))
+		}
+		setList(m, "ra_flags", s.Values("ra_flags"))
+		setInt(m, "ra_default", s.Get("ra_default"))
+		setFlag(m, "master", s.Get("master"))
+		setFlag(m, "force", s.Get("force"))
+		setList(m, "dhcp_option", s.Values("dhcp_option"))
+		setList(m, "dhcp_option_force", s.Values("dhcp_option_force"))
+		servers = append(servers, m)
+		im.all(s)
+	}
+	setItems(d, "servers", servers)
+
+	var hosts []any
+	for _, s := range p.Find("host") {
+		m := map[string]any{}
+		for _, k := range []string{"name", "ip", "leasetime", "tag"} {
+			setStr(m, k, s.Get(k))
+		}
+		if macs := s.Values("mac"); len(macs) == 1 {
+			m["mac"] = macs[0]
+		} else {
+			setList(m, "mac", macs)
+		}
+		setFlag(m, "dns", s.Get("dns"))
+		hosts = append(hosts, m)
+		im.all(s)
+	}
+	setItems(d, "hosts", hosts)
+
+	var domains []any
+	for _, s := range p.Find("domain") {
+		m := map[string]any{}
+		setStr(m, "name", s.Get("name"))
+		setStr(m, "ip", s.Get("ip"))
+		domains = append(domains, m)
+		im.all(s)
+	}
+	setItems(d, "domains", domains)
+
+	if len(d) > 0 {
+		nj["dhcp"] = d
+	}
+}
+
+// ===== firewall =====
+func importFirewall(p *Package, nj map[string]any, im imported) {
+	fw := map[string]any{}
+	var zones []any
+	for _, s := range p.Find("zone") {
+		name := s.Get("name")
+		if name == "" {
+			continue
+		}
+		m := map[string]any{"name": name}
+		setStr(m, "input", s.Get("input"))
+		setStr(m, "output", s.Get("output"))
+		setStr(m, "forward", s.Get("forward"))
+		setStr(m, "family", s.Get("family"))
+		setList(m, "networks", s.Values("network"))
+		setList(m, "devices", s.Values("device"))
+		setList(m, "subnets", s.Values("subnet"))
+		setList(m, "masq_src", s.Values("masq_src"))
+		setList(m, "masq_dest", s.Values("masq_dest"))
+		for _, k := range []string{"masq", "masq6", "mtu_fix", "log"} {
+			setFlag(m, k, s.Get(k))
+		}
+		zones = append(zones, m)
+		im.all(s)
+	}
+	setItems(fw, "zones", zones)
+
+	var fwds []any
+	for _, s := range p.Find("forwarding") {
+		m := map[string]any{}
+		for _, k := range []string{"src", "dest", "family"} {
+			setStr(m, k, s.Get(k))
+		}
+		fwds = append(fwds, m)
+		im.all(s)
+	}
+	setItems(fw, "forwardings", fwds)
+
+	var rules []any
+	for _, s := range p.Find("rule") {
+		m := map[string]any{}
+		for _, k := range []string{"name", "src", "dest", "proto", "src_mac", "src_port", "dest_port",
+			"ipset", "limit", "limit_burst", "target", "set_mark", "family"} {
+			setStr(m, k, s.Get(k))
+		}
+		setList(m, "src_ip", s.Values("src_ip"))
+		setList(m, "dest_ip", s.Values("dest_ip"))
+		setList(m, "icmp_type", s.Values("icmp_type"))
+		if s.Get("enabled") == "0" {
+			m["enabled"] = false
+		}
+		rules = append(rules, m)
+		im.all(s)
+	}
+	setItems(fw, "rules", rules)
+
+	var redirects []any
+	for _, s := range p.Find("redirect") {
+		m := map[string]any{}
+		for _, k := range []string{"name", "target", "src", "dest", "proto", "src_ip", "src_dip", "src_port",
+			"src_dport", "dest_ip", "dest_port", "ipset", "family"} {
+			setStr(m, k, s.Get(k))
+		}
+		if v := s.Get("reflection"); v != "" {
+			m["reflection"] = v == "1"
+		}
+		if s.Get("enabled") == "0" {
+			m["enabled"] = false
+		}
+		redirects = append(redirects, m)
+		im.all(s)
+	}
+	setItems(fw, "redirects", redirects)
+
+	var ipsets []any
+	for _, s := range p.Find("ipset") {
+		m := map[string]any{}
+		for _, k := range []string{"name", "family", "loadfile", "timeout"} {
+			setStr(m, k, s.Get(k))
+		}
+		setList(m, "match", s.Values("match"))
+		setList(m, "entries", s.Values("entry"))
+		ipsets = append(ipsets, m)
+		im.all(s)
+	}
+	setItems(fw, "ipsets", ipsets)
+
+	var includes []any
+	for _, s := range p.Find("include") {
+		m := map[string]any{}
+		for _, k := range []string{"path", "type", "family", "position", "chain"} {
+			setStr(m, k, s.Get(k))
+		}
+		if v := s.Get("reload"); v != "" {
+			m["reload"] = v == "1"
+		}
+		includes = append(includes, m)
+		im.all(s)
+	}
+	setItems(fw, "includes", includes)
+
+	if len(fw) > 0 {
+		nj["firewall"] = fw
+	}
+}
+
+// ===== OpenVPN =====
+func importOpenVPN(p *Package, nj map[string]any, im imported) {
+	var clients []any
+	for _, s := range p.Find("openvpn") {
+		if s.Get("client") != "1" {
+			continue // серверные инстансы в NetJSON не описываются
+		}
+		m := map[string]any{}
+		setStr(m, "name", s.Name)
+		if f := strings.Fields(s.Get("remote")); len(f) > 0 {
+			m["remote"] = f[0]
+			if len(f) > 1 {
+				setInt(m, "port", f[1])
+			}
+		}
+		setStr(m, "proto", s.Get("proto"))
+		setStr(m, "cipher", s.Get("cipher"))
+		setStr(m, "auth", s.Get("auth"))
+		setStr(m, "config_file", s.Get("config"))
+		clients = append(clients, m)
+		im.all(s)
+	}
+	if len(clients) > 0 {
+		nj["openvpn"] = map[string]any{"clients": clients}
+	}
+}
+
+// ===== mwan3 =====
+func importMWAN3(p *Package, nj map[string]any, im imported) {
+	mw := map[string]any{}
+	for _, s := range p.Find("globals") {
+		g := map[string]any{}
+		setStr(g, "mmx_mask", s.Get("mmx_mask"))
+		setStr(g, "rtmon_interval", s.Get("rtmon_interval"))
+		if v := s.Get("logging"); v != "" {
+			g["logging"] = v == "1"
+		}
+		mw["globals"] = g
+		im.all(s)
+		break
+	}
+	var ifaces, members, policies, rules []any
+	for _, s := range p.Find("interface") {
+		m := map[string]any{"name": s.Name}
+		if s.Get("enabled") == "0" {
+			m["enabled"] = false
+		}
+		setStr(m, "family", s.Get("family"))
+		setList(m, "track_ip", s.Values("track_ip"))
+		setStr(m, "track_method", s.Get("track_method"))
+		for _, k := range []string{"reliability", "count", "timeout", "interval", "down", "up"} {
+			setInt(m, k, s.Get(k))
+		}
+		setStr(m, "initial_state", s.Get("initial_state"))
+		ifaces = append(ifaces, m)
+		im.all(s)
+	}
+	for _, s := range p.Find("member") {
+		m := map[string]any{"name": s.Name}
+		setStr(m, "interface", s.Get("interface"))
+		setInt(m, "metric", s.Get("metric"))
+		setInt(m, "weight", s.Get("weight"))
+		members = append(members, m)
+		im.all(s)
+	}
+	for _, s := range p.Find("policy") {
+		m := map[string]any{"name": s.Name}
+		setList(m, "members", s.Values("use_member"))
+		setStr(m, "last_resort", s.Get("last_resort"))
+		policies = append(policies, m)
+		im.all(s)
+	}
+	for _, s := range p.Find("rule") {
+		m := map[string]any{"name": s.Name}
+		for _, k := range []string{"src_ip", "src_port", "dest_ip", "dest_port", "proto", "ipset", "family", "timeout", "use_policy"} {
+			setStr(m, k, s.Get(k))
+		}
+		setFlag(m, "sticky", s.Get("sticky"))
+		rules = append(rules, m)
+		im.all(s)
+	}
+	setItems(mw, "interfaces", ifaces)
+	setItems(mw, "members", members)
+	setItems(mw, "policies", policies)
+	setItems(mw, "rules", rules)
+	if len(mw) > 0 {
+		nj["mwan3"] = mw
+	}
+}
+
+// ===== ZeroTier =====
+func importZeroTier(p *Package, nj map[string]any, im imported) {
+	for _, s := range p.Find("zerotier") {
+		zt := map[string]any{"enabled": s.Get("enabled") == "1"}
+		setList(zt, "networks", s.Values("join"))
+		nj["zerotier"] = zt
+		im.all(s)
+		return
+	}
+}
+
+// ===== small helpers =====
+func setStr(m map[string]any, k, v string) {
+	if v != "" {
+		m[k] = v
+	}
+}
+
+func setInt(m map[string]any, k, v string) {
+	if i, err := strconv.Atoi(v); err == nil {
+		m[k] = i
+	}
+}
+
+func setFlag(m map[string]any, k, v string) {
+	if v == "1" || strings.EqualFold(v, "true") {
+		m[k] = true
+	}
+}
+
+func setItems(m map[string]any, k string, items []any) {
+	if len(items) > 0 {
+		m[k] = items
+	}
+}
+
+func setList(m map[string]any, k string, vs []string) {
+	if len(vs) > 0 {
+		m[k] = toAny(vs)
+	}
+}
+
+func toAny(vs []string) []any {
+	l := make([]any, len(vs))
+	for i, v := range vs {
+		l[i] = v
+	}
+	return l
+}
@@ -0,0 +1,203 @@
+package uci
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Интерфейсы в схеме netjsonconfig (OpenWrt backend):
+//
+//	{"name": "eth0", "type": "ethernet", "network": "lan", "mtu": 1500, "mac": "..", "autostart": true,
+//	 "addresses": [{"proto": "static", "family": "ipv4", "address": "192.168.1.1", "mask": 24, "gateway": ".."},
+//	               {"proto": "dhcp", "family": "ipv6"}]}
+//
+// Принимаются как в network.interfaces (рядом с плоской формой), так и на верхнем уровне
+// NetJSON ("interfaces", "dns_servers", "dns_search"), как их отдаёт OpenWISP.
+// Как в netjsonconfig: статические адреса собираются в саму секцию <name>, каждый DHCP-протокол —
+// в следующую <name>_2, <name>_3 ... на том же device; dns — только статическим секциям,
+// dns_search — всем, кроме proto none.
+
+// isNetJSONConfigInterface отличает схему netjsonconfig от плоской {name, proto, ipaddr, ...}.
+func isNetJSONConfigInterface(m map[string]any) bool {
+	_, hasAddrs := m["addresses"]
+	_, hasType := m["type"]
+	return hasAddrs || hasType
+}
+
+// ifaceAddr — одна запись addresses[].
+type ifaceAddr struct {
+	proto, family, address, gateway string
+	mask                            int
+}
+
+func (a ifaceAddr) cidr() string { return a.address + "/" + strconv.Itoa(a.mask) }
+
+// uciProto — протокол секции interface для адреса: dhcp по ipv6 — это dhcpv6.
+func (a ifaceAddr) uciProto() string {
+	if a.proto == "dhcp" && a.family == "ipv6" {
+		return "dhcpv6"
+	}
+	return a.proto
+}
+
+func parseAddresses(m map[string]any) ([]ifaceAddr, error) {
+	items, _ := AsSlice(m["addresses"])
+	out := make([]ifaceAddr, 0, len(items))
+	for i, it := range items {
+		am, _ := AsMap(it)
+		a := ifaceAddr{
+			proto:   GetString(am, "proto", "static"),
+			family:  GetString(am, "family", ""),
+			address: GetString(am, "address", ""),
+			gateway: GetString(am, "gateway", ""),
+			mask:    GetInt(am, "mask", -1),
+		}
+		switch a.proto {
+		case "static", "dhcp", "none":
+		default:
+			return nil, At(fmt.Errorf("unsupported proto %q", a.proto), "addresses", i)
+		}
+		if a.family == "" {
+			a.family = AddrFamily(a.address)
+		}
+		if a.family != "ipv4" && a.family != "ipv6" && a.proto != "none" {
+			return nil, At(fmt.Errorf("unknown family %q", a.family), "addresses", i)
+		}
+		if a.proto == "static" {
+			if AddrFamily(a.address) != a.family {
+				return nil, At(fmt.Errorf("%q is not an %s address", a.address, a.family), "addresses", i)
+			}
+			bits := 32
+			if a.family == "ipv6" {
+				bits = 128
+			}
+			if a.mask < 0 {
+				a.mask = min(bits, 64)
+			}
+			if a.mask > bits {
+				return nil, At(fmt.Errorf("bad mask %d", a.mask), "addresses", i)
+			}
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// renderNetJSONConfigInterface рендерит интерфейс netjsonconfig в одну или несколько секций interface.
+func renderNetJSONConfigInterface(m map[string]any, dns, dnsSearch []string, c *Context) error {
+	dev := GetString(m, "name", "")
+	if dev == "" {
+		return fmt.Errorf("interface without name")
+	}
+	name := GetString(m, "network", "")
+	if name == "" {
+		name = strings.NewReplacer("-", "_", ".", "_").Replace(dev)
+	}
+	dev, err := c.bridgeDevice(dev)
+	if err != nil {
+		return At(err, "name")
+	}
+	addrs, err := parseAddresses(m)
+	if err != nil {
+		return err
+	}
+
+	// группируем адреса по протоколу: статические — первой секцией, остальные в порядке появления
+	var order []string
+	groups := map[string][]ifaceAddr{}
+	for _, a := range addrs {
+		p := a.uciProto()
+		if _, ok := groups[p]; !ok {
+			order = append(order, p)
+		}
+		groups[p] = append(groups[p], a)
+	}
+	if len(order) == 0 {
+		order = []string{"none"}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return order[i] == "static" && order[j] != "static" })
+
+	typ := GetString(m, "type", "ethernet")
+	switch typ {
+	case "wireless":
+		dev = "" // wifi-iface сам ссылается на network — device не нужен
+	case "loopback":
+		dev = "lo"
+	}
+	for i, proto := range order {
+		s := &Section{Type: "interface", Name: name}
+		if i > 0 {
+			s.Name = fmt.Sprintf("%s_%d", name, i+1)
+		}
+		opt(s, "device", dev)
+		opt(s, "proto", proto)
+		if proto == "static" {
+			renderStaticAddrs(s, groups[proto])
+		}
+		if typ != "loopback" {
+			if proto == "static" {
+				for _, d := range dns {
+					lst(s, "dns", d)
+				}
+			}
+			if proto != "none" {
+				for _, d := range dnsSearch {
+					lst(s, "dns_search", d)
+				}
+			}
+		}
+		if i == 0 {
+			if mtu := GetInt(m, "mtu", 0); mtu > 0 {
+				opt(s, "mtu", strconv.Itoa(mtu))
+			}
+			opt(s, "macaddr", GetString(m, "mac", ""))
+			if !GetBool(m, "autostart", true) {
+				opt(s, "auto", "0")
+			}
+			optBool(s, "disabled", GetBool(m, "disabled", false))
+		}
+		if err := c.Doc.Add("network", s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderStaticAddrs: один IPv4 → ipaddr+netmask, несколько → list ipaddr в CIDR; IPv6 → list ip6addr.
+func renderStaticAddrs(s *Section, addrs []ifaceAddr) {
+	var v4, v6 []ifaceAddr
+	for _, a := range addrs {
+		if a.family == "ipv6" {
+			v6 = append(v6, a)
+		} else {
+			v4 = append(v4, a)
+		}
+	}
+	switch {
+	case len(v4) == 1:
+		opt(s, "ipaddr", v4[0].address)
+		opt(s, "netmask", net.IP(net.CIDRMask(v4[0].mask, 32)).String())
+	case len(v4) > 1:
+		for _, a := range v4 {
+			lst(s, "ipaddr", a.cidr())
+		}
+	}
+	for _, a := range v4 {
+		if a.gateway != "" {
+			opt(s, "gateway", a.gateway)
+			break
+		}
+	}
+	for _, a := range v6 {
+		lst(s, "ip6addr", a.cidr())
+	}
+	for _, a := range v6 {
+		if a.gateway != "" {
+			opt(s, "ip6gw", a.gateway)
+			break
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package uci
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// mwan3 — multi-WAN (failover/балансировка):
+//
+//	{"interfaces": [{"name": "wan", "track_ip": ["1.1.1.1", "8.8.8.8"], "reliability": 1},
+//	                {"name": "wanb", "track_ip": ["9.9.9.9"]}],
+//	 "members":    [{"name": "wan_m1", "interface": "wan", "metric": 1, "weight": 1},
+//	                {"name": "wanb_m2", "interface": "wanb", "metric": 2, "weight": 1}],
+//	 "policies":   [{"name": "failover", "members": ["wan_m1", "wanb_m2"], "last_resort": "unreachable"}],
+//	 "rules":      [{"name": "default_rule", "dest_ip": "0.0.0.0/0", "use_policy": "failover"}]}
+//
+// Ссылки member → interface, policy → member, rule → policy проверяются. Интерфейсы mwan3
+// должны совпадать с интерфейсами network, если тот же NetJSON их описывает.
+
+var mwan3LastResort = map[string]bool{"unreachable": true, "blackhole": true, "default": true}
+
+func renderMWAN3(v any, c *Context) error {
+	mw, _ := AsMap(v)
+	if mw == nil {
+		return nil
+	}
+	c.Doc.Package("mwan3")
+	netw := c.Doc.Lookup("network")
+
+	if g, ok := AsMap(mw["globals"]); ok {
+		s := &Section{Type: "globals", Name: "globals"}
+		opt(s, "mmx_mask", GetString(g, "mmx_mask", ""))
+		opt(s, "rtmon_interval", GetString(g, "rtmon_interval", ""))
+		if _, ok := g["logging"]; ok {
+			opt(s, "logging", boolStr(GetBool(g, "logging", false)))
+		}
+		if err := c.Doc.Add("mwan3", s); err != nil {
+			return err
+		}
+	}
+
+	ifaces := map[string]bool{}
+	items, _ := AsSlice(mw["interfaces"])
+	for i, it := range items {
+		m, _ := AsMap(it)
+		name := GetString(m, "name", "")
+		if err := mwan3Name(name); err != nil {
+			return At(err, "mwan3", "interfaces", i)
+		}
+		if netw != nil && !hasInterface(netw, name) {
+			return At(fmt.Errorf("%q is not a network interface", name), "mwan3", "interfaces", i)
+		}
+		ifaces[name] = true
+		s := &Section{Type: "interface", Name: name}
+		opt(s, "enabled", boolStr(GetBool(m, "enabled", true)))
+		family := GetString(m, "family", "ipv4")
+		if family != "ipv4" && family != "ipv6" {
+			return At(fmt.Errorf("unknown family %q", family), "mwan3", "interfaces", i)
+		}
+		opt(s, "family", family)
+		for _, ip := range StrList(m["track_ip"]) {
+			if net.ParseIP(ip) == nil {
+				return At(fmt.Errorf("bad track_ip %q", ip), "mwan3", "interfaces", i)
+			}
+			lst(s, "track_ip", ip)
+		}
+		opt(s, "track_method", GetString(m, "track_method", ""))
+		for _, k := range []string{"reliability", "count", "timeout", "interval", "down", "up"} {
+			if n := GetInt(m, k, 0); n > 0 {
+				opt(s, k, strconv.Itoa(n))
+			}
+		}
+		if n, err := strconv.Atoi(s.Get("reliability")); err == nil && n > len(s.Values("track_ip")) {
+			return At(fmt.Errorf("reliability %d exceeds number of track_ip", n), "mwan3", "interfaces", i)
+		}
+		opt(s, "initial_state", GetString(m, "initial_state", ""))
+		if err := c.Doc.Add("mwan3", s); err != nil {
+			return err
+		}
+	}
+
+	members := map[string]bool{}
+	items, _ = AsSlice(mw["members"])
+	for i, it := range items {
+		m, _ := AsMap(it)
+		name := GetString(m, "name", "")
+		if err := mwan3Name(name); err != nil {
+			return At(err, "mwan3", "members", i)
+		}
+		iface := GetString(m, "interface", "")
+		if !ifaces[iface] {
+			return At(fmt.Errorf("unknown interface %q", iface), "mwan3", "members", i)
+		}
+		members[name] = true
+		s := &Section{Type: "member", Name: name}
+		opt(s, "interface", iface)
+		opt(s, "metric", strconv.Itoa(GetInt(m, "metric", 1)))
+		opt(s, "weight", strconv.Itoa(GetInt(m, "weight", 1)))
+		if err := c.Doc.Add("mwan3", s); err != nil {
+			return err
+		}
+	}
+
+	policies := map[string]bool{}
+	items, _ = AsSlice(mw["policies"])
+	for i, it := range items {
+		m, _ := AsMap(it)
+		name := GetString(m, "name", "")
+		if err := mwan3Name(name); err != nil {
+			return At(err, "mwan3", "policies", i)
+		}
+		if len(name) > 15 {
+			return At(fmt.Errorf("name longer than 15 characters"), "mwan3", "policies", i)
+		}
+		policies[name] = true
+		s := &Section{Type: "policy", Name: name}
+		use := StrList(m["members"])
+		if len(use) == 0 {
+			return At(fmt.Errorf("members are required"), "mwan3", "policies", i)
+		}
+		for _, u := range use {
+			if !members[u] {
+				return At(fmt.Errorf("unknown member %q", u), "mwan3", "policies", i)
+			}
+			lst(s, "use_member", u)
+		}
+		if lr := GetString(m, "last_resort", ""); lr != "" {
+			if !mwan3LastResort[lr] {
+				return At(fmt.Errorf("bad last_resort %q", lr), "mwan3", "policies", i)
+			}
+			opt(s, "last_resort", lr)
+		}
+		if err := c.Doc.Add("mwan3", s); err != nil {
+			return err
+		}
+	}
+
+	items, _ = AsSlice(mw["rules"])
+	for i, it := range items {
+		m, _ := AsMap(it)
+		name := GetString(m, "name", "")
+		if err := mwan3Name(name); err != nil {
+			return At(err, "mwan3", "rules", i)
+		}
+		use := GetString(m, "use_policy", "")
+		if !policies[use] && !mwan3LastResort[use] {
+			return At(fmt.Errorf("unknown policy %q", use), "mwan3", "rules", i)
+		}
+		// в mwan3 src_ip/dest_ip — одно значение (option), несколько адресов — через ipset
+		for _, k := range []string{"src_ip", "dest_ip"} {
+			if _, ok := m[k].([]any); ok {
+				return At(fmt.Errorf("must be a single address or prefix (use ipset for several)"), "mwan3", "rules", i, k)
+			}
+		}
+		family, err := ruleFamily(m)
+		if err != nil {
+			return At(err, "mwan3", "rules", i)
+		}
+		s := &Section{Type: "rule", Name: name}
+		for _, k := range []string{"src_ip", "src_port", "dest_ip", "dest_port", "proto", "ipset"} {
+			opt(s, k, GetString(m, k, ""))
+		}
+		opt(s, "family", family)
+		optBool(s, "sticky", GetBool(m, "sticky", false))
+		opt(s, "timeout", GetString(m, "timeout", ""))
+		opt(s, "use_policy", use)
+		if err := c.Doc.Add("mwan3", s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mwan3Name — все объекты mwan3 — именованные секции, имя обязано быть валидным для uci.
+func mwan3Name(name string) error {
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if sectionName.MatchString(name) {
+		return fmt.Errorf("name %q may contain only letters, digits and _", name)
+	}
+	return nil
+}
+
+func hasInterface(p *Package, name string) bool {
+	s := p.Section(name)
+	return s != nil && s.Type == "interface"
+}
@@ -0,0 +1,121 @@
+package uci
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestNetJSONConfigCompat: testdata/netjsonconfig/<name>.json — примеры из документации
+// netjsonconfig (OpenWrt backend), <name>.uci — вывод netjsonconfig для них (package network,
+// как его печатает OpenWrt(...).render()). Сравнение идёт на уровне секций и опций, а не текста:
+// порядок опций не важен, option 'a b' равна list a + list b (netifd читает их одинаково).
+// Файлы .uci не перегенерируются из нашего вывода — их источник только netjsonconfig.
+func TestNetJSONConfigCompat(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/netjsonconfig/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no testdata/netjsonconfig/*.json")
+	}
+	for _, in := range inputs {
+		name := strings.TrimSuffix(filepath.Base(in), ".json")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var nj map[string]any
+			if err := json.Unmarshal(raw, &nj); err != nil {
+				t.Fatal(err)
+			}
+			files, err := RenderAll(nj, Options{Strict: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			exp, err := os.ReadFile(strings.TrimSuffix(in, ".json") + ".uci")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := Parse("", bytes.NewReader(exp))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got *Package
+			for _, f := range files {
+				if f.Name == "etc/config/"+want.Name {
+					if got, err = Parse(want.Name, bytes.NewReader(f.Data)); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if got == nil {
+				t.Fatalf("no etc/config/%s in output", want.Name)
+			}
+			for _, d := range comparePackages(want, got) {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+// comparePackages — расхождения got с want: секции сопоставляются по типу и имени
+// (анонимные — по порядку внутри типа), опции — через Values.
+func comparePackages(want, got *Package) []string {
+	index := func(p *Package) (map[string]*Section, []string) {
+		m := map[string]*Section{}
+		var keys []string
+		n := map[string]int{}
+		for _, s := range p.Sections {
+			k := s.Type + " '" + s.Name + "'"
+			if s.Name == "" {
+				k = fmt.Sprintf("%s[%d]", s.Type, n[s.Type])
+				n[s.Type]++
+			}
+			m[k] = s
+			keys = append(keys, k)
+		}
+		return m, keys
+	}
+	wm, wk := index(want)
+	gm, gk := index(got)
+	var diffs []string
+	for _, k := range wk {
+		g, ok := gm[k]
+		if !ok {
+			diffs = append(diffs, "missing section "+k)
+			continue
+		}
+		w := wm[k]
+		names := map[string]bool{}
+		for _, o := range w.Options {
+			names[o.Name] = true
+		}
+		for _, o := range g.Options {
+			names[o.Name] = true
+		}
+		var sorted []string
+		for n := range names {
+			sorted = append(sorted, n)
+		}
+		sort.Strings(sorted)
+		for _, n := range sorted {
+			if wv, gv := w.Values(n), g.Values(n); !reflect.DeepEqual(wv, gv) {
+				diffs = append(diffs, fmt.Sprintf("%s: option %s: want %q, got %q", k, n, wv, gv))
+			}
+		}
+	}
+	for _, k := range gk {
+		if _, ok := wm[k]; !ok {
+			diffs = append(diffs, "unexpected section "+k)
+		}
+	}
+	return diffs
+}
@@ -3,12 +3,19 @@ package uci
 import (
 	"fmt"
 	"net"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
 type Options struct {
 	DeviceHostname string
+	DeviceUUID     string // соль для хеша root_password (стабильный хеш между reconcile)
+	SwitchMode     string // SwitchDSA (по умолчанию) | SwitchSwconfig — зависит от модели устройства
+
+	// Strict — строгий режим: некорректные значения, которые обычно пропускаются, и ключи
+	// без рендерера становятся ошибками; RenderAll собирает все и возвращает ValidationErrors.
+	Strict bool
 }
 
 // File — тип, который RenderAll собирает в []File и передаёт в tarball.Build
@@ -18,338 +25,447 @@ type File struct {
 	Mode int // 0644 и т.п.; если твоему tarball не нужен — можно оставить 0
 }
 
-// RenderAll — рендерит UCI-файлы из NetJSON.
-// Поддержка секций: system, network (interfaces/VLAN), wireless, dhcp, firewall,
-// и упрощённые блоки wireguard/openvpn/zerotier.
+// RenderAll — рендерит UCI-файлы из NetJSON зарегистрированными рендерерами (см. Register).
+// Встроенные: system, network (interfaces/VLAN/routes), wireless, dhcp, firewall,
+// упрощённые блоки wireguard/openvpn/zerotier, mwan3 и произвольные files; блок "uci" (PassthroughKey) — последним.
+// Все рендереры пишут в общий Document, поэтому на выходе ровно один файл на пакет.
+// Ключи NetJSON без рендерера не теряются молча: файлы возвращаются вместе с *UnclaimedKeysError.
+// В строгом режиме (Options.Strict) файлов нет, если есть хоть одна ошибка: все они — в ValidationErrors.
 func RenderAll(netjson map[string]any, opts Options) ([]File, error) {
-	var files []File
-
-	if f := renderSystem(netjson, opts); f != nil {
-		files = append(files, *f)
-	}
-	if f := renderNetwork(netjson); f != nil {
-		files = append(files, *f)
-	}
-	if f := renderWireless(netjson); f != nil {
-		files = append(files, *f)
-	}
-	if f := renderDHCP(netjson); f != nil {
-		files = append(files, *f)
+	c := &Context{NetJSON: netjson, Opts: opts, Doc: NewDocument(), Collector: Collector{Strict: opts.Strict}}
+	rs := Renderers()
+	for _, r := range rs {
+		if err := r.Render(netjson[r.Key], c); err != nil {
+			if !opts.Strict {
+				return nil, fmt.Errorf("uci: render %s: %w", r.Key, err)
+			}
+			c.Fail(r.Key, err)
+		}
 	}
-	if f := renderFirewall(netjson); f != nil {
-		files = append(files, *f)
+	// сырые секции — последним слоем, поверх типизированных
+	if err := renderPassthrough(netjson[PassthroughKey], c); err != nil {
+		if !opts.Strict {
+			return nil, fmt.Errorf("uci: render %s: %w", PassthroughKey, err)
+		}
+		c.Fail(PassthroughKey, err)
 	}
-	// VPN/overlay
-	if f := renderWireGuard(netjson); f != nil {
-		files = append(files, *f)
+	keys := unclaimedKeys(netjson, rs)
+	if opts.Strict {
+		for _, k := range keys {
+			c.Invalid(Pointer(k), "no renderer for this key")
+		}
+		if len(c.Errs) > 0 {
+			return nil, ValidationErrors(c.Errs)
+		}
 	}
-	if f := renderOpenVPN(netjson); f != nil {
-		files = append(files, *f)
+	files, err := c.Doc.Files()
+	if err != nil {
+		return nil, err
 	}
-	if f := renderZeroTier(netjson); f != nil {
-		files = append(files, *f)
+	if len(keys) > 0 {
+		return files, &UnclaimedKeysError{Keys: keys}
 	}
-
 	return files, nil
 }
 
 // ===== helpers =====
-func q(s string) string { return strings.ReplaceAll(s, "'", "\\'") }
-
-func addLine(b *strings.Builder, format string, args ...any) { fmt.Fprintf(b, format, args...) }
+// q экранирует одинарную кавычку для '...': закрыть, экранировать, открыть снова — как в шелле/uci.
+func q(s string) string { return strings.ReplaceAll(s, "'", `'\''`) }
 
-func opt(b *strings.Builder, k, v string) {
+func opt(s *Section, k, v string) {
 	if v == "" {
 		return
 	}
-	addLine(b, "\toption %s '%s'\n", k, q(v))
+	s.Set(k, v)
 }
-func optBool(b *strings.Builder, k string, v bool) {
+func optBool(s *Section, k string, v bool) {
 	if v {
-		addLine(b, "\toption %s '1'\n", k)
+		s.Set(k, "1")
 	}
 }
-func lst(b *strings.Builder, k, v string) {
+func lst(s *Section, k, v string) {
 	if v != "" {
-		addLine(b, "\tlist %s '%s'\n", k, q(v))
+		s.Append(k, v)
 	}
 }
 
 // ===== system =====
-func renderSystem(nj map[string]any, opt Options) *File {
+// system: { hostname, zonename ("Europe/Berlin"), timezone (POSIX, если зоны нет в таблице),
+// ntp: { enabled, enable_server, servers[] }, log_ip, log_port, log_proto, log_size,
+// leds: [{ name, sysfs, trigger, default, dev, mode, delayon, delayoff, interval }],
+// root_password_hash | root_password } — пароль см. password.go
+func renderSystem(v any, c *Context) error {
+	sys, _ := AsMap(v)
 	// приоритет: NetJSON > опция > дефолт
-	hn := strAt(nj, "system", "hostname")
+	hn := GetString(sys, "hostname", "")
 	if hn == "" {
-		hn = opt.DeviceHostname
+		hn = c.Opts.DeviceHostname
 	}
 	if hn == "" {
 		hn = "OpenWrt"
 	}
 
-	content := fmt.Sprintf(
-		"config system\n\toption hostname '%s'\n",
-		hn,
-	)
+	s := &Section{Type: "system"}
+	opt(s, "hostname", hn)
 
-	return &File{
-		Name: "etc/config/system",
-		Data: []byte(content),
-		Mode: 0644,
+	zone, tz := GetString(sys, "zonename", ""), GetString(sys, "timezone", "")
+	if zone != "" && tz == "" {
+		if tz = zoneinfo[zone]; tz == "" {
+			return fmt.Errorf("unknown zonename %q (set timezone explicitly)", zone)
+		}
 	}
-}
+	opt(s, "zonename", zone)
+	opt(s, "timezone", tz)
 
-// ===== network =====
-func renderNetwork(nj map[string]any) *File {
-	netw, _ := asMap(nj["network"])
-	if netw == nil {
-		return nil
+	if ip := GetString(sys, "log_ip", ""); ip != "" {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("bad log_ip %q", ip)
+		}
+		proto := GetString(sys, "log_proto", "udp")
+		if proto != "udp" && proto != "tcp" {
+			return fmt.Errorf("log_proto must be udp or tcp, got %q", proto)
+		}
+		opt(s, "log_ip", ip)
+		opt(s, "log_port", strconv.Itoa(GetInt(sys, "log_port", 514)))
+		opt(s, "log_proto", proto)
+	}
+	if n := GetInt(sys, "log_size", 0); n > 0 {
+		opt(s, "log_size", strconv.Itoa(n))
+	}
+	for _, k := range []string{"conloglevel", "cronloglevel"} {
+		opt(s, k, GetString(sys, k, ""))
+	}
+	if err := c.Doc.Add("system", s); err != nil {
+		return err
+	}
+
+	if ntp, ok := AsMap(sys["ntp"]); ok {
+		t := &Section{Type: "timeserver", Name: "ntp"}
+		opt(t, "enabled", boolStr(GetBool(ntp, "enabled", true)))
+		opt(t, "enable_server", boolStr(GetBool(ntp, "enable_server", false)))
+		for _, srv := range StrList(ntp["servers"]) {
+			lst(t, "server", srv)
+		}
+		if err := c.Doc.Add("system", t); err != nil {
+			return err
+		}
 	}
-	var b strings.Builder
-	// interfaces
-	ifaces, _ := asSlice(netw["interfaces"]) // []{ name, proto, ipaddr, netmask, gateway, dns[], vlan, disabled }
-	for _, it := range ifaces {
-		m, _ := asMap(it)
-		name := getString(m, "name", "")
-		if name == "" {
-			continue
+
+	leds, _ := AsSlice(sys["leds"])
+	for i, l := range leds {
+		m, _ := AsMap(l)
+		name, sysfs := GetString(m, "name", ""), GetString(m, "sysfs", "")
+		if name == "" || sysfs == "" {
+			return At(fmt.Errorf("name and sysfs are required"), "system", "leds", i)
 		}
-		addLine(&b, "config interface '%s'\n", q(name))
-		opt(&b, "proto", getString(m, "proto", "static"))
-		opt(&b, "ipaddr", getString(m, "ipaddr", ""))
-		opt(&b, "netmask", getString(m, "netmask", ""))
-		opt(&b, "gateway", getString(m, "gateway", ""))
-		dnss, _ := asSlice(m["dns"])
-		for _, d := range dnss {
-			lst(&b, "dns", fmt.Sprint(d))
+		trigger := GetString(m, "trigger", "none")
+		ls := &Section{Type: "led", Name: "led_" + sectionName.ReplaceAllString(strings.ToLower(name), "_")}
+		opt(ls, "name", name)
+		opt(ls, "sysfs", sysfs)
+		opt(ls, "trigger", trigger)
+		if _, ok := m["default"]; ok {
+			opt(ls, "default", boolStr(GetBool(m, "default", false)))
+		}
+		switch trigger {
+		case "netdev":
+			if GetString(m, "dev", "") == "" {
+				return fmt.Errorf("led %s: netdev trigger needs dev", name)
+			}
+			opt(ls, "dev", GetString(m, "dev", ""))
+			opt(ls, "mode", GetString(m, "mode", "link tx rx"))
+		case "timer":
+			opt(ls, "delayon", GetString(m, "delayon", "500"))
+			opt(ls, "delayoff", GetString(m, "delayoff", "500"))
+		case "heartbeat", "none", "default-on":
+		default:
+			opt(ls, "dev", GetString(m, "dev", ""))
 		}
-		if v := getInt(m, "vlan", 0); v > 0 {
-			opt(&b, "ifname", fmt.Sprintf("%s.%d", name, v))
+		opt(ls, "interval", GetString(m, "interval", ""))
+		if err := c.Doc.Add("system", ls); err != nil {
+			return err
 		}
-		optBool(&b, "disabled", getBool(m, "disabled", false))
-		addLine(&b, "\n")
 	}
-	return &File{Name: "etc/config/network", Mode: 0644, Data: []byte(b.String())}
 
+	return renderRootPassword(sys, c)
 }
 
-// ===== wireless =====
-func renderWireless(nj map[string]any) *File {
-	w, _ := asMap(nj["wireless"])
-	if w == nil {
+// ===== network =====
+func renderNetwork(v any, c *Context) error {
+	netw, _ := AsMap(v)
+	top, _ := AsSlice(c.NetJSON["interfaces"]) // netjsonconfig: interfaces на верхнем уровне
+	if netw == nil && top == nil && c.NetJSON["routes"] == nil && c.NetJSON["ip_rules"] == nil {
 		return nil
 	}
-	var b strings.Builder
-	// devices (radios)
-	radios, _ := asSlice(w["radios"]) // []{ name, hwmode, channel, country, disabled }
-	for _, r := range radios {
-		m, _ := asMap(r)
-		name := getString(m, "name", "")
-		if name == "" {
-			continue
+	c.Doc.Package("network")
+	// мосты/VLAN (config device, bridge-vlan | switch_vlan) — до интерфейсов, которые на них ссылаются
+	if err := renderBridges(netw, c); err != nil {
+		return err
+	}
+	dns := StrList(c.NetJSON["dns_servers"])
+	for i, d := range dns {
+		checkIP(c, Pointer("dns_servers", i), d)
+	}
+	dnsSearch := StrList(c.NetJSON["dns_search"])
+	// interfaces: плоская форма
+	// []{ name, device, vlan, proto, ipaddr | ipaddr[] (CIDR), netmask, gateway, ip6addr[], ip6gw, ip6assign, ip6hint, dns[], disabled }
+	// или схема netjsonconfig (type/addresses/mtu/mac/autostart) — см. interfaces.go
+	renderIface := func(m map[string]any, p []any) error {
+		if isNetJSONConfigInterface(m) {
+			if err := renderNetJSONConfigInterface(m, dns, dnsSearch, c); err != nil {
+				return At(err, p...)
+			}
+			return nil
 		}
-		addLine(&b, "config wifi-device '%s'\n", q(name))
-		opt(&b, "type", "mac80211")
-		opt(&b, "hwmode", getString(m, "hwmode", ""))
-		opt(&b, "channel", getString(m, "channel", "auto"))
-		opt(&b, "country", getString(m, "country", ""))
-		optBool(&b, "disabled", getBool(m, "disabled", false))
-		addLine(&b, "\n")
-	}
-	// ifaces — плоско в wireless.interfaces
-	ifs, _ := asSlice(w["interfaces"]) // []{ device, mode, ssid, encryption, key, network }
-	for _, x := range ifs {
-		m, _ := asMap(x)
-		dev := getString(m, "device", "")
-		addLine(&b, "config wifi-iface\n")
-		opt(&b, "device", dev)
-		opt(&b, "mode", getString(m, "mode", "ap"))
-		opt(&b, "ssid", getString(m, "ssid", ""))
-		opt(&b, "encryption", getString(m, "encryption", "psk2"))
-		opt(&b, "key", getString(m, "key", ""))
-		opt(&b, "network", getString(m, "network", "lan"))
-		optBool(&b, "disabled", getBool(m, "disabled", false))
-		addLine(&b, "\n")
-	}
-	return &File{Name: "etc/config/wireless", Mode: 0644, Data: []byte(b.String())}
-}
-
-// ===== dhcp =====
-func renderDHCP(nj map[string]any) *File {
-	d, _ := asMap(nj["dhcp"])
-	if d == nil {
-		return nil
+		return renderFlatInterface(m, p, c)
 	}
-	var b strings.Builder
-	servers, _ := asSlice(d["servers"]) // []{ interface, start, limit, leasetime }
-	for _, s := range servers {
-		m, _ := asMap(s)
-		name := getString(m, "interface", "")
-		if name == "" {
-			continue
-		}
-		addLine(&b, "config dhcp '%s'\n", q(name))
-		opt(&b, "interface", name)
-		if v := getInt(m, "start", 0); v > 0 {
-			opt(&b, "start", strconv.Itoa(v))
-		}
-		if v := getInt(m, "limit", 0); v > 0 {
-			opt(&b, "limit", strconv.Itoa(v))
-		}
-		opt(&b, "leasetime", getString(m, "leasetime", "12h"))
-		addLine(&b, "\n")
+	if err := EachItem(netw["interfaces"], []any{"network", "interfaces"}, renderIface); err != nil {
+		return err
 	}
-	return &File{Name: "etc/config/dhcp", Mode: 0644, Data: []byte(b.String())}
+	if err := EachItem(top, []any{"interfaces"}, renderIface); err != nil {
+		return err
+	}
+	// статические маршруты и policy routing — после интерфейсов, на которые ссылаются
+	return renderRoutes(netw, c)
+}
+
+// knownProtos — протоколы netifd, которые мы знаем; остальные в строгом режиме — ошибка.
+var knownProtos = map[string]bool{
+	"static": true, "dhcp": true, "dhcpv6": true, "none": true, "pppoe": true, "pppoa": true, "ppp": true,
+	"6in4": true, "6to4": true, "6rd": true, "dslite": true, "l2tp": true, "pptp": true, "gre": true, "gretap": true,
+	"vxlan": true, "qmi": true, "ncm": true, "mbim": true, "3g": true, "wireguard": true, "batadv": true,
 }
 
-// ===== firewall =====
-func renderFirewall(nj map[string]any) *File {
-	fw, _ := asMap(nj["firewall"])
-	if fw == nil {
+func renderFlatInterface(m map[string]any, p []any, c *Context) error {
+	name := GetString(m, "name", "")
+	if name == "" {
+		c.Invalid(Pointer(p...), "interface without name is skipped")
 		return nil
 	}
-	var b strings.Builder
-	zones, _ := asSlice(fw["zones"]) // []{ name, networks[], input, output, forward }
-	for _, z := range zones {
-		m, _ := asMap(z)
-		name := getString(m, "name", "")
-		if name == "" {
-			continue
-		}
-		addLine(&b, "config zone\n")
-		opt(&b, "name", name)
-		opt(&b, "input", getString(m, "input", "ACCEPT"))
-		opt(&b, "output", getString(m, "output", "ACCEPT"))
-		opt(&b, "forward", getString(m, "forward", "REJECT"))
-		nets, _ := asSlice(m["networks"])
-		for _, n := range nets {
-			lst(&b, "network", fmt.Sprint(n))
-		}
-		addLine(&b, "\n")
-	}
-	rules, _ := asSlice(fw["rules"]) // []{ name, src, dest, proto, dest_port, target, family }
-	for i, r := range rules {
-		m, _ := asMap(r)
-		addLine(&b, "config rule\n")
-		opt(&b, "name", getString(m, "name", fmt.Sprintf("rule_%d", i+1)))
-		opt(&b, "src", getString(m, "src", ""))
-		opt(&b, "dest", getString(m, "dest", ""))
-		opt(&b, "proto", getString(m, "proto", "tcpudp"))
-		opt(&b, "target", getString(m, "target", "ACCEPT"))
-		if p := getString(m, "dest_port", ""); p != "" {
-			opt(&b, "dest_port", p)
-		}
-		if f := getString(m, "family", ""); f != "" {
-			opt(&b, "family", f)
+	s := &Section{Type: "interface", Name: name}
+	proto := GetString(m, "proto", "static")
+	if !knownProtos[proto] {
+		c.Invalid(Pointer(append(p, "proto")...), "unknown proto %q", proto)
+	}
+	opt(s, "proto", proto)
+	// ipaddr: один адрес (+ netmask) или список CIDR, как list ipaddr в netifd
+	addrs := StrList(m["ipaddr"])
+	_, isList := m["ipaddr"].([]any)
+	if isList || len(addrs) == 1 && strings.Contains(addrs[0], "/") {
+		for i, a := range addrs {
+			ptr := Pointer(append(p, "ipaddr")...)
+			if isList {
+				ptr = Pointer(append(p, "ipaddr", i)...)
+			}
+			checkCIDR(c, ptr, a)
+			lst(s, "ipaddr", a)
 		}
-		addLine(&b, "\n")
-	}
-	return &File{Name: "etc/config/firewall", Mode: 0644, Data: []byte(b.String())}
+	} else {
+		checkIP(c, Pointer(append(p, "ipaddr")...), GetString(m, "ipaddr", ""))
+		opt(s, "ipaddr", GetString(m, "ipaddr", ""))
+	}
+	for _, k := range []string{"netmask", "gateway"} {
+		checkIP(c, Pointer(append(p, k)...), GetString(m, k, ""))
+		opt(s, k, GetString(m, k, ""))
+	}
+	if proto == "static" && len(addrs) == 0 && len(StrList(m["ip6addr"])) == 0 {
+		c.Invalid(Pointer(p...), "static interface %s has no address", name)
+	}
+	// IPv6: статические адреса/шлюз и раздача делегированного префикса (ip6assign/ip6hint)
+	for i, a := range StrList(m["ip6addr"]) {
+		checkCIDR(c, Pointer(append(p, "ip6addr", i)...), a)
+		lst(s, "ip6addr", a)
+	}
+	checkIP(c, Pointer(append(p, "ip6gw")...), GetString(m, "ip6gw", ""))
+	opt(s, "ip6gw", GetString(m, "ip6gw", ""))
+	for _, pr := range StrList(m["ip6prefix"]) {
+		lst(s, "ip6prefix", pr)
+	}
+	if v := GetInt(m, "ip6assign", 0); v > 0 {
+		opt(s, "ip6assign", strconv.Itoa(v))
+	}
+	opt(s, "ip6hint", GetString(m, "ip6hint", ""))
+	opt(s, "ip6ifaceid", GetString(m, "ip6ifaceid", ""))
+	for _, k := range protoOptions[proto] {
+		opt(s, k, GetString(m, k, ""))
+	}
+	for i, d := range StrList(m["dns"]) {
+		checkIP(c, Pointer(append(p, "dns", i)...), d)
+		lst(s, "dns", d)
+	}
+	// device: порт или мост ("br-lan"); vlan вешается на него как "<device>.<vid>" (DSA),
+	// в swconfig — мост этого VLAN (см. bridgeDevice)
+	dev := GetString(m, "device", "")
+	vid := GetInt(m, "vlan", 0)
+	if vid > 0 && dev != "" {
+		dev = fmt.Sprintf("%s.%d", dev, vid)
+	}
+	if d, err := c.bridgeDevice(dev); err != nil {
+		c.Invalid(Pointer(append(p, "device")...), "%v", err)
+	} else {
+		dev = d
+	}
+	if vid > 0 && dev == "" {
+		// legacy: без device VLAN задаётся через ifname '<name>.<vid>'
+		opt(s, "ifname", fmt.Sprintf("%s.%d", name, vid))
+	} else {
+		opt(s, "device", dev)
+	}
+	optBool(s, "disabled", GetBool(m, "disabled", false))
+	return c.Doc.Add("network", s)
+}
 
+// protoOptions — специфичные для протокола опции интерфейса, копируются как есть.
+var protoOptions = map[string][]string{
+	"dhcpv6": {"reqaddress", "reqprefix", "ip6prefix_hint"},
+	"6in4":   {"peeraddr", "tunnelid", "username", "password", "mtu", "ttl"},
 }
 
 // ===== WireGuard =====
-func renderWireGuard(nj map[string]any) *File {
-	wg, _ := asMap(nj["wireguard"]) // { interface, address, private_key, peers[] }
+func renderWireGuard(v any, c *Context) error {
+	wg, _ := AsMap(v) // { interface, address, private_key, peers[] }
 	if wg == nil {
 		return nil
 	}
-	var b strings.Builder
-	iface := getString(wg, "interface", "wg0")
-	addLine(&b, "config interface '%s'\n", q(iface))
-	opt(&b, "proto", "wireguard")
-	opt(&b, "private_key", getString(wg, "private_key", ""))
-	if addr := getString(wg, "address", ""); addr != "" {
-		lst(&b, "addresses", addr)
-	}
-	peers, _ := asSlice(wg["peers"]) // []map
-	for _, p := range peers {
-		m, _ := asMap(p)
-		addLine(&b, "config wireguard_%s\n", q(iface))
-		opt(&b, "public_key", getString(m, "public_key", ""))
-		if v := getString(m, "preshared_key", ""); v != "" {
-			opt(&b, "preshared_key", v)
+	iface := GetString(wg, "interface", "wg0")
+	s := &Section{Type: "interface", Name: iface}
+	opt(s, "proto", "wireguard")
+	checkWGKey(c, Pointer("wireguard", "private_key"), GetString(wg, "private_key", ""))
+	opt(s, "private_key", GetString(wg, "private_key", ""))
+	checkCIDR(c, Pointer("wireguard", "address"), GetString(wg, "address", ""))
+	lst(s, "addresses", GetString(wg, "address", ""))
+	if err := c.Doc.Add("network", s); err != nil {
+		return err
+	}
+	peers, _ := AsSlice(wg["peers"]) // []map
+	for i, p := range peers {
+		m, _ := AsMap(p)
+		ps := &Section{Type: "wireguard_" + iface}
+		checkWGKey(c, Pointer("wireguard", "peers", i, "public_key"), GetString(m, "public_key", ""))
+		checkWGKey(c, Pointer("wireguard", "peers", i, "preshared_key"), GetString(m, "preshared_key", ""))
+		opt(ps, "public_key", GetString(m, "public_key", ""))
+		opt(ps, "preshared_key", GetString(m, "preshared_key", ""))
+		if ep := GetString(m, "endpoint", ""); ep != "" {
+			h, port, err := net.SplitHostPort(ep)
+			if err != nil {
+				c.Invalid(Pointer("wireguard", "peers", i, "endpoint"), "endpoint must be host:port: %v", err)
+			} else {
+				checkPort(c, Pointer("wireguard", "peers", i, "endpoint"), port)
+			}
+			opt(ps, "endpoint_host", h)
+			opt(ps, "endpoint_port", port)
 		}
-		if ep := getString(m, "endpoint", ""); ep != "" {
-			h, port, _ := net.SplitHostPort(ep)
-			opt(&b, "endpoint_host", h)
-			opt(&b, "endpoint_port", port)
+		for j, ip := range StrList(m["allowed_ips"]) {
+			checkCIDR(c, Pointer("wireguard", "peers", i, "allowed_ips", j), ip)
+			lst(ps, "allowed_ips", ip)
 		}
-		ips, _ := asSlice(m["allowed_ips"])
-		for _, ip := range ips {
-			lst(&b, "allowed_ips", fmt.Sprint(ip))
+		if ka := GetInt(m, "keepalive", 0); ka > 0 {
+			opt(ps, "persistent_keepalive", strconv.Itoa(ka))
 		}
-		if ka := getInt(m, "keepalive", 0); ka > 0 {
-			opt(&b, "persistent_keepalive", strconv.Itoa(ka))
+		if err := c.Doc.Add("network", ps); err != nil {
+			return err
 		}
-		addLine(&b, "\n")
 	}
-	return &File{Name: "etc/config/network", Mode: 0644, Data: []byte(b.String())}
+	return nil
 }
 
 // ===== OpenVPN =====
-func renderOpenVPN(nj map[string]any) *File {
-	ov, _ := asMap(nj["openvpn"]) // { clients:[{ name, remote, port, proto, cipher, auth, config_file }] }
+func renderOpenVPN(v any, c *Context) error {
+	ov, _ := AsMap(v) // { clients:[{ name, remote, port, proto, cipher, auth, config_file }] }
 	if ov == nil {
 		return nil
 	}
-	var b strings.Builder
-	clients, _ := asSlice(ov["clients"])
-	for _, c := range clients {
-		m, _ := asMap(c)
-		name := getString(m, "name", "client")
-		addLine(&b, "config openvpn '%s'\n", q(name))
-		opt(&b, "enabled", "1")
-		opt(&b, "client", "1")
-		if host := getString(m, "remote", ""); host != "" {
-			port := getInt(m, "port", 1194)
-			opt(&b, "remote", fmt.Sprintf("%s %d", host, port))
+	c.Doc.Package("openvpn")
+	clients, _ := AsSlice(ov["clients"])
+	for i, cl := range clients {
+		m, _ := AsMap(cl)
+		s := &Section{Type: "openvpn", Name: GetString(m, "name", "client")}
+		opt(s, "enabled", "1")
+		opt(s, "client", "1")
+		if host := GetString(m, "remote", ""); host != "" {
+			port := GetInt(m, "port", 1194)
+			checkPort(c, Pointer("openvpn", "clients", i, "port"), strconv.Itoa(port))
+			opt(s, "remote", fmt.Sprintf("%s %d", host, port))
+		} else {
+			c.Invalid(Pointer("openvpn", "clients", i), "remote is required")
 		}
-		opt(&b, "proto", getString(m, "proto", "udp"))
-		opt(&b, "cipher", getString(m, "cipher", "AES-256-GCM"))
-		opt(&b, "auth", getString(m, "auth", "SHA256"))
-		if cf := getString(m, "config_file", ""); cf != "" {
-			opt(&b, "config", cf)
+		switch proto := GetString(m, "proto", "udp"); proto {
+		case "udp", "tcp", "udp4", "udp6", "tcp4", "tcp6", "tcp-client":
+		default:
+			c.Invalid(Pointer("openvpn", "clients", i, "proto"), "unknown proto %q", proto)
+		}
+		opt(s, "proto", GetString(m, "proto", "udp"))
+		opt(s, "cipher", GetString(m, "cipher", "AES-256-GCM"))
+		opt(s, "auth", GetString(m, "auth", "SHA256"))
+		opt(s, "config", GetString(m, "config_file", ""))
+		if err := c.Doc.Add("openvpn", s); err != nil {
+			return err
 		}
-		addLine(&b, "\n")
 	}
-	return &File{Name: "etc/config/openvpn", Mode: 0644, Data: []byte(b.String())}
+	return nil
 }
 
 // ===== ZeroTier =====
-func renderZeroTier(nj map[string]any) *File {
-	zt, _ := asMap(nj["zerotier"]) // { enabled: true, networks: ["<id>", ...] }
+var ztNetworkID = regexp.MustCompile(`^[0-9a-fA-F]{16}$`)
+
+func renderZeroTier(v any, c *Context) error {
+	zt, _ := AsMap(v) // { enabled: true, networks: ["<id>", ...] }
 	if zt == nil {
 		return nil
 	}
-	var b strings.Builder
-	addLine(&b, "config zerotier\n")
-	optBool(&b, "enabled", getBool(zt, "enabled", true))
-	nets, _ := asSlice(zt["networks"])
-	for _, n := range nets {
-		lst(&b, "join", fmt.Sprint(n))
+	s := &Section{Type: "zerotier"}
+	optBool(s, "enabled", GetBool(zt, "enabled", true))
+	for i, n := range StrList(zt["networks"]) {
+		if !ztNetworkID.MatchString(n) {
+			c.Invalid(Pointer("zerotier", "networks", i), "network id must be 16 hex digits, got %q", n)
+		}
+		lst(s, "join", n)
 	}
-	addLine(&b, "\n")
-	return &File{Name: "etc/config/zerotier", Mode: 0644, Data: []byte(b.String())}
+	return c.Doc.Add("zerotier", s)
 }
 
-// ===== small helpers =====
-func asMap(v any) (map[string]any, bool) { m, ok := v.(map[string]any); return m, ok }
-func asSlice(v any) ([]any, bool)        { s, ok := v.([]any); return s, ok }
+// ===== small helpers (общие для всех бэкендов: networkd, routeros) =====
+func AsMap(v any) (map[string]any, bool) { m, ok := v.(map[string]any); return m, ok }
+func AsSlice(v any) ([]any, bool)        { s, ok := v.([]any); return s, ok }
 
-func getString(m map[string]any, path ...string) string {
-	cur := any(m)
-	for _, p := range path {
-		obj, _ := cur.(map[string]any)
-		if obj == nil {
-			return ""
+// GetString — строка по ключу k или def, если ключа нет/пусто (числа приводятся к строке).
+func GetString(m map[string]any, k, def string) string {
+	if m == nil {
+		return def
+	}
+	switch v := m[k].(type) {
+	case string:
+		if v != "" {
+			return v
 		}
-		cur = obj[p]
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
 	}
-	s, _ := cur.(string)
-	return s
+	return def
 }
 
-func getBool(m map[string]any, k string, def bool) bool {
+// StrList — список строк из JSON-массива или одиночной строки.
+func StrList(v any) []string {
+	switch t := v.(type) {
+	case string:
+		if t == "" {
+			return nil
+		}
+		return []string{t}
+	case []string:
+		return t
+	case []any:
+		out := make([]string, 0, len(t))
+		for _, x := range t {
+			out = append(out, fmt.Sprint(x))
+		}
+		return out
+	}
+	return nil
+}
+
+func GetBool(m map[string]any, k string, def bool) bool {
 	if m == nil {
 		return def
 	}
@@ -365,7 +481,7 @@ func getBool(m map[string]any, k string, def bool) bool {
 	}
 	return def
 }
-func getInt(m map[string]any, k string, def int) int {
+func GetInt(m map[string]any, k string, def int) int {
 	if m == nil {
 		return def
 	}
@@ -383,19 +499,3 @@ func getInt(m map[string]any, k string, def int) int {
 	}
 	return def
 }
-
-// strAt — безопасно достаёт строку из вложенной map[string]any по пути ключей
-func strAt(m map[string]any, keys ...string) string {
-	cur := any(m)
-	for _, k := range keys {
-		obj, ok := cur.(map[string]any)
-		if !ok {
-			return ""
-		}
-		cur = obj[k]
-	}
-	if s, ok := cur.(string); ok {
-		return s
-	}
-	return ""
-}
@@ -0,0 +1,236 @@
+package uci
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Package — разобранный UCI-пакет (/etc/config/<name>).
+type Package struct {
+	Name     string
+	Sections []*Section
+}
+
+// Section — секция "config <type> ['<name>']". Name пустой у анонимных секций.
+type Section struct {
+	Type    string
+	Name    string
+	Options []*Option
+}
+
+// Option — "option" (одно значение) или "list" (List=true, значения по порядку).
+type Option struct {
+	Name   string
+	Values []string
+	List   bool
+}
+
+// Find возвращает секции заданного типа в порядке файла.
+func (p *Package) Find(typ string) []*Section {
+	var out []*Section
+	for _, s := range p.Sections {
+		if s.Type == typ {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Option ищет опцию/список по имени.
+func (s *Section) Option(name string) *Option {
+	for _, o := range s.Options {
+		if o.Name == name {
+			return o
+		}
+	}
+	return nil
+}
+
+// Get — значение option (для list — первый элемент), "" если нет.
+func (s *Section) Get(name string) string {
+	o := s.Option(name)
+	if o == nil || len(o.Values) == 0 {
+		return ""
+	}
+	return o.Values[0]
+}
+
+// Values — значения list; option с пробелами ("dns '1.1.1.1 8.8.8.8'") режется на слова, как это делает OpenWrt.
+func (s *Section) Values(name string) []string {
+	o := s.Option(name)
+	if o == nil {
+		return nil
+	}
+	if o.List {
+		return o.Values
+	}
+	if len(o.Values) == 0 {
+		return nil
+	}
+	return strings.Fields(o.Values[0])
+}
+
+// Parse разбирает UCI-файл. name — имя пакета по умолчанию (обычно базовое имя файла),
+// директива "package" внутри файла его переопределяет.
+func Parse(name string, r io.Reader) (*Package, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	stmts, err := splitStatements(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("uci: %s: %w", name, err)
+	}
+
+	pkg := &Package{Name: name}
+	var cur *Section
+	for _, st := range stmts {
+		w := st.words
+		switch w[0] {
+		case "package":
+			if len(w) != 2 {
+				return nil, fmt.Errorf("uci: %s:%d: package expects 1 argument", name, st.line)
+			}
+			pkg.Name = w[1]
+		case "config":
+			if len(w) < 2 || len(w) > 3 {
+				return nil, fmt.Errorf("uci: %s:%d: config expects type and optional name", name, st.line)
+			}
+			cur = &Section{Type: w[1]}
+			if len(w) == 3 {
+				cur.Name = w[2]
+			}
+			pkg.Sections = append(pkg.Sections, cur)
+		case "option", "list":
+			if cur == nil {
+				return nil, fmt.Errorf("uci: %s:%d: %s outside of config section", name, st.line, w[0])
+			}
+			if len(w) < 2 || len(w) > 3 {
+				return nil, fmt.Errorf("uci: %s:%d: %s expects name and value", name, st.line, w[0])
+			}
+			val := ""
+			if len(w) == 3 {
+				val = w[2]
+			}
+			if w[0] == "option" {
+				cur.Set(w[1], val)
+			} else {
+				cur.Append(w[1], val)
+			}
+		default:
+			return nil, fmt.Errorf("uci: %s:%d: unknown keyword %q", name, st.line, w[0])
+		}
+	}
+	if pkg.Name == "" {
+		return nil, fmt.Errorf("uci: package name is empty")
+	}
+	return pkg, nil
+}
+
+type statement struct {
+	line  int
+	words []string
+}
+
+// splitStatements режет текст на строки-инструкции с учётом шелл-подобных правил uci:
+// '...' без экранирования, "..." и вне кавычек — экранирование через '\', склейка
+// соседних фрагментов (it's → 'it'"'"'s'), комментарии с '#', перенос строки через '\'.
+func splitStatements(src string) ([]statement, error) {
+	var (
+		out    []statement
+		words  []string
+		cur    strings.Builder
+		inWord bool
+		quote  rune
+		line   = 1
+		start  = 1
+	)
+	endWord := func() {
+		if inWord {
+			words = append(words, cur.String())
+			cur.Reset()
+			inWord = false
+		}
+	}
+	endStmt := func() {
+		endWord()
+		if len(words) > 0 {
+			out = append(out, statement{line: start, words: words})
+		}
+		words = nil
+	}
+
+	rs := []rune(src)
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		if c == '\n' {
+			line++
+		}
+		if len(words) == 0 && !inWord {
+			start = line
+		}
+		switch quote {
+		case '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+			continue
+		case '"':
+			switch c {
+			case '"':
+				quote = 0
+			case '\\':
+				if i+1 < len(rs) {
+					i++
+					if rs[i] == '\n' {
+						line++
+					}
+					cur.WriteRune(rs[i])
+				}
+			default:
+				cur.WriteRune(c)
+			}
+			continue
+		}
+
+		switch c {
+		case '\n':
+			endStmt()
+		case ' ', '\t', '\r':
+			endWord()
+		case '#':
+			if inWord {
+				cur.WriteRune(c)
+				continue
+			}
+			for i+1 < len(rs) && rs[i+1] != '\n' {
+				i++
+			}
+		case '\\':
+			if i+1 < len(rs) {
+				i++
+				if rs[i] == '\n' { // продолжение строки
+					line++
+					endWord()
+					continue
+				}
+				cur.WriteRune(rs[i])
+				inWord = true
+			}
+		case '\'', '"':
+			quote = c
+			inWord = true
+		default:
+			cur.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("line %d: unterminated %c quote", line, quote)
+	}
+	endStmt()
+	return out, nil
+}
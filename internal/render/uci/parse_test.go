@@ -0,0 +1,489 @@
+package uci
+
+import (
+	"bytes"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseQuoting(t *testing.T) {
+	cases := []struct {
+		src, want string
+	}{
+		{`option v plain`, "plain"},
+		{`option v 'single quoted'`, "single quoted"},
+		{`option v "double quoted"`, "double quoted"},
+		{`option v 'no \escape in single'`, `no \escape in single`},
+		{`option v "esc \"quote\" and \\ slash"`, `esc "quote" and \ slash`},
+		{`option v 'it'\''s'`, "it's"},
+		{`option v 'it'"'"'s'`, "it's"},
+		{`option v un\ quoted`, "un quoted"},
+		{`option v 'a'b"c"`, "abc"},
+		{`option v ''`, ""},
+		{`option v '#not a comment' # comment`, "#not a comment"},
+		{"option v 'multi\nline'", "multi\nline"},
+		{"option v \\\n  continued", "continued"},
+	}
+	for _, c := range cases {
+		p, err := Parse("test", strings.NewReader("config x\n\t"+c.src+"\n"))
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if got := p.Sections[0].Get("v"); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestParseStructure(t *testing.T) {
+	src := `
+# comment
+package 'network'
+
+config interface 'lan'
+	option proto static
+	list dns '1.1.1.1'
+	list dns '8.8.8.8'
+	option proto 'dhcp' # повтор option перезаписывает
+
+config route
+	option target '10.0.0.0/8'
+`
+	p, err := Parse("file", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Package{Name: "network", Sections: []*Section{
+		{Type: "interface", Name: "lan", Options: []*Option{
+			{Name: "proto", Values: []string{"dhcp"}},
+			{Name: "dns", Values: []string{"1.1.1.1", "8.8.8.8"}, List: true},
+		}},
+		{Type: "route", Options: []*Option{{Name: "target", Values: []string{"10.0.0.0/8"}}}},
+	}}
+	if !reflect.DeepEqual(p, want) {
+		t.Fatalf("got %s, want %s", p.Bytes(), want.Bytes())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		"option proto static\n",        // вне секции
+		"config\n",                     // без типа
+		"config a b c\n",               // лишний аргумент
+		"config a\n\toption\n",         // без имени
+		"config a\n\tfoo bar\n",        // неизвестное слово
+		"config a\n\toption v 'open\n", // незакрытая кавычка
+		"package\n",
+	} {
+		if _, err := Parse("test", strings.NewReader(src)); err == nil {
+			t.Errorf("%q: no error", src)
+		}
+	}
+}
+
+// Bytes → Parse возвращает тот же пакет для любых значений, включая кавычки и спецсимволы.
+func TestBytesRoundTrip(t *testing.T) {
+	values := []string{"", "plain", "it's", `"double"`, `back\slash`, "$HOME `cmd`", "# hash", "tab\tand\nnewline", "'''"}
+	s := &Section{Type: "wifi-iface", Name: "it's"}
+	for _, v := range values {
+		s.Append("list", v)
+	}
+	s.Set("opt", values[3]+values[1])
+	want := &Package{Name: "wireless", Sections: []*Section{s, {Type: "anon"}}}
+	got, err := Parse("wireless", bytes.NewReader(want.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("round trip:\n%s\nwant:\n%s", got.Bytes(), want.Bytes())
+	}
+}
+
+// roundTripConfigs — по пакету на каждую секцию, которую переносит Import.
+var roundTripConfigs = map[string]string{
+	"system": `
+config system
+	option hostname 'edge-1'
+	option zonename 'Europe/Berlin'
+	option log_ip '10.0.0.5'
+	option log_port '514'
+config timeserver 'ntp'
+	option enabled '1'
+	list server '0.openwrt.pool.ntp.org'
+	list server '1.openwrt.pool.ntp.org'
+config led
+	option name 'wan'
+	option sysfs 'green:wan'
+	option trigger 'netdev'
+	option dev 'eth1'
+	option mode 'link tx rx'
+`,
+	"network": `
+config device
+	option name 'br-lan'
+	option type 'bridge'
+	list ports 'lan1'
+	list ports 'lan2'
+config bridge-vlan
+	option device 'br-lan'
+	option vlan '10'
+	list ports 'lan1:u*'
+	list ports 'lan2:t'
+config interface 'lan'
+	option device 'br-lan'
+	option proto 'static'
+	option ipaddr '192.168.1.1'
+	option netmask '255.255.255.0'
+	list dns '1.1.1.1'
+config interface 'wan'
+	option device 'eth1'
+	option proto 'dhcp'
+config route
+	option interface 'lan'
+	option target '10.10.0.0'
+	option netmask '255.255.0.0'
+	option gateway '192.168.1.254'
+config interface 'wg0'
+	option proto 'wireguard'
+	option private_key 'yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk='
+	list addresses '10.8.0.2/24'
+config wireguard_wg0
+	option public_key 'xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg='
+	option endpoint_host 'vpn.example.com'
+	option endpoint_port '51820'
+	list allowed_ips '10.8.0.0/24'
+	option persistent_keepalive '25'
+`,
+	"wireless": `
+config wifi-device 'radio0'
+	option type 'mac80211'
+	option band '2g'
+	option channel '6'
+	option htmode 'HE20'
+	option country 'DE'
+config wifi-iface 'default_radio0'
+	option device 'radio0'
+	option mode 'ap'
+	option network 'lan'
+	option ssid 'it'"'"'s "home" \ net'
+	option encryption 'psk2'
+	option key 'pa$$ w0rd'
+`,
+	"dhcp": `
+config dnsmasq
+	option domainneeded '1'
+	option domain 'lan'
+	option local '/lan/'
+config dhcp 'lan'
+	option interface 'lan'
+	option start '100'
+	option limit '150'
+	option leasetime '12h'
+	list dhcp_option '6,192.168.1.1'
+config host
+	option name 'printer'
+	option mac '00:11:22:33:44:55'
+	option ip '192.168.1.20'
+`,
+	"firewall": `
+config zone
+	option name 'lan'
+	option input 'ACCEPT'
+	option output 'ACCEPT'
+	option forward 'ACCEPT'
+	list network 'lan'
+config zone
+	option name 'wan'
+	option input 'REJECT'
+	option output 'ACCEPT'
+	option forward 'REJECT'
+	option masq '1'
+	option mtu_fix '1'
+	list network 'wan'
+config forwarding
+	option src 'lan'
+	option dest 'wan'
+config rule
+	option name 'Allow-SSH'
+	option src 'wan'
+	option proto 'tcp'
+	option dest_port '22'
+	list src_ip '203.0.113.0/24'
+	list src_ip '198.51.100.7'
+	option target 'ACCEPT'
+config redirect
+	option name 'web'
+	option src 'wan'
+	option src_dport '8080'
+	option dest 'lan'
+	option dest_ip '192.168.1.10'
+	option dest_port '80'
+	option target 'DNAT'
+`,
+	"openvpn": `
+config openvpn 'office'
+	option client '1'
+	option remote 'vpn.example.com 1194'
+	option proto 'udp'
+	option cipher 'AES-256-GCM'
+`,
+}
+
+// parse → Import → RenderAll → parse → Import: ничего из исходного пакета не теряется
+// (рендер может добавить умолчания), а второй круг уже ничего не меняет.
+func TestImportRoundTrip(t *testing.T) {
+	for name, src := range roundTripConfigs {
+		p, err := Parse(name, strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		first, err := Import([]*Package{p})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		second := renderImport(t, name, first)
+		if !containsJSON(second, first) {
+			t.Errorf("%s: lost on round trip:\nimported %v\nrendered back %v", name, first, second)
+		}
+		if third := renderImport(t, name, second); !reflect.DeepEqual(third, second) {
+			t.Errorf("%s: second round trip changed:\n%v\n%v", name, second, third)
+		}
+	}
+}
+
+func renderImport(t *testing.T, name string, nj map[string]any) map[string]any {
+	t.Helper()
+	files, err := RenderAll(nj, Options{})
+	if err != nil {
+		t.Fatalf("%s: RenderAll: %v", name, err)
+	}
+	var pkgs []*Package
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name, "etc/config/") {
+			continue
+		}
+		p, err := Parse(path.Base(f.Name), bytes.NewReader(f.Data))
+		if err != nil {
+			t.Fatalf("%s: parse rendered %s: %v\n%s", name, f.Name, err, f.Data)
+		}
+		pkgs = append(pkgs, p)
+	}
+	out, err := Import(pkgs)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if name != "system" {
+		delete(out, "system") // RenderAll всегда пишет hostname
+	}
+	return out
+}
+
+// containsJSON — все значения want есть в got (в объектах got могут быть лишние ключи).
+func containsJSON(got, want any) bool {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k, v := range w {
+			if !containsJSON(g[k], v) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		g, ok := got.([]any)
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !containsJSON(g[i], w[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+// legacyConfigs — конфиги до 21.02 (ifname, type bridge, list ipaddr) и секции вне схем Import.
+var legacyConfigs = map[string]string{
+	"system": `
+config system
+	option hostname 'legacy'
+	option ttylogin '0'
+	option urandom_seed '0'
+
+config button
+	option button 'reset'
+	option action 'released'
+	option handler 'logger reset'
+`,
+	"network": `
+config interface 'loopback'
+	option ifname 'lo'
+	option proto 'static'
+	option ipaddr '127.0.0.1'
+	option netmask '255.0.0.0'
+
+config globals 'globals'
+	option ula_prefix 'fd12:3456:789a::/48'
+
+config interface 'lan'
+	option type 'bridge'
+	option ifname 'eth0.1 eth1'
+	option proto 'static'
+	list ipaddr '192.168.1.1/24'
+	list ipaddr '10.0.0.1/24'
+	option ip6assign '60'
+
+config interface 'wan'
+	option ifname 'eth0.2'
+	option proto 'dhcp'
+	option metric '10'
+
+config switch
+	option name 'switch0'
+	option reset '1'
+	option enable_vlan '1'
+
+config switch_vlan
+	option device 'switch0'
+	option vlan '1'
+	option ports '1 2 3 4 0t'
+`,
+	"firewall": `
+config defaults
+	option syn_flood '1'
+	option input 'ACCEPT'
+	option output 'ACCEPT'
+	option forward 'REJECT'
+
+config zone
+	option name 'lan'
+	list network 'lan'
+	option input 'ACCEPT'
+	option output 'ACCEPT'
+	option forward 'ACCEPT'
+`,
+	"uhttpd": `
+config uhttpd 'main'
+	list listen_http '0.0.0.0:80'
+	option home '/www'
+`,
+}
+
+// Import → RenderAll на legacy-конфиге: каждая исходная опция оказывается в той же секции
+// (ifname и type у interface переходят в device и config device), следующий круг ничего не меняет.
+func TestImportLegacy(t *testing.T) {
+	var names []string
+	for name := range legacyConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pkgs []*Package
+	for _, name := range names {
+		p, err := Parse(name, strings.NewReader(legacyConfigs[name]))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		pkgs = append(pkgs, p)
+	}
+	first, err := Import(pkgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := renderPackages(t, first)
+
+	for _, p := range pkgs {
+		r := got[p.Name]
+		if r == nil {
+			t.Errorf("package %s lost", p.Name)
+			continue
+		}
+		idx := map[string]int{}
+		for _, s := range p.Sections {
+			n := idx[s.Type]
+			idx[s.Type]++
+			var rs *Section
+			if s.Name != "" {
+				rs = r.Section(s.Name)
+			} else if secs := r.Find(s.Type); n < len(secs) {
+				rs = secs[n]
+			}
+			if rs == nil {
+				t.Errorf("%s: %s[%d] %q lost", p.Name, s.Type, n, s.Name)
+				continue
+			}
+			for _, o := range s.Options {
+				if s.Type == "interface" && (o.Name == "ifname" || o.Name == "type") {
+					continue
+				}
+				if want, g := s.Values(o.Name), rs.Values(o.Name); !reflect.DeepEqual(want, g) {
+					t.Errorf("%s: %s[%d] %q: option %s = %q, want %q", p.Name, s.Type, n, s.Name, o.Name, g, want)
+				}
+			}
+		}
+	}
+
+	netw := got["network"]
+	for iface, dev := range map[string]string{"loopback": "lo", "lan": "br-lan", "wan": "eth0.2"} {
+		if s := netw.Section(iface); s == nil || s.Get("device") != dev {
+			t.Errorf("interface %s: want device %s", iface, dev)
+		}
+	}
+	var br *Section
+	for _, d := range netw.Find("device") {
+		if d.Get("name") == "br-lan" {
+			br = d
+		}
+	}
+	if br == nil || br.Get("type") != "bridge" || !reflect.DeepEqual(br.Values("ports"), []string{"eth0.1", "eth1"}) {
+		t.Errorf("legacy bridge lan: want config device br-lan with ports eth0.1 eth1, got %+v", br)
+	}
+
+	// passthrough-секции после рендера идут после типизированных — порядок устанавливается со второго круга
+	second := reimport(t, names, got)
+	if third := reimport(t, names, renderPackages(t, second)); !reflect.DeepEqual(third, second) {
+		t.Errorf("second round trip changed:\n%v\n%v", second, third)
+	}
+}
+
+func reimport(t *testing.T, names []string, pkgs map[string]*Package) map[string]any {
+	t.Helper()
+	var in []*Package
+	for _, name := range names {
+		in = append(in, pkgs[name])
+	}
+	nj, err := Import(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nj
+}
+
+// renderPackages — RenderAll и разбор его etc/config/* обратно по имени пакета.
+func renderPackages(t *testing.T, nj map[string]any) map[string]*Package {
+	t.Helper()
+	files, err := RenderAll(nj, Options{Strict: true})
+	if err != nil {
+		t.Fatalf("RenderAll: %v", err)
+	}
+	out := map[string]*Package{}
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name, "etc/config/") {
+			continue
+		}
+		p, err := Parse(path.Base(f.Name), bytes.NewReader(f.Data))
+		if err != nil {
+			t.Fatalf("parse rendered %s: %v\n%s", f.Name, err, f.Data)
+		}
+		out[p.Name] = p
+	}
+	return out
+}
@@ -0,0 +1,151 @@
+package uci
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PassthroughKey — блок NetJSON с «сырыми» UCI-секциями (аналог custom packages в netjsonconfig):
+//
+//	"uci": [
+//	  {"name": "uhttpd", "sections": [
+//	    {"type": "uhttpd", "name": "main",
+//	     "options": {"redirect_https": true, "max_requests": 3},
+//	     "lists": {"listen_https": ["0.0.0.0:443", "[::]:443"]}}
+//	  ]}
+//	]
+//
+// Блок рендерится после всех типизированных рендереров: именованная секция, которую
+// уже создал рендерер, дополняется (options перезаписываются, lists заменяются),
+// анонимные и новые секции добавляются в конец пакета. Имя "@type[n]" (как в uci, n с нуля,
+// -1 — последняя) адресует уже созданную анонимную секцию, например "@system[0]".
+const PassthroughKey = "uci"
+
+func renderPassthrough(v any, c *Context) error {
+	if v == nil {
+		return nil
+	}
+	pkgs, ok := AsSlice(v)
+	if !ok {
+		return fmt.Errorf("%s: expected array of packages", PassthroughKey)
+	}
+	for i, p := range pkgs {
+		pm, _ := AsMap(p)
+		pkg := GetString(pm, "name", "")
+		if pkg == "" {
+			return fmt.Errorf("%s[%d]: package name is required", PassthroughKey, i)
+		}
+		c.Doc.Package(pkg)
+		secs, _ := AsSlice(pm["sections"])
+		for j, x := range secs {
+			sm, _ := AsMap(x)
+			if err := mergePassthroughSection(c.Doc, pkg, sm); err != nil {
+				return fmt.Errorf("%s[%d].sections[%d]: %w", PassthroughKey, i, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+func mergePassthroughSection(doc *Document, pkg string, sm map[string]any) error {
+	typ := GetString(sm, "type", "")
+	name := GetString(sm, "name", "")
+
+	if strings.HasPrefix(name, "@") {
+		s, err := anonymousSection(doc.Package(pkg), name)
+		if err != nil {
+			return err
+		}
+		if typ != "" && typ != s.Type {
+			return fmt.Errorf("section %s is %s, not %s", name, s.Type, typ)
+		}
+		return mergeOptions(s, sm)
+	}
+	s := doc.Package(pkg).Section(name)
+	switch {
+	case name == "" || s == nil:
+		if typ == "" {
+			return fmt.Errorf("section type is required")
+		}
+		s = &Section{Type: typ, Name: name}
+		if err := doc.Add(pkg, s); err != nil {
+			return err
+		}
+	case typ != "" && typ != s.Type:
+		return fmt.Errorf("section %q already exists with type %s, not %s", name, s.Type, typ)
+	}
+	return mergeOptions(s, sm)
+}
+
+func mergeOptions(s *Section, sm map[string]any) error {
+	opts, _ := AsMap(sm["options"])
+	for _, k := range sortedKeys(opts) {
+		s.Set(k, uciValue(opts[k]))
+	}
+	lists, _ := AsMap(sm["lists"])
+	for _, k := range sortedKeys(lists) {
+		vals, ok := AsSlice(lists[k])
+		if !ok {
+			return fmt.Errorf("list %q: expected array", k)
+		}
+		if o := s.Option(k); o != nil {
+			o.Values, o.List = nil, true
+		}
+		for _, x := range vals {
+			s.Append(k, uciValue(x))
+		}
+	}
+	return nil
+}
+
+var anonymousRe = regexp.MustCompile(`^@([^\[\]]+)\[(-?\d+)\]$`)
+
+// anonymousSection — секция по ссылке "@type[n]".
+func anonymousSection(p *Package, ref string) (*Section, error) {
+	m := anonymousRe.FindStringSubmatch(ref)
+	if m == nil {
+		return nil, fmt.Errorf("bad section reference %q (want @type[n])", ref)
+	}
+	n, _ := strconv.Atoi(m[2])
+	secs := p.Find(m[1])
+	if n < 0 {
+		n += len(secs)
+	}
+	if n < 0 || n >= len(secs) {
+		return nil, fmt.Errorf("no section %s in %s", ref, p.Name)
+	}
+	return secs[n], nil
+}
+
+// uciValue приводит JSON-скаляр к строке UCI (bool → "1"/"0", числа без экспоненты).
+func uciValue(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case bool:
+		if t {
+			return "1"
+		}
+		return "0"
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(t)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
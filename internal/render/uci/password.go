@@ -0,0 +1,182 @@
+package uci
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Пароль root: system.root_password_hash (готовый crypt-хеш) или system.root_password
+// (открытый текст, обычно "{{.root_password}}" из переменных устройства) — тогда контроллер
+// сам считает SHA-512 crypt ($6$). Соль детерминирована от устройства, чтобы повторный
+// reconcile давал тот же архив (и тот же checksum).
+//
+// /etc/shadow не UCI — хеш доставляется идемпотентным скриптом rootPasswordScript, который
+// правит строку root. uci-defaults выполняются один раз, поэтому на каждом применении
+// конфигурации его запускает агент: в доставляемый /etc/config/openwisp рендерится
+// option post_reload_hook секции controller 'http' (openwisp-config сливает пакет с локальным
+// по секциям, url/uuid/key агента не трогаются; пакет openwisp агент перечитывает при изменении).
+// Обёртка в uci-defaults — для первой загрузки после sysupgrade, пока агент ещё не применил
+// конфигурацию с хуком.
+
+const (
+	rootPasswordScript  = "etc/wisp/root-password"
+	rootPasswordDefault = "etc/uci-defaults/99-wisp-root-password"
+	agentSection        = "http" // секция controller агента openwisp-config
+)
+
+var cryptHash = regexp.MustCompile(`^\$(1|5|6|y)\$[./0-9A-Za-z$=,]+$`)
+
+// renderRootPassword добавляет файлы пароля root и хук агента, который запускает скрипт
+// на каждом применении конфигурации.
+func renderRootPassword(sys map[string]any, c *Context) error {
+	files, err := rootPasswordFiles(sys, c)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	for _, f := range files {
+		c.Doc.AddFile(f)
+	}
+	s := &Section{Type: "controller", Name: agentSection}
+	opt(s, "post_reload_hook", "/"+rootPasswordScript)
+	return c.Doc.Add("openwisp", s)
+}
+
+// rootPasswordFiles — скрипт пароля и его обёртка в uci-defaults (nil, если пароль не задан).
+// Неразрешённая переменная в root_password — ошибка строгой подстановки vars ещё до рендера.
+func rootPasswordFiles(sys map[string]any, c *Context) ([]File, error) {
+	hash := GetString(sys, "root_password_hash", "")
+	if pw, ok := sys["root_password"]; ok && hash == "" {
+		s, _ := pw.(string)
+		if s == "" {
+			return nil, fmt.Errorf("root_password: empty")
+		}
+		hash = sha512Crypt(s, deviceSalt(c.Opts))
+	}
+	if hash == "" {
+		return nil, nil
+	}
+	if !cryptHash.MatchString(hash) {
+		return nil, fmt.Errorf("root_password_hash: not a crypt hash")
+	}
+	script := "#!/bin/sh\n" +
+		"# wisp: пароль root\n" +
+		"hash='" + hash + "'\n" +
+		"sed -i \"s|^root:[^:]*:|root:${hash}:|\" /etc/shadow\n" +
+		"exit 0\n"
+	wrapper := "#!/bin/sh\n" +
+		"/" + rootPasswordScript + "\n" +
+		"exit 0\n"
+	return []File{
+		{Name: rootPasswordScript, Data: []byte(script), Mode: 0755},
+		{Name: rootPasswordDefault, Data: []byte(wrapper), Mode: 0755},
+	}, nil
+}
+
+// deviceSalt — 16 символов crypt-алфавита из UUID (или hostname) устройства.
+func deviceSalt(o Options) string {
+	id := o.DeviceUUID
+	if id == "" {
+		id = o.DeviceHostname
+	}
+	sum := sha256.Sum256([]byte("wisp-root-salt:" + id))
+	var b strings.Builder
+	for i := 0; i < 16; i++ {
+		b.WriteByte(cryptAlphabet[sum[i]&0x3f])
+	}
+	return b.String()
+}
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// sha512Crypt — SHA-512 crypt (Drepper), 5000 раундов по умолчанию: "$6$<salt>$<hash>".
+func sha512Crypt(password, salt string) string {
+	pw, sl := []byte(password), []byte(salt)
+	if len(sl) > 16 {
+		sl = sl[:16]
+	}
+
+	b := sha512.New()
+	b.Write(pw)
+	b.Write(sl)
+	b.Write(pw)
+	db := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(pw)
+	a.Write(sl)
+	for n := len(pw); n > 0; n -= 64 {
+		a.Write(db[:min(n, 64)])
+	}
+	for n := len(pw); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(db)
+		} else {
+			a.Write(pw)
+		}
+	}
+	da := a.Sum(nil)
+
+	h := sha512.New()
+	for range pw {
+		h.Write(pw)
+	}
+	p := repeatTo(h.Sum(nil), len(pw))
+
+	h = sha512.New()
+	for i := 0; i < 16+int(da[0]); i++ {
+		h.Write(sl)
+	}
+	s := repeatTo(h.Sum(nil), len(sl))
+
+	cur := da
+	for i := 0; i < 5000; i++ {
+		h = sha512.New()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(cur)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(cur)
+		} else {
+			h.Write(p)
+		}
+		cur = h.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString("$6$" + string(sl) + "$")
+	enc := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for ; n > 0; n-- {
+			out.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	for _, t := range [][3]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4}, {47, 5, 26}, {6, 27, 48},
+		{28, 49, 7}, {50, 8, 29}, {9, 30, 51}, {31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13},
+		{56, 14, 35}, {15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19}, {62, 20, 41},
+	} {
+		enc(cur[t[0]], cur[t[1]], cur[t[2]], 4)
+	}
+	enc(0, 0, cur[63], 2)
+	return out.String()
+}
+
+func repeatTo(src []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, src[:min(len(src), n-len(out))]...)
+	}
+	return out
+}
@@ -0,0 +1,68 @@
+package uci
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSHA512Crypt(t *testing.T) {
+	// вектор из спецификации Drepper (5000 раундов)
+	const want = "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"
+	if got := sha512Crypt("Hello world!", "saltstring"); got != want {
+		t.Fatalf("sha512Crypt = %s, want %s", got, want)
+	}
+}
+
+// Пароль применяется на каждом применении конфигурации: скрипт + хук агента в /etc/config/openwisp,
+// а не только uci-defaults (он выполняется один раз).
+func TestRootPasswordHook(t *testing.T) {
+	files, err := RenderAll(map[string]any{"system": map[string]any{"root_password": "secret"}},
+		Options{DeviceUUID: "0b5c1f7e-8d2a-4c5e-9f00-000000000001", Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]File{}
+	for _, f := range files {
+		byName[f.Name] = f
+	}
+
+	script, ok := byName[rootPasswordScript]
+	if !ok || script.Mode != 0755 {
+		t.Fatalf("no executable %s in %v", rootPasswordScript, files)
+	}
+	hash := sha512Crypt("secret", deviceSalt(Options{DeviceUUID: "0b5c1f7e-8d2a-4c5e-9f00-000000000001"}))
+	if !strings.Contains(string(script.Data), "hash='"+hash+"'") {
+		t.Errorf("script does not set the hash:\n%s", script.Data)
+	}
+	if w, ok := byName[rootPasswordDefault]; !ok || !strings.Contains(string(w.Data), "/"+rootPasswordScript) {
+		t.Errorf("uci-defaults wrapper missing or does not run the script")
+	}
+
+	agent, ok := byName["etc/config/openwisp"]
+	if !ok {
+		t.Fatal("no etc/config/openwisp")
+	}
+	p, err := Parse(agent.Name, strings.NewReader(string(agent.Data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := p.Section("http")
+	if s == nil || s.Type != "controller" || s.Get("post_reload_hook") != "/etc/wisp/root-password" {
+		t.Fatalf("agent hook not rendered:\n%s", agent.Data)
+	}
+	if len(s.Options) != 1 {
+		t.Errorf("agent section must carry only the hook (the rest is merged from the device):\n%s", agent.Data)
+	}
+}
+
+func TestRootPasswordNone(t *testing.T) {
+	files, err := RenderAll(map[string]any{"system": map[string]any{"hostname": "r1"}}, Options{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if f.Name == "etc/config/openwisp" || f.Name == rootPasswordScript {
+			t.Errorf("unexpected %s without a root password", f.Name)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package uci
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Context — состояние одного прогона RenderAll, общее для всех рендереров.
+type Context struct {
+	NetJSON map[string]any
+	Opts    Options
+	Doc     *Document
+
+	Collector // строгий режим: накопленные ошибки (см. Invalid)
+
+	swVLANs map[string]map[int]string // мост swconfig → vid → мост VLAN (см. bridgeDevice)
+}
+
+// Renderer — рендерер одного верхнеуровневого ключа NetJSON в UCI-секции.
+// Render вызывается всегда (v == nil, если ключа нет) — так system может взять hostname из Options.
+type Renderer struct {
+	Key    string   // ключ NetJSON, который рендерер забирает: "network", "sqm", "uhttpd", ...
+	Claims []string // доп. верхнеуровневые ключи, которые рендерер читает сам из Context.NetJSON
+	Render func(v any, c *Context) error
+}
+
+// metaKeys — служебные ключи NetJSON, которые не рендерятся в UCI.
+var metaKeys = map[string]bool{"type": true}
+
+var registry struct {
+	mu   sync.RWMutex
+	list []Renderer
+}
+
+// Register добавляет рендерер; порядок вызова = порядок регистрации.
+// Пакеты вроде uhttpd/sqm/mwan3/dropbear/luci подключаются так же, как встроенные:
+//
+//	func init() { uci.MustRegister(uci.Renderer{Key: "sqm", Render: renderSQM}) }
+func Register(r Renderer) error {
+	if r.Key == "" || r.Render == nil {
+		return fmt.Errorf("uci: renderer must have key and render func")
+	}
+	if r.Key == PassthroughKey || metaKeys[r.Key] {
+		return fmt.Errorf("uci: key %q is reserved", r.Key)
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, x := range registry.list {
+		if x.Key == r.Key {
+			return fmt.Errorf("uci: renderer for %q already registered", r.Key)
+		}
+	}
+	registry.list = append(registry.list, r)
+	return nil
+}
+
+func MustRegister(r Renderer) {
+	if err := Register(r); err != nil {
+		panic(err)
+	}
+}
+
+// Renderers — снимок зарегистрированных рендереров в порядке вызова.
+func Renderers() []Renderer {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return append([]Renderer(nil), registry.list...)
+}
+
+// UnclaimedKeysError — в NetJSON есть ключи, которые не забрал ни один рендерер.
+// RenderAll возвращает её вместе с файлами: остальной конфиг отрендерен, решать вызывающему.
+type UnclaimedKeysError struct {
+	Keys []string
+}
+
+func (e *UnclaimedKeysError) Error() string {
+	return "uci: no renderer for NetJSON keys: " + strings.Join(e.Keys, ", ")
+}
+
+func unclaimedKeys(nj map[string]any, rs []Renderer) []string {
+	claimed := map[string]bool{PassthroughKey: true}
+	for _, r := range rs {
+		claimed[r.Key] = true
+		for _, k := range r.Claims {
+			claimed[k] = true
+		}
+	}
+	var out []string
+	for k := range nj {
+		if !claimed[k] && !metaKeys[k] {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// встроенные рендереры — в историческом порядке
+func init() {
+	MustRegister(Renderer{Key: "system", Render: renderSystem})
+	// interfaces/dns_servers/dns_search/routes/ip_rules — верхнеуровневая схема netjsonconfig
+	MustRegister(Renderer{Key: "network", Claims: []string{"interfaces", "dns_servers", "dns_search", "routes", "ip_rules"}, Render: renderNetwork})
+	MustRegister(Renderer{Key: "wireless", Render: renderWireless})
+	MustRegister(Renderer{Key: "dhcp", Render: renderDHCP})
+	MustRegister(Renderer{Key: "firewall", Render: renderFirewall})
+	// VPN/overlay
+	MustRegister(Renderer{Key: "wireguard", Render: renderWireGuard})
+	MustRegister(Renderer{Key: "openvpn", Render: renderOpenVPN})
+	MustRegister(Renderer{Key: "zerotier", Render: renderZeroTier})
+	// mwan3 ссылается на интерфейсы network (в т.ч. wireguard) — после них
+	MustRegister(Renderer{Key: "mwan3", Render: renderMWAN3})
+	// не-UCI файлы в архиве
+	MustRegister(Renderer{Key: FilesKey, Render: renderFiles})
+}
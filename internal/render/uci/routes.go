@@ -0,0 +1,155 @@
+package uci
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Маршруты и правила policy routing (схема netjsonconfig, на верхнем уровне или в network):
+//
+//	"routes":   [{"device": "wan", "destination": "10.20.0.0/16", "next": "192.0.2.1", "cost": 10, "table": "100"},
+//	             {"device": "wan6", "destination": "2001:db8:100::/48", "next": "2001:db8::1"}],
+//	"ip_rules": [{"src": "192.168.20.0/24", "lookup": "100", "priority": 1000},
+//	             {"in": "guest", "action": "prohibit", "family": "ipv6"}]
+//
+// Семейство определяется по адресам: IPv4 → config route/rule, IPv6 → config route6/rule6.
+// device — логический интерфейс UCI (как option interface), а не netdev.
+
+func renderRoutes(netw map[string]any, c *Context) error {
+	addRoute := func(m map[string]any, p []any) error {
+		s, err := routeSection(m)
+		if err != nil {
+			return At(err, p...)
+		}
+		return c.Doc.Add("network", s)
+	}
+	addRule := func(m map[string]any, p []any) error {
+		s, err := ipRuleSection(m)
+		if err != nil {
+			return At(err, p...)
+		}
+		return c.Doc.Add("network", s)
+	}
+	if err := EachItem(netw["routes"], []any{"network", "routes"}, addRoute); err != nil {
+		return err
+	}
+	if err := EachItem(c.NetJSON["routes"], []any{"routes"}, addRoute); err != nil {
+		return err
+	}
+	if err := EachItem(netw["ip_rules"], []any{"network", "ip_rules"}, addRule); err != nil {
+		return err
+	}
+	return EachItem(c.NetJSON["ip_rules"], []any{"ip_rules"}, addRule)
+}
+
+func routeSection(m map[string]any) (*Section, error) {
+	iface := GetString(m, "interface", GetString(m, "device", ""))
+	dest := GetString(m, "destination", "")
+	if iface == "" || dest == "" {
+		return nil, fmt.Errorf("device and destination are required")
+	}
+	ip, ipnet, err := net.ParseCIDR(dest)
+	if err != nil {
+		if ip = net.ParseIP(dest); ip == nil {
+			return nil, fmt.Errorf("bad destination %q", dest)
+		}
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		ipnet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	family := AddrFamily(ipnet.IP.String())
+
+	s := &Section{Type: "route"}
+	if family == "ipv6" {
+		s.Type = "route6"
+	}
+	opt(s, "interface", iface)
+	if family == "ipv4" {
+		opt(s, "target", ipnet.IP.String())
+		opt(s, "netmask", net.IP(ipnet.Mask).String())
+	} else {
+		opt(s, "target", ipnet.String())
+	}
+	if gw := GetString(m, "next", GetString(m, "gateway", "")); gw != "" {
+		if AddrFamily(gw) != family {
+			return nil, fmt.Errorf("gateway %q is not an %s address", gw, family)
+		}
+		opt(s, "gateway", gw)
+	}
+	if src := GetString(m, "source", ""); src != "" {
+		if AddrFamily(src) != family {
+			return nil, fmt.Errorf("source %q is not an %s address", src, family)
+		}
+		opt(s, "source", src)
+	}
+	if cost, ok := m["cost"]; ok {
+		metric := GetInt(m, "cost", -1)
+		if metric < 0 {
+			return nil, fmt.Errorf("bad cost %v", cost)
+		}
+		opt(s, "metric", strconv.Itoa(metric))
+	}
+	opt(s, "table", GetString(m, "table", ""))
+	opt(s, "type", GetString(m, "type", ""))
+	if mtu := GetInt(m, "mtu", 0); mtu > 0 {
+		opt(s, "mtu", strconv.Itoa(mtu))
+	}
+	optBool(s, "onlink", GetBool(m, "onlink", false))
+	return s, nil
+}
+
+var ipRuleActions = map[string]bool{"prohibit": true, "unreachable": true, "blackhole": true, "throw": true}
+
+func ipRuleSection(m map[string]any) (*Section, error) {
+	family := GetString(m, "family", "")
+	for _, k := range []string{"src", "dest"} {
+		a := GetString(m, k, "")
+		if a == "" {
+			continue
+		}
+		f := AddrFamily(a)
+		if f == "" {
+			return nil, fmt.Errorf("bad %s %q", k, a)
+		}
+		if family != "" && family != f {
+			return nil, fmt.Errorf("%s %q does not match family %s", k, a, family)
+		}
+		family = f
+	}
+	if family == "" {
+		family = "ipv4"
+	}
+	if family != "ipv4" && family != "ipv6" {
+		return nil, fmt.Errorf("unknown family %q", family)
+	}
+
+	lookup, action, gto := GetString(m, "lookup", ""), GetString(m, "action", ""), GetString(m, "goto", "")
+	set := 0
+	for _, v := range []string{lookup, action, gto} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one of lookup, action or goto is required")
+	}
+	if action != "" && !ipRuleActions[action] {
+		return nil, fmt.Errorf("unknown action %q", action)
+	}
+
+	s := &Section{Type: "rule"}
+	if family == "ipv6" {
+		s.Type = "rule6"
+	}
+	for _, k := range []string{"in", "out", "src", "dest", "tos", "mark", "priority"} {
+		opt(s, k, GetString(m, k, ""))
+	}
+	opt(s, "lookup", lookup)
+	opt(s, "action", action)
+	opt(s, "goto", gto)
+	optBool(s, "invert", GetBool(m, "invert", false))
+	return s, nil
+}
@@ -0,0 +1,121 @@
+package uci
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ValidationError — ошибка в конкретном месте NetJSON.
+type ValidationError struct {
+	Path string `json:"path"` // JSON Pointer (RFC 6901): "/wireless/interfaces/2/key"
+	Msg  string `json:"msg"`
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Msg
+	}
+	return e.Path + ": " + e.Msg
+}
+
+// ValidationErrors — все ошибки строгого режима (Options.Strict) одним значением.
+type ValidationErrors []*ValidationError
+
+func (es ValidationErrors) Error() string {
+	parts := make([]string, len(es))
+	for i, e := range es {
+		parts[i] = e.Error()
+	}
+	return fmt.Sprintf("uci: %d validation error(s): %s", len(es), strings.Join(parts, "; "))
+}
+
+// Pointer собирает JSON Pointer из сегментов ("~" → "~0", "/" → "~1").
+func Pointer(parts ...any) string {
+	var b strings.Builder
+	for _, p := range parts {
+		s := fmt.Sprint(p)
+		b.WriteByte('/')
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(s))
+	}
+	return b.String()
+}
+
+// At привязывает ошибку элемента к его месту в NetJSON; вложенный *ValidationError
+// (путь относительно элемента) дописывается к пути.
+func At(err error, parts ...any) error {
+	if ve, ok := err.(*ValidationError); ok {
+		return &ValidationError{Path: Pointer(parts...) + ve.Path, Msg: ve.Msg}
+	}
+	return &ValidationError{Path: Pointer(parts...), Msg: err.Error()}
+}
+
+// Collector копит ошибки строгого режима; его встраивают Context и контексты других бэкендов
+// (networkd, routeros), чтобы Invalid/Fail вели себя одинаково.
+type Collector struct {
+	Strict bool
+	Errs   []*ValidationError
+}
+
+// Invalid отмечает некорректное значение, которое в обычном режиме пропускается/рендерится
+// как есть (совместимость со старыми шаблонами), а в строгом — проваливает RenderAll.
+func (c *Collector) Invalid(path, format string, args ...any) {
+	if c.Strict {
+		c.Errs = append(c.Errs, &ValidationError{Path: path, Msg: fmt.Sprintf(format, args...)})
+	}
+}
+
+// Fail — ошибка рендерера (или раздела "uci") в строгом режиме: копим и идём дальше,
+// чтобы за один проход показать всё, что сломано.
+func (c *Collector) Fail(key string, err error) {
+	if ve, ok := err.(*ValidationError); ok {
+		c.Errs = append(c.Errs, ve)
+		return
+	}
+	c.Errs = append(c.Errs, &ValidationError{Path: Pointer(key), Msg: err.Error()})
+}
+
+// ===== проверки значений =====
+
+func checkIP(c *Context, path, v string) {
+	if v != "" && net.ParseIP(v) == nil {
+		c.Invalid(path, "%q is not an IP address", v)
+	}
+}
+
+func checkCIDR(c *Context, path, v string) {
+	if _, _, err := net.ParseCIDR(v); err != nil && v != "" {
+		c.Invalid(path, "%q is not a CIDR prefix", v)
+	}
+}
+
+// checkWGKey — ключ WireGuard: base64 от 32 байт.
+func checkWGKey(c *Context, path, v string) {
+	if v == "" {
+		return
+	}
+	if b, err := base64.StdEncoding.DecodeString(v); err != nil || len(b) != 32 {
+		c.Invalid(path, "not a WireGuard key (base64 of 32 bytes)")
+	}
+}
+
+func checkPort(c *Context, path, v string) {
+	if n, err := strconv.Atoi(v); err != nil || n < 1 || n > 65535 {
+		c.Invalid(path, "bad port %q", v)
+	}
+}
+
+// EachItem обходит массив объектов NetJSON (если v — массив), передавая путь элемента.
+func EachItem(v any, path []any, fn func(m map[string]any, p []any) error) error {
+	items, _ := AsSlice(v)
+	for i, it := range items {
+		m, _ := AsMap(it)
+		p := append(append([]any{}, path...), i)
+		if err := fn(m, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
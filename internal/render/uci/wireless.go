@@ -0,0 +1,348 @@
+package uci
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// wireless:
+//
+//	{"radios": [{"name": "radio0", "band": "5g", "channel": 36, "htmode": "VHT80", "txpower": 20, "country": "DE"}],
+//	 "interfaces": [
+//	   {"device": "radio0", "ssid": "corp", "encryption": "wpa3-mixed", "network": "lan",
+//	    "radius": {"auth_server": "10.0.0.5", "auth_secret": "s", "acct_server": "10.0.0.5", "acct_secret": "s"},
+//	    "ieee80211r": true, "mobility_domain": "4f57", "ieee80211w": 1, "isolate": true},
+//	   {"device": "radio0", "mode": "mesh", "mesh_id": "backhaul", "encryption": "sae", "key": "..", "mesh_fwding": true}]}
+//
+// Секции wifi-iface именуются name или <device>_<mode><n> (radio0_ap0, radio0_ap1, radio0_mesh0),
+// чтобы несколько SSID на одном радио не сливались в анонимные секции.
+// Недопустимые сочетания (VHT на 2g, PSK на 6g, 802.11r не в режиме ap, ...) — ошибка рендера.
+
+var (
+	wifiBands   = map[string]bool{"2g": true, "5g": true, "6g": true, "60g": true}
+	wifiModes   = map[string]bool{"ap": true, "sta": true, "adhoc": true, "mesh": true, "monitor": true}
+	wifiHTMode  = regexp.MustCompile(`^(NOHT|HT(20|40[+-]?)|VHT(20|40|80|160)|HE(20|40|80|160)|EHT(20|40|80|160|320))$`)
+	mobilityDom = regexp.MustCompile(`^[0-9a-fA-F]{4}$`)
+	sectionName = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+// wifiEnc — базовые режимы шифрования (без суффикса шифра "+ccmp").
+var wifiEnc = map[string]struct {
+	key        bool // нужен key (PSK/SAE)
+	enterprise bool // 802.1X
+	pmf        int  // минимальный ieee80211w
+	wpa3       bool // допустим на 6 ГГц
+}{
+	"none":       {},
+	"psk":        {key: true},
+	"psk2":       {key: true},
+	"psk-mixed":  {key: true},
+	"sae":        {key: true, pmf: 2, wpa3: true},
+	"sae-mixed":  {key: true, pmf: 1},
+	"owe":        {pmf: 2, wpa3: true},
+	"wpa":        {enterprise: true},
+	"wpa2":       {enterprise: true},
+	"wpa-mixed":  {enterprise: true},
+	"wpa3":       {enterprise: true, pmf: 2, wpa3: true},
+	"wpa3-mixed": {enterprise: true, pmf: 1},
+}
+
+func renderWireless(v any, c *Context) error {
+	w, _ := AsMap(v)
+	if w == nil {
+		return nil
+	}
+	c.Doc.Package("wireless")
+
+	bands := map[string]string{} // radio → band
+	radios, _ := AsSlice(w["radios"])
+	for i, r := range radios {
+		m, _ := AsMap(r)
+		name := GetString(m, "name", "")
+		if name == "" {
+			return At(fmt.Errorf("name is required"), "wireless", "radios", i)
+		}
+		s, band, err := wifiDevice(name, m)
+		if err != nil {
+			return At(err, "wireless", "radios", i)
+		}
+		bands[name] = band
+		if err := c.Doc.Add("wireless", s); err != nil {
+			return err
+		}
+	}
+
+	counters := map[string]int{}
+	ifs, _ := AsSlice(w["interfaces"])
+	for i, x := range ifs {
+		m, _ := AsMap(x)
+		s, err := wifiIface(m, bands)
+		if err != nil {
+			return At(err, "wireless", "interfaces", i)
+		}
+		if s.Name == "" {
+			key := s.Get("device") + "_" + s.Get("mode")
+			s.Name = sectionName.ReplaceAllString(fmt.Sprintf("%s%d", key, counters[key]), "_")
+			counters[key]++
+		}
+		if err := c.Doc.Add("wireless", s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func wifiDevice(name string, m map[string]any) (*Section, string, error) {
+	s := &Section{Type: "wifi-device", Name: name}
+	opt(s, "type", GetString(m, "type", "mac80211"))
+
+	band := GetString(m, "band", "")
+	if band == "" {
+		// старый hwmode: 11a → 5g, 11b/g/n → 2g
+		switch GetString(m, "hwmode", "") {
+		case "11a":
+			band = "5g"
+		case "11b", "11g", "11n":
+			band = "2g"
+		}
+	} else if !wifiBands[band] {
+		return nil, "", fmt.Errorf("unknown band %q", band)
+	}
+	opt(s, "band", band)
+	opt(s, "hwmode", GetString(m, "hwmode", ""))
+
+	ch := GetString(m, "channel", "auto")
+	if ch != "auto" {
+		if n, err := strconv.Atoi(ch); err != nil || n <= 0 {
+			return nil, "", fmt.Errorf("bad channel %q", ch)
+		}
+	}
+	opt(s, "channel", ch)
+
+	if ht := GetString(m, "htmode", ""); ht != "" {
+		if !wifiHTMode.MatchString(ht) {
+			return nil, "", fmt.Errorf("unknown htmode %q", ht)
+		}
+		if band == "2g" && strings.HasPrefix(ht, "VHT") {
+			return nil, "", fmt.Errorf("htmode %s is not available on 2g", ht)
+		}
+		if band == "6g" && !strings.HasPrefix(ht, "HE") && !strings.HasPrefix(ht, "EHT") {
+			return nil, "", fmt.Errorf("6g requires HE/EHT htmode, got %s", ht)
+		}
+		opt(s, "htmode", ht)
+	}
+	if tx := GetInt(m, "txpower", 0); tx != 0 {
+		if tx < 0 || tx > 36 {
+			return nil, "", fmt.Errorf("txpower %d dBm out of range", tx)
+		}
+		opt(s, "txpower", strconv.Itoa(tx))
+	}
+	if cc := GetString(m, "country", ""); cc != "" {
+		if len(cc) != 2 {
+			return nil, "", fmt.Errorf("country must be a 2-letter code, got %q", cc)
+		}
+		opt(s, "country", strings.ToUpper(cc))
+	}
+	optBool(s, "disabled", GetBool(m, "disabled", false))
+	return s, band, nil
+}
+
+func wifiIface(m map[string]any, bands map[string]string) (*Section, error) {
+	dev := GetString(m, "device", "")
+	if dev == "" {
+		return nil, fmt.Errorf("device is required")
+	}
+	band, known := bands[dev]
+	if len(bands) > 0 && !known {
+		return nil, fmt.Errorf("unknown radio %q", dev)
+	}
+	mode := GetString(m, "mode", "ap")
+	if !wifiModes[mode] {
+		return nil, fmt.Errorf("unknown mode %q", mode)
+	}
+
+	s := &Section{Type: "wifi-iface", Name: GetString(m, "name", "")}
+	opt(s, "device", dev)
+	opt(s, "mode", mode)
+	if mode != "monitor" {
+		opt(s, "network", GetString(m, "network", "lan"))
+	}
+
+	switch mode {
+	case "mesh":
+		id := GetString(m, "mesh_id", "")
+		if id == "" {
+			return nil, fmt.Errorf("mesh mode requires mesh_id")
+		}
+		opt(s, "mesh_id", id)
+		opt(s, "mesh_fwding", boolStr(GetBool(m, "mesh_fwding", true)))
+		if th := GetInt(m, "mesh_rssi_threshold", 0); th != 0 {
+			opt(s, "mesh_rssi_threshold", strconv.Itoa(th))
+		}
+	case "monitor":
+	default:
+		ssid := GetString(m, "ssid", "")
+		if ssid == "" {
+			return nil, fmt.Errorf("mode %s requires ssid", mode)
+		}
+		if len(ssid) > 32 {
+			return nil, fmt.Errorf("ssid %q longer than 32 bytes", ssid)
+		}
+		opt(s, "ssid", ssid)
+		optBool(s, "hidden", GetBool(m, "hidden", false))
+	}
+
+	if err := wifiSecurity(s, m, mode, band); err != nil {
+		return nil, err
+	}
+
+	if GetBool(m, "ieee80211r", false) {
+		if mode != "ap" {
+			return nil, fmt.Errorf("ieee80211r is only valid in ap mode")
+		}
+		opt(s, "ieee80211r", "1")
+		if md := GetString(m, "mobility_domain", ""); md != "" {
+			if !mobilityDom.MatchString(md) {
+				return nil, fmt.Errorf("mobility_domain must be 4 hex digits, got %q", md)
+			}
+			opt(s, "mobility_domain", strings.ToLower(md))
+		}
+		if _, ok := m["ft_over_ds"]; ok {
+			opt(s, "ft_over_ds", boolStr(GetBool(m, "ft_over_ds", false)))
+		}
+		optBool(s, "ft_psk_generate_local", GetBool(m, "ft_psk_generate_local", false))
+	}
+	if GetBool(m, "isolate", false) {
+		if mode != "ap" {
+			return nil, fmt.Errorf("isolate is only valid in ap mode")
+		}
+		opt(s, "isolate", "1")
+	}
+	optBool(s, "wds", GetBool(m, "wds", false))
+	optBool(s, "disabled", GetBool(m, "disabled", false))
+	return s, nil
+}
+
+// wifiSecurity — encryption/key/ieee80211w/RADIUS с проверкой сочетаний режима и диапазона.
+func wifiSecurity(s *Section, m map[string]any, mode, band string) error {
+	key := GetString(m, "key", "")
+	def := "none"
+	if key != "" {
+		def = "psk2"
+	}
+	enc := GetString(m, "encryption", def)
+	base, _, _ := strings.Cut(enc, "+")
+	e, ok := wifiEnc[base]
+	if !ok {
+		return fmt.Errorf("unknown encryption %q", enc)
+	}
+
+	switch mode {
+	case "monitor":
+		if base != "none" {
+			return fmt.Errorf("monitor mode does not take encryption")
+		}
+		return nil
+	case "mesh":
+		if base != "none" && base != "sae" {
+			return fmt.Errorf("mesh supports only none or sae, got %s", base)
+		}
+	case "adhoc":
+		if e.enterprise || base == "owe" || base == "sae-mixed" {
+			return fmt.Errorf("%s is not supported in adhoc mode", base)
+		}
+	}
+	if band == "6g" && !e.wpa3 {
+		return fmt.Errorf("6g requires sae, owe or wpa3, got %s", base)
+	}
+	opt(s, "encryption", enc)
+
+	if e.key {
+		if key == "" {
+			return fmt.Errorf("encryption %s requires key", base)
+		}
+		if strings.HasPrefix(base, "psk") && !validPSK(key) {
+			return fmt.Errorf("psk key must be 8..63 characters or 64 hex digits")
+		}
+		opt(s, "key", key)
+	} else if key != "" && !e.enterprise {
+		return fmt.Errorf("encryption %s does not take key", base)
+	}
+
+	if e.enterprise {
+		if err := wifiEAP(s, m, mode); err != nil {
+			return err
+		}
+	}
+
+	if _, set := m["ieee80211w"]; set {
+		w := GetInt(m, "ieee80211w", -1)
+		if w < 0 || w > 2 {
+			return fmt.Errorf("ieee80211w must be 0, 1 or 2")
+		}
+		if w < e.pmf {
+			return fmt.Errorf("encryption %s needs ieee80211w >= %d", base, e.pmf)
+		}
+		if w > 0 && base == "none" {
+			return fmt.Errorf("ieee80211w needs encryption")
+		}
+		opt(s, "ieee80211w", strconv.Itoa(w))
+	}
+	return nil
+}
+
+// wifiEAP: в режиме ap — RADIUS-серверы (auth обязателен, acct по желанию),
+// в режиме sta — учётные данные EAP.
+func wifiEAP(s *Section, m map[string]any, mode string) error {
+	if mode == "sta" {
+		id := GetString(m, "identity", "")
+		if id == "" {
+			return fmt.Errorf("enterprise sta requires identity")
+		}
+		opt(s, "eap_type", GetString(m, "eap_type", "peap"))
+		opt(s, "auth", GetString(m, "auth", ""))
+		opt(s, "identity", id)
+		opt(s, "password", GetString(m, "password", ""))
+		opt(s, "ca_cert", GetString(m, "ca_cert", ""))
+		return nil
+	}
+	if mode != "ap" {
+		return fmt.Errorf("enterprise encryption is only valid in ap or sta mode")
+	}
+	r, _ := AsMap(m["radius"])
+	if GetString(r, "auth_server", "") == "" || GetString(r, "auth_secret", "") == "" {
+		return fmt.Errorf("enterprise ap requires radius.auth_server and radius.auth_secret")
+	}
+	opt(s, "auth_server", GetString(r, "auth_server", ""))
+	opt(s, "auth_port", GetString(r, "auth_port", "1812"))
+	opt(s, "auth_secret", GetString(r, "auth_secret", ""))
+	if acct := GetString(r, "acct_server", ""); acct != "" {
+		opt(s, "acct_server", acct)
+		opt(s, "acct_port", GetString(r, "acct_port", "1813"))
+		opt(s, "acct_secret", GetString(r, "acct_secret", GetString(r, "auth_secret", "")))
+	}
+	opt(s, "nasid", GetString(r, "nasid", ""))
+	optBool(s, "dynamic_vlan", GetBool(r, "dynamic_vlan", false))
+	return nil
+}
+
+func validPSK(k string) bool {
+	if len(k) == 64 {
+		for _, r := range k {
+			if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+				return false
+			}
+		}
+		return true
+	}
+	return len(k) >= 8 && len(k) <= 63
+}
+
+func boolStr(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
 	"crypto/sha256"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 
@@ -32,11 +34,14 @@ type RegisterInput struct {
 	ExpectedSecret string
 	Name           string
 	MAC            string
-	Model          string // ← было Backend
+	Model          string   // ← было Backend
+	HardwareModel  string   // модель железа (поле model агента), см. Device.HardwareModel
+	Tags           []string // теги агента (option tags в openwisp-config); пустой — не менять
 	KeyOptional    string
 	ConsistentKey  bool
 }
 type RegisterResult struct {
+	ID    uint
 	UUID  string
 	Key   string
 	Name  string
@@ -80,28 +85,36 @@ func (s *DeviceStore) Register(ctx context.Context, in RegisterInput) (*Register
 		if m := strings.TrimSpace(in.Model); m != "" && d.Model != m {
 			updates["model"] = m
 		}
+		if m := strings.TrimSpace(in.HardwareModel); m != "" && d.HardwareModel != m {
+			updates["hardware_model"] = m
+		}
 		if mac != "" && d.MAC != mac {
 			updates["mac"] = mac
 		}
+		if tags := tagsJSON(in.Tags); tags != nil && !bytes.Equal(d.Tags, tags) {
+			updates["tags"] = tags
+		}
 		if len(updates) > 0 {
 			updates["updated_at"] = now
 			_ = s.db.WithContext(ctx).Model(&d).Updates(updates).Error
 		}
-		return &RegisterResult{UUID: d.UUID, Key: d.Key, Name: d.Name, IsNew: false}, nil
+		return &RegisterResult{ID: d.ID, UUID: d.UUID, Key: d.Key, Name: d.Name, IsNew: false}, nil
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, err
 	}
 
 	// 4) создать новое устройство (идемпотентно на случай гонки)
 	d = models.Device{
-		UUID:      uuid.NewString(),
-		Name:      strings.TrimSpace(in.Name),
-		Model:     strings.TrimSpace(in.Model),
-		MAC:       mac,
-		Key:       key, // поле модели должно быть с тегом: gorm:"column:device_key;uniqueIndex"
-		Status:    models.DeviceStatusUnknown,
-		CreatedAt: now,
-		UpdatedAt: now,
+		UUID:          uuid.NewString(),
+		Name:          strings.TrimSpace(in.Name),
+		Model:         strings.TrimSpace(in.Model),
+		HardwareModel: strings.TrimSpace(in.HardwareModel),
+		MAC:           mac,
+		Tags:          tagsJSON(in.Tags),
+		Key:           key, // поле модели должно быть с тегом: gorm:"column:device_key;uniqueIndex"
+		Status:        models.DeviceStatusUnknown,
+		CreatedAt:     now,
+		UpdatedAt:     now,
 	}
 
 	// ON CONFLICT (device_key) DO NOTHING → если уже кто-то успел создать — просто перечитаем
@@ -119,10 +132,36 @@ func (s *DeviceStore) Register(ctx context.Context, in RegisterInput) (*Register
 		if err := s.db.WithContext(ctx).Where("device_key = ?", key).First(&d).Error; err != nil {
 			return nil, err
 		}
-		return &RegisterResult{UUID: d.UUID, Key: d.Key, Name: d.Name, IsNew: false}, nil
+		return &RegisterResult{ID: d.ID, UUID: d.UUID, Key: d.Key, Name: d.Name, IsNew: false}, nil
 	}
 
-	return &RegisterResult{UUID: d.UUID, Key: d.Key, Name: d.Name, IsNew: true}, nil
+	return &RegisterResult{ID: d.ID, UUID: d.UUID, Key: d.Key, Name: d.Name, IsNew: true}, nil
+}
+
+// tagsJSON — Device.Tags из тегов агента: JSON-массив строк, nil без тегов.
+func tagsJSON(tags []string) datatypes.JSON {
+	if len(tags) == 0 {
+		return nil
+	}
+	b, _ := json.Marshal(tags)
+	return b
+}
+
+// metaTags — теги из metadata адаптера: массив строк или строка через пробел.
+func metaTags(v any) []string {
+	switch t := v.(type) {
+	case string:
+		return strings.Fields(t)
+	case []any:
+		var out []string
+		for _, x := range t {
+			if s, ok := x.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
 }
 
 // -------- Агентские методы (uuid+key) уже есть --------
@@ -249,6 +288,10 @@ func (s *DeviceStore) Adopt(ctx context.Context, in AdoptInput) (*models.Device,
 			if mdl, ok := in.Metadata["model"].(string); ok {
 				d.Model = mdl
 			}
+			if hw, ok := in.Metadata["hardware_model"].(string); ok {
+				d.HardwareModel = hw
+			}
+			d.Tags = tagsJSON(metaTags(in.Metadata["tags"]))
 		}
 		if err := tx.Create(&d).Error; err != nil {
 			return nil, err
@@ -272,6 +315,12 @@ func (s *DeviceStore) Adopt(ctx context.Context, in AdoptInput) (*models.Device,
 		if mdl, ok := in.Metadata["model"].(string); ok && mdl != "" {
 			d.Model = mdl
 		}
+		if hw, ok := in.Metadata["hardware_model"].(string); ok && hw != "" {
+			d.HardwareModel = hw
+		}
+		if tags := tagsJSON(metaTags(in.Metadata["tags"])); tags != nil {
+			d.Tags = tags
+		}
 	}
 	if err := tx.Save(&d).Error; err != nil {
 		return nil, err
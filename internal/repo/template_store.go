@@ -3,20 +3,32 @@ package repo
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"wisp/internal/models"
+	"wisp/internal/render/backend"
+	rnetjson "wisp/internal/render/netjson"
 )
 
 type TemplateStore struct{ db *gorm.DB }
 
 func NewTemplateStore(db *gorm.DB) *TemplateStore { return &TemplateStore{db: db} }
 
-// Пока просто отдаём все шаблоны по возрастанию priority (org/site/role можно добавить позже).
+// ErrTemplateRequired — Required-шаблон нельзя отвязать от устройства.
+var ErrTemplateRequired = errors.New("template is required and cannot be detached")
+
+// ListForDevice — шаблоны устройства по возрастанию priority: привязанные (DeviceTemplate) и все Required.
+// При обновлении с версии без привязок миграция в server/app.go один раз вызывает AssignAllToAll.
 func (s *TemplateStore) ListForDevice(ctx context.Context, deviceID uint) ([]models.ConfigTemplate, error) {
+	assigned := s.db.Model(&models.DeviceTemplate{}).Select("template_id").Where("device_id = ?", deviceID)
 	var tpls []models.ConfigTemplate
 	if err := s.db.WithContext(ctx).
+		Where("required = ? OR id IN (?)", true, assigned).
 		Order("priority asc, id asc").
 		Find(&tpls).Error; err != nil {
 		return nil, err
@@ -24,14 +36,169 @@ func (s *TemplateStore) ListForDevice(ctx context.Context, deviceID uint) ([]mod
 	return tpls, nil
 }
 
-// Базовые переменные для ApplyVars (расширите при необходимости).
+// Assign привязывает шаблон к устройству (повторная привязка — не ошибка).
+func (s *TemplateStore) Assign(ctx context.Context, deviceID, templateID uint) error {
+	return s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "device_id"}, {Name: "template_id"}},
+			DoNothing: true,
+		}).
+		Create(&models.DeviceTemplate{DeviceID: deviceID, TemplateID: templateID}).Error
+}
+
+// Unassign отвязывает шаблон; Required — ErrTemplateRequired.
+func (s *TemplateStore) Unassign(ctx context.Context, deviceID, templateID uint) error {
+	var t models.ConfigTemplate
+	if err := s.db.WithContext(ctx).First(&t, templateID).Error; err != nil {
+		return err
+	}
+	if t.Required {
+		return ErrTemplateRequired
+	}
+	return s.db.WithContext(ctx).
+		Where("device_id = ? AND template_id = ?", deviceID, templateID).
+		Delete(&models.DeviceTemplate{}).Error
+}
+
+// AssignDefaults привязывает к устройству все Default-шаблоны (при регистрации нового устройства).
+func (s *TemplateStore) AssignDefaults(ctx context.Context, deviceID uint) error {
+	var ids []uint
+	if err := s.db.WithContext(ctx).Model(&models.ConfigTemplate{}).Where("is_default = ?", true).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.Assign(ctx, deviceID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AssignAllToAll привязывает каждый шаблон к каждому устройству — разовая миграция со схемы,
+// где ListForDevice отдавал все шаблоны всем (см. server/app.go). Возвращает число привязок.
+func (s *TemplateStore) AssignAllToAll(ctx context.Context) (int, error) {
+	var devIDs, tplIDs []uint
+	if err := s.db.WithContext(ctx).Model(&models.Device{}).Pluck("id", &devIDs).Error; err != nil {
+		return 0, err
+	}
+	if err := s.db.WithContext(ctx).Model(&models.ConfigTemplate{}).Pluck("id", &tplIDs).Error; err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, d := range devIDs {
+		for _, t := range tplIDs {
+			if err := s.Assign(ctx, d, t); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// DevicesForTemplate — UUID устройств, на которые действует шаблон: все для Required, иначе привязанные.
+func (s *TemplateStore) DevicesForTemplate(ctx context.Context, t models.ConfigTemplate) ([]string, error) {
+	q := s.db.WithContext(ctx).Model(&models.Device{})
+	if !t.Required {
+		q = q.Where("id IN (?)", s.db.Model(&models.DeviceTemplate{}).Select("device_id").Where("template_id = ?", t.ID))
+	}
+	var uuids []string
+	if err := q.Order("id asc").Pluck("uuid", &uuids).Error; err != nil {
+		return nil, err
+	}
+	return uuids, nil
+}
+
+// Delete удаляет шаблон вместе с его привязками.
+func (s *TemplateStore) Delete(ctx context.Context, id uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("template_id = ?", id).Delete(&models.DeviceTemplate{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.ConfigTemplate{}, id).Error
+	})
+}
+
+// Expand разворачивает наследование каждого шаблона из tpls (см. ExpandTemplate) в порядке tpls;
+// части одного шаблона идут подряд с его Priority.
+func (s *TemplateStore) Expand(ctx context.Context, tpls []models.ConfigTemplate) ([]TemplatePart, error) {
+	var all []models.ConfigTemplate
+	if err := s.db.WithContext(ctx).Find(&all).Error; err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.ConfigTemplate, len(all))
+	for _, t := range all {
+		byName[t.Name] = t
+	}
+	lookup := func(name string) (models.ConfigTemplate, bool) {
+		t, ok := byName[name]
+		return t, ok
+	}
+	var out []TemplatePart
+	for _, t := range tpls {
+		parts, err := ExpandTemplate(t, lookup)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, parts...)
+	}
+	return out, nil
+}
+
+// BuiltinVars — переменные, которые VarsForDevice задаёт сам (в форме переменных их нет).
+var BuiltinVars = []string{"device_uuid", "device_name", "model", "hardware_model", "mac", "backend", "tags"}
+
+// Переменные для ApplyVars и $if: Device.Vars + встроенные device_uuid/device_name/model/hardware_model/
+// mac/backend/tags (встроенные имеют приоритет, чтобы их нельзя было подменить из Vars).
+// model — backend-строка агента, hardware_model — модель платы; tags — список тегов устройства
+// (всегда массив, для has .tags "outdoor").
 func (s *TemplateStore) VarsForDevice(ctx context.Context, dev *models.Device) (map[string]any, error) {
-	return map[string]any{
-		"device_uuid": dev.UUID,
-		"device_name": dev.Name,
-		"model":       dev.Model,
-		"mac":         dev.MAC,
-	}, nil
+	vars := map[string]any{}
+	if len(dev.Vars) > 0 {
+		if err := json.Unmarshal(dev.Vars, &vars); err != nil {
+			return nil, fmt.Errorf("device %s vars: %w", dev.UUID, err)
+		}
+	}
+	if vars == nil {
+		vars = map[string]any{} // Vars = null
+	}
+	vars["device_uuid"] = dev.UUID
+	vars["device_name"] = dev.Name
+	vars["model"] = dev.Model
+	vars["hardware_model"] = dev.HardwareModel
+	vars["mac"] = dev.MAC
+	vars["backend"] = backend.ForModel(dev.Model).Name
+	tags := []any{}
+	if len(dev.Tags) > 0 {
+		if err := json.Unmarshal(dev.Tags, &tags); err != nil {
+			return nil, fmt.Errorf("device %s tags: %w", dev.UUID, err)
+		}
+	}
+	if tags == nil {
+		tags = []any{} // Tags = null
+	}
+	vars["tags"] = tags
+	return vars, nil
+}
+
+// VarsWithDefaults — копия vars с default из VarsSchema частей (см. rnetjson.Schema.Defaults) для
+// переменных, которых у устройства нет; как и в форме переменных, выигрывает первая по порядку
+// схема. Встроенные переменные всегда заданы, их default не действует.
+func VarsWithDefaults(parts []TemplatePart, vars map[string]any) (map[string]any, error) {
+	out := make(map[string]any, len(vars))
+	for k, v := range vars {
+		out[k] = v
+	}
+	for _, p := range parts {
+		s, err := rnetjson.ParseSchema(p.Template.VarsSchema)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", p.Template.Name, err)
+		}
+		if s != nil {
+			s.Defaults(out)
+		}
+	}
+	return out, nil
 }
 
 // DecodeNetJSON — хелпер для распаковки JSON поля шаблона в map[string]any.
@@ -45,3 +212,74 @@ func DecodeNetJSON(t models.ConfigTemplate) (map[string]any, error) {
 	}
 	return m, nil
 }
+
+// ===== наследование =====
+
+// TemplatePart — шаблон из развёрнутой цепочки; Chain — имена от исходного шаблона до этого.
+type TemplatePart struct {
+	Template models.ConfigTemplate
+	Chain    []string
+	Priority int // Priority исходного шаблона
+}
+
+// Name — имя части для provenance и админки: "site > base > fw".
+func (p TemplatePart) Name() string { return strings.Join(p.Chain, " > ") }
+
+// TemplateIncludes — имена из ConfigTemplate.Includes.
+func TemplateIncludes(t models.ConfigTemplate) ([]string, error) {
+	if len(t.Includes) == 0 {
+		return nil, nil
+	}
+	var names []string
+	if err := json.Unmarshal(t.Includes, &names); err != nil {
+		return nil, fmt.Errorf("template %s includes: %w", t.Name, err)
+	}
+	return names, nil
+}
+
+// ExpandTemplate разворачивает наследование t в порядке слияния (следующая часть перекрывает
+// предыдущую): родитель со своей развёрткой, затем includes по порядку (каждый со своей),
+// в конце сам t. Шаблон, уже вошедший в развёртку (ромб), повторно не добавляется;
+// цикл и неизвестное имя — ошибка. Все части сливаются с Priority t.
+func ExpandTemplate(t models.ConfigTemplate, lookup func(name string) (models.ConfigTemplate, bool)) ([]TemplatePart, error) {
+	var out []TemplatePart
+	done := map[string]bool{}
+	var walk func(t models.ConfigTemplate, chain []string) error
+	walk = func(t models.ConfigTemplate, chain []string) error {
+		for _, name := range chain {
+			if name == t.Name {
+				return fmt.Errorf("template cycle: %s", strings.Join(append(chain, t.Name), " > "))
+			}
+		}
+		chain = append(chain[:len(chain):len(chain)], t.Name)
+		if done[t.Name] {
+			return nil
+		}
+		deps, err := TemplateIncludes(t)
+		if err != nil {
+			return err
+		}
+		if t.Parent != "" {
+			deps = append([]string{t.Parent}, deps...)
+		}
+		for _, name := range deps {
+			d, ok := lookup(name)
+			if !ok {
+				return fmt.Errorf("template %s: unknown template %q", t.Name, name)
+			}
+			if err := walk(d, chain); err != nil {
+				return err
+			}
+		}
+		done[t.Name] = true
+		out = append(out, TemplatePart{Template: t, Chain: chain})
+		return nil
+	}
+	if err := walk(t, nil); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].Priority = t.Priority
+	}
+	return out, nil
+}
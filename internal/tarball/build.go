@@ -6,6 +6,7 @@ import (
 	"compress/gzip"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -14,7 +15,8 @@ import (
 	"wisp/internal/render/uci"
 )
 
-// Build собирает tar.gz из рендеренных UCI-файлов и extra-артефактов.
+// Build собирает tar.gz из рендеренных файлов (UCI + блок files, с их Mode) и extra-артефактов.
+// Повтор пути (например, files против сгенерированного VPN-артефакта) — ошибка.
 // Возвращает архив и sha256 в hex.
 func Build(files []uci.File, extra map[string][]byte) ([]byte, string, error) {
 	var buf bytes.Buffer
@@ -27,6 +29,7 @@ func Build(files []uci.File, extra map[string][]byte) ([]byte, string, error) {
 
 	tw := tar.NewWriter(gz)
 
+	seen := map[string]bool{}
 	add := func(name string, data []byte, mode int64) error {
 		// sanitize path: no leading slash, clean, unix slashes
 		name = strings.TrimLeft(name, "/")
@@ -34,6 +37,14 @@ func Build(files []uci.File, extra map[string][]byte) ([]byte, string, error) {
 		if name == "" || name == "." {
 			return nil
 		}
+		// агент распаковывает архив в корень — не даём выйти за него и не пишем путь дважды
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("tarball: path %q escapes archive root", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("tarball: duplicate path %q", name)
+		}
+		seen[name] = true
 		hdr := &tar.Header{
 			Name:    name,
 			Mode:    mode,
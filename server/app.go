@@ -57,15 +57,29 @@ func (a *App) Initialize(cfg *config.Config) {
 		}
 		a.db = d
 
+		// до привязок шаблонов (DeviceTemplate) все шаблоны действовали на все устройства
+		backfill := !a.db.Migrator().HasTable(&models.DeviceTemplate{})
+
 		// минимальная доменная модель — только устройство
 		if err := a.db.AutoMigrate(&models.Device{},
 			&models.ConfigTemplate{},
+			&models.DeviceTemplate{},
 			&models.CA{},
 			&models.Certificate{},
 			&models.WireGuardPeer{},
 			&models.DeviceSecret{}); err != nil {
 			log.Fatalf("db migrate failed: %v", err)
 		}
+		// однократно при обновлении: таблица привязок только что создана — привязываем все
+		// существующие шаблоны ко всем существующим устройствам, чтобы первый reconcile после
+		// обновления не снял шаблоны с работающих устройств (на новой установке устройств нет)
+		if backfill {
+			n, err := repo.NewTemplateStore(a.db).AssignAllToAll(context.Background())
+			if err != nil {
+				log.Fatalf("db migrate: backfill device templates: %v", err)
+			}
+			log.Printf("db migrate: assigned existing templates to existing devices (%d links)", n)
+		}
 	}
 
 	go func() {
@@ -95,7 +109,7 @@ func (a *App) Initialize(cfg *config.Config) {
 	)
 
 	// Owagent handlers
-	ow := owagent.New(ds, a.cfg.OpenWISP.SharedSecret, false, rec)
+	ow := owagent.New(ds, a.cfg.OpenWISP.SharedSecret, false, rec, ts)
 	owagent.RegisterRoutes(a.Router, ow)
 
 	/* 4) Health */